@@ -0,0 +1,98 @@
+// Command catalog exports and imports library data (tracks, playlists, likes) for backups
+// and migrations between deployments.
+//
+//	catalog export -collection tracks -format jsonl -out tracks.jsonl
+//	catalog import -collection tracks -format csv -in tracks.csv -dry-run
+package main
+
+import (
+	"amplify-backend/internal/catalog"
+	"amplify-backend/internal/config"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	if len(os.Args) < 2 || (os.Args[1] != "export" && os.Args[1] != "import") {
+		fmt.Fprintln(os.Stderr, "usage: catalog export|import -collection <name> [-format jsonl|csv] [-out|-in <file>] [-dry-run]")
+		fmt.Fprintf(os.Stderr, "collections: %s\n", strings.Join(catalog.Collections(), ", "))
+		os.Exit(2)
+	}
+	command := os.Args[1]
+
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	collection := flags.String("collection", "", "collection to "+command)
+	format := flags.String("format", catalog.FormatJSONL, "jsonl or csv")
+	path := flags.String("out", "", "output file (export, default stdout)")
+	input := flags.String("in", "", "input file (import, default stdin)")
+	dryRun := flags.Bool("dry-run", false, "validate and report without writing (import)")
+	flags.Parse(os.Args[2:])
+
+	if err := catalog.Validate(*collection, *format); err != nil {
+		log.Fatalf("%v (collections: %s)", err, strings.Join(catalog.Collections(), ", "))
+	}
+
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found")
+	}
+
+	mongoClient, err := config.InitMongo()
+	if err != nil {
+		log.Fatal("Mongo init failed:", err)
+	}
+	defer mongoClient.Disconnect(context.TODO())
+
+	cat := catalog.NewCatalog(mongoClient.Database("connectify"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), catalog.Timeout)
+	defer cancel()
+
+	if command == "export" {
+		var w io.Writer = os.Stdout
+		if *path != "" {
+			file, err := os.Create(*path)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer file.Close()
+			w = file
+		}
+
+		count, err := cat.Export(ctx, w, *collection, *format)
+		if err != nil {
+			log.Fatalf("Export failed after %d records: %v", count, err)
+		}
+		log.Printf("Exported %d %s", count, *collection)
+		return
+	}
+
+	var r io.Reader = os.Stdin
+	if *input != "" {
+		file, err := os.Open(*input)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer file.Close()
+		r = file
+	}
+
+	report, err := cat.Import(ctx, r, *collection, *format, *dryRun)
+	if report != nil {
+		out, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(out))
+	}
+	if err != nil {
+		log.Fatalf("Import failed: %v", err)
+	}
+	if report.Failed > 0 {
+		os.Exit(1)
+	}
+}
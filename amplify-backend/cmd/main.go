@@ -2,11 +2,17 @@ package main
 
 import (
 	"amplify-backend/internal/auth"
+	"amplify-backend/internal/catalog"
 	"amplify-backend/internal/config"
+	"amplify-backend/internal/library"
+	"amplify-backend/internal/like"
+	"amplify-backend/internal/lyrics"
 	"amplify-backend/internal/middleware"
 	"amplify-backend/internal/music"
 	"amplify-backend/internal/playlist"
+	"amplify-backend/internal/review"
 	"amplify-backend/internal/storage"
+	"amplify-backend/internal/trash"
 	"amplify-backend/internal/websocket"
 	"context"
 	"fmt"
@@ -79,8 +85,16 @@ func main() {
 	storageService = cloudinaryService
 	fmt.Println("Cloudinary storage initialized")
 
+	// Initialize lyrics (also feeds lyric line updates to the WebSocket hub)
+	lyricsService := lyrics.NewLyricsService(db)
+	if err := lyricsService.EnsureIndexes(); err != nil {
+		log.Printf("Failed to create lyrics indexes: %v", err)
+	}
+
 	// Initialize WebSocket hub
 	hub := websocket.NewHub(redisClient)
+	hub.SetLyricsProvider(lyricsService)
+	hub.DescribeMessage("playlist:updated", "A playlist the user owns, collaborates on or follows changed", playlist.PlaylistEvent{})
 	go hub.Run()
 
 	// Initialize Fiber app
@@ -103,41 +117,71 @@ func main() {
 	// Initialize services
 	authService := auth.NewAuthService(db)
 	musicService := music.NewMusicService(db)
+	if err := musicService.EnsureIndexes(); err != nil {
+		log.Printf("Failed to create track revision indexes: %v", err)
+	}
 	playlistService := playlist.NewPlaylistService(db)
+	if err := playlistService.EnsureIndexes(); err != nil {
+		log.Printf("Failed to create playlist indexes: %v", err)
+	}
+	// Push playlist changes to the owner and collaborators
+	playlistService.Notifier = hub
+	// Generated and uploaded playlist covers
+	playlistService.Storage = storageService
+	// Smart playlists evaluate their rules with the track query grammar
+	playlistService.Tracks = musicService
+	// Keep playlist entries in step with tracks being trashed, restored and purged
+	musicService.AddTrackListener(playlistService)
+	libraryService := library.NewLibraryService(db, playlistService)
+	if err := libraryService.EnsureIndexes(); err != nil {
+		log.Printf("Failed to create library indexes: %v", err)
+	}
+	likeService := like.NewLikeService(db)
+	if err := likeService.EnsureIndexes(); err != nil {
+		log.Printf("Failed to create like indexes: %v", err)
+	}
+	reviewService := review.NewReviewService(db)
+	if err := reviewService.EnsureIndexes(); err != nil {
+		log.Printf("Failed to create review indexes: %v", err)
+	}
+	// Drop likes, reviews and lyrics of purged tracks
+	musicService.AddTrackListener(likeService)
+	musicService.AddTrackListener(reviewService)
+	musicService.AddTrackListener(lyricsService)
+
+	// Purge trashed tracks and playlists after the retention period
+	trashPurger := trash.NewPurger(musicService, playlistService, storageService)
+	go trashPurger.Run()
 
 	// Register health check endpoint (public)
 	app.Get("/health", func(c *fiber.Ctx) error {
 		return c.JSON(fiber.Map{"status": "ok"})
 	})
 
-	// Register public music routes (tracks listing, streaming)
-	app.Get("/tracks", func(c *fiber.Ctx) error {
-		tracks, err := musicService.GetAllTracks()
-		if err != nil {
-			return c.Status(500).JSON(fiber.Map{"error": "Failed to get tracks"})
-		}
-		return c.JSON(tracks)
-	})
-
-	app.Get("/tracks/:id", func(c *fiber.Ctx) error {
-		id := c.Params("id")
-		track, err := musicService.GetTrackByID(id)
-		if err != nil {
-			return c.Status(404).JSON(fiber.Map{"error": "Track not found"})
-		}
-		return c.JSON(track)
-	})
-
 	// Register music routes with analytics services (PUBLIC - no auth required for streaming)
 	music.RegisterRoutesWithAnalytics(app, musicService, storageService, &music.AnalyticsServices{
 		MusicService:    musicService,
 		PlaylistService: playlistService,
 		AuthService:     authService,
-	})
+		LikeService:     likeService,
+	}, supabaseConfig)
+
+	// Authenticated routes for the current user (likes, library)
+	meRoutes := app.Group("/me", middleware.SupabaseAuth(supabaseConfig))
+	like.RegisterRoutes(meRoutes, likeService)
+	review.RegisterUserRoutes(meRoutes, reviewService)
+	playlist.RegisterUserRoutes(meRoutes, playlistService)
+	library.RegisterRoutes(meRoutes, libraryService)
+
+	// Public track reviews and lyrics
+	review.RegisterRoutes(app, reviewService)
+	lyrics.RegisterRoutes(app, lyricsService)
 
-	// Register playlist routes (PUBLIC - guest users can view, auth required to create/edit)
-	// Note: Auth enforcement happens at the application logic level, not middleware
-	playlist.RegisterRoutes(app, playlistService)
+	// Virtual "Liked Songs" playlist (must be registered before /playlists/:id)
+	playlist.RegisterLikedSongsRoute(app, likeService, middleware.SupabaseAuth(supabaseConfig))
+
+	// Register playlist routes (PUBLIC - guest users can view public playlists, owner auth required to create/edit)
+	playlist.RegisterRoutes(app, playlistService, supabaseConfig)
 
 	// User management endpoint (TEMPORARILY WITHOUT AUTH FOR TESTING)
 	app.Get("/users", func(c *fiber.Ctx) error {
@@ -176,6 +220,21 @@ func main() {
 		return c.SendStatus(204)
 	})
 
+	// Review moderation
+	review.RegisterAdminRoutes(adminRoutes, reviewService)
+
+	// Lyrics upload
+	lyrics.RegisterAdminRoutes(adminRoutes, lyricsService)
+
+	// Trash: restore and purge deleted tracks and playlists
+	trash.RegisterAdminRoutes(adminRoutes, trashPurger)
+
+	// Playlist integrity check and repair
+	playlist.RegisterAdminRoutes(adminRoutes, playlistService)
+
+	// Catalog export and import (JSON Lines or CSV)
+	catalog.RegisterAdminRoutes(adminRoutes, catalog.NewCatalog(db))
+
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "3000"
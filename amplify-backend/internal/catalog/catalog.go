@@ -0,0 +1,439 @@
+package catalog
+
+import (
+	"amplify-backend/internal/music"
+	"bufio"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	FormatJSONL = "jsonl"
+	FormatCSV   = "csv"
+)
+
+// maxReportedErrors caps the per-record errors kept in an import report
+const maxReportedErrors = 200
+
+// Timeout bounds a whole import or export run
+const Timeout = 10 * time.Minute
+
+var (
+	ErrUnknownCollection = errors.New("unknown collection")
+	ErrUnknownFormat     = errors.New("unknown format, expected jsonl or csv")
+)
+
+// Catalog exports and imports library data for backups and migrations between deployments
+type Catalog struct {
+	DB *mongo.Database
+}
+
+// RecordError describes a record that could not be imported
+type RecordError struct {
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+// ImportReport summarizes an import run
+type ImportReport struct {
+	Collection string        `json:"collection"`
+	Format     string        `json:"format"`
+	DryRun     bool          `json:"dry_run"`
+	Processed  int           `json:"processed"`
+	Inserted   int           `json:"inserted"`
+	Updated    int           `json:"updated"`
+	Failed     int           `json:"failed"`
+	Backfilled int           `json:"backfilled,omitempty"`
+	Errors     []RecordError `json:"errors"`
+}
+
+func NewCatalog(db *mongo.Database) *Catalog {
+	return &Catalog{DB: db}
+}
+
+func lookup(collection, format string) (*collectionSpec, error) {
+	spec, ok := specs[collection]
+	if !ok {
+		return nil, ErrUnknownCollection
+	}
+	if format != FormatJSONL && format != FormatCSV {
+		return nil, ErrUnknownFormat
+	}
+	return spec, nil
+}
+
+// Validate checks that a collection and format can be exported or imported
+func Validate(collection, format string) error {
+	_, err := lookup(collection, format)
+	return err
+}
+
+// Export streams every document of a collection to w, including trashed ones so a restore
+// is complete. It returns the number of records written.
+func (c *Catalog) Export(ctx context.Context, w io.Writer, collection, format string) (int, error) {
+	spec, err := lookup(collection, format)
+	if err != nil {
+		return 0, err
+	}
+
+	cursor, err := c.DB.Collection(spec.Collection).Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var csvWriter *csv.Writer
+	if format == FormatCSV {
+		csvWriter = csv.NewWriter(w)
+		header := make([]string, len(spec.Columns))
+		for i, col := range spec.Columns {
+			header[i] = col.Name
+		}
+		if err := csvWriter.Write(header); err != nil {
+			return 0, err
+		}
+	}
+
+	count := 0
+	for cursor.Next(ctx) {
+		if format == FormatCSV {
+			var doc bson.M
+			if err := cursor.Decode(&doc); err != nil {
+				return count, err
+			}
+			row := make([]string, len(spec.Columns))
+			for i, col := range spec.Columns {
+				row[i] = formatCell(doc[col.Name])
+			}
+			if err := csvWriter.Write(row); err != nil {
+				return count, err
+			}
+		} else {
+			line, err := bson.MarshalExtJSON(cursor.Current, false, false)
+			if err != nil {
+				return count, err
+			}
+			if _, err := w.Write(append(line, '\n')); err != nil {
+				return count, err
+			}
+		}
+		count++
+	}
+
+	if csvWriter != nil {
+		csvWriter.Flush()
+		if err := csvWriter.Error(); err != nil {
+			return count, err
+		}
+	}
+
+	return count, cursor.Err()
+}
+
+// Import reads records from r, validates them and upserts the valid ones. Records with an _id
+// update the document with that ID; otherwise tracks are matched by content hash and likes by
+// user and track, so re-importing the same file does not create duplicates. Playlists have no
+// such key and must have an _id. Fields missing from a record keep their stored values. With dryRun set
+// nothing is written and the report shows what would happen.
+func (c *Catalog) Import(ctx context.Context, r io.Reader, collection, format string, dryRun bool) (*ImportReport, error) {
+	spec, err := lookup(collection, format)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ImportReport{Collection: collection, Format: format, DryRun: dryRun, Errors: []RecordError{}}
+	coll := c.DB.Collection(spec.Collection)
+
+	// Tracks created before content hashes existed need one to be matched
+	if collection == CollectionTracks && !dryRun {
+		report.Backfilled, err = c.BackfillContentHashes(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	fail := func(line int, message string) {
+		report.Failed++
+		if len(report.Errors) < maxReportedErrors {
+			report.Errors = append(report.Errors, RecordError{Line: line, Message: message})
+		}
+	}
+
+	next, err := recordReader(r, format, spec)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		line, doc, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var recErr *recordErr
+			if errors.As(err, &recErr) {
+				report.Processed++
+				fail(recErr.line, recErr.message)
+				continue
+			}
+			return report, err
+		}
+		report.Processed++
+
+		if err := spec.normalize(doc); err != nil {
+			fail(line, err.Error())
+			continue
+		}
+		if spec.prepare != nil {
+			spec.prepare(doc)
+		}
+		if errs := spec.validate(doc); len(errs) > 0 {
+			fail(line, errs.Error())
+			continue
+		}
+
+		inserted, err := c.upsert(ctx, coll, spec, doc, dryRun)
+		if err != nil {
+			fail(line, err.Error())
+			continue
+		}
+		if inserted {
+			report.Inserted++
+		} else {
+			report.Updated++
+		}
+	}
+
+	// Like counts on tracks are derived from the likes collection
+	if collection == CollectionLikes && !dryRun && report.Inserted+report.Updated > 0 {
+		if err := c.recountLikes(ctx); err != nil {
+			return report, err
+		}
+	}
+
+	return report, nil
+}
+
+// upsert writes one record and reports whether it created a new document
+func (c *Catalog) upsert(ctx context.Context, coll *mongo.Collection, spec *collectionSpec, doc bson.M, dryRun bool) (bool, error) {
+	filter := bson.M{}
+	if id, ok := objectIDOf(doc); ok {
+		filter["_id"] = id
+	} else if key := spec.matchKey; key != nil && key(doc) != nil {
+		filter = key(doc)
+
+		var existing bson.M
+		err := coll.FindOne(ctx, filter, options.FindOne().SetProjection(bson.M{"_id": 1})).Decode(&existing)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return false, err
+		}
+		if err == nil {
+			doc["_id"] = existing["_id"]
+			filter = bson.M{"_id": existing["_id"]}
+		}
+	}
+
+	fields := spec.persisted(doc)
+	defaults := spec.insertDefaults(doc)
+
+	if _, ok := doc["_id"]; !ok {
+		if !dryRun {
+			for name, value := range defaults {
+				fields[name] = value
+			}
+			if _, err := coll.InsertOne(ctx, fields); err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	}
+
+	if dryRun {
+		count, err := coll.CountDocuments(ctx, filter)
+		return count == 0, err
+	}
+
+	// Only the fields in the record are set, so a CSV row or an older export doesn't wipe
+	// collaborators, follower counts and the like from an existing document. Defaults only
+	// fill a document the upsert creates.
+	update := bson.M{}
+	if len(fields) > 0 {
+		update["$set"] = fields
+	}
+	if len(defaults) > 0 {
+		update["$setOnInsert"] = defaults
+	}
+	result, err := coll.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if err != nil {
+		return false, err
+	}
+	return result.UpsertedCount > 0, nil
+}
+
+// BackfillContentHashes computes content hashes for tracks stored without one
+func (c *Catalog) BackfillContentHashes(ctx context.Context) (int, error) {
+	coll := c.DB.Collection("tracks")
+
+	cursor, err := coll.Find(ctx,
+		bson.M{"content_hash": bson.M{"$exists": false}},
+		options.Find().SetProjection(bson.M{"title": 1, "artist": 1, "duration": 1}),
+	)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var models []mongo.WriteModel
+	for cursor.Next(ctx) {
+		var track music.Track
+		if err := cursor.Decode(&track); err != nil {
+			return 0, err
+		}
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": track.ID}).
+			SetUpdate(bson.M{"$set": bson.M{"content_hash": music.ContentHash(track.Title, track.Artist, track.Duration)}}))
+	}
+	if err := cursor.Err(); err != nil {
+		return 0, err
+	}
+	if len(models) == 0 {
+		return 0, nil
+	}
+
+	result, err := coll.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	if err != nil {
+		return 0, err
+	}
+	return int(result.ModifiedCount), nil
+}
+
+// recountLikes recomputes like_count on every track from the likes collection
+func (c *Catalog) recountLikes(ctx context.Context) error {
+	cursor, err := c.DB.Collection("likes").Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$group", Value: bson.M{"_id": "$track_id", "count": bson.M{"$sum": 1}}}},
+	})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	tracks := c.DB.Collection("tracks")
+	if _, err := tracks.UpdateMany(ctx, bson.M{}, bson.M{"$set": bson.M{"like_count": 0}}); err != nil {
+		return err
+	}
+
+	var models []mongo.WriteModel
+	for cursor.Next(ctx) {
+		var row struct {
+			ID    interface{} `bson:"_id"`
+			Count int         `bson:"count"`
+		}
+		if err := cursor.Decode(&row); err != nil {
+			return err
+		}
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": row.ID}).
+			SetUpdate(bson.M{"$set": bson.M{"like_count": row.Count}}))
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+	if len(models) == 0 {
+		return nil
+	}
+
+	_, err = tracks.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	return err
+}
+
+// recordErr is a malformed record; the import skips it and carries on
+type recordErr struct {
+	line    int
+	message string
+}
+
+func (e *recordErr) Error() string {
+	return fmt.Sprintf("line %d: %s", e.line, e.message)
+}
+
+// recordReader returns a function yielding one decoded record per call along with its line number
+func recordReader(r io.Reader, format string, spec *collectionSpec) (func() (int, bson.M, error), error) {
+	if format == FormatCSV {
+		reader := csv.NewReader(r)
+		reader.FieldsPerRecord = -1
+
+		header, err := reader.Read()
+		if err == io.EOF {
+			return func() (int, bson.M, error) { return 0, nil, io.EOF }, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV header: %v", err)
+		}
+
+		known := make(map[string]bool, len(spec.Columns))
+		for _, col := range spec.Columns {
+			known[col.Name] = true
+		}
+		for i, name := range header {
+			header[i] = strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))
+			if !known[header[i]] && header[i] != "id" {
+				return nil, fmt.Errorf("unknown CSV column %q", header[i])
+			}
+		}
+
+		return func() (int, bson.M, error) {
+			row, err := reader.Read()
+			if err == io.EOF {
+				return 0, nil, io.EOF
+			}
+			line, _ := reader.FieldPos(0)
+			if err != nil {
+				return line, nil, &recordErr{line: line, message: err.Error()}
+			}
+			if len(row) != len(header) {
+				return line, nil, &recordErr{line: line, message: fmt.Sprintf("expected %d columns, got %d", len(header), len(row))}
+			}
+
+			doc := bson.M{}
+			for i, value := range row {
+				if value != "" {
+					doc[header[i]] = value
+				}
+			}
+			return line, doc, nil
+		}, nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	line := 0
+
+	return func() (int, bson.M, error) {
+		for scanner.Scan() {
+			line++
+			text := strings.TrimSpace(scanner.Text())
+			if text == "" {
+				continue
+			}
+
+			var doc bson.M
+			if err := bson.UnmarshalExtJSON([]byte(text), false, &doc); err != nil {
+				return line, nil, &recordErr{line: line, message: "invalid JSON: " + err.Error()}
+			}
+			return line, doc, nil
+		}
+		if err := scanner.Err(); err != nil {
+			return line, nil, err
+		}
+		return line, nil, io.EOF
+	}, nil
+}
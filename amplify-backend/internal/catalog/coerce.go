@@ -0,0 +1,202 @@
+package catalog
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// normalize coerces the known columns of a decoded record to the types the models expect.
+// JSON Lines records may use "id" for _id (as the API does) and hex strings for ObjectIDs.
+func (s *collectionSpec) normalize(doc bson.M) error {
+	if id, ok := doc["id"]; ok {
+		if _, exists := doc["_id"]; !exists {
+			doc["_id"] = id
+		}
+		delete(doc, "id")
+	}
+
+	for _, col := range s.Columns {
+		value, ok := doc[col.Name]
+		if !ok {
+			continue
+		}
+		if value == nil {
+			delete(doc, col.Name)
+			continue
+		}
+
+		coerced, err := coerce(value, col.Kind)
+		if err != nil {
+			return fmt.Errorf("%s: %v", col.Name, err)
+		}
+		if coerced == nil {
+			delete(doc, col.Name)
+			continue
+		}
+		doc[col.Name] = coerced
+	}
+
+	return nil
+}
+
+// coerce converts a JSON or CSV value to the column kind. Empty strings become nil (field omitted).
+func coerce(value interface{}, kind columnKind) (interface{}, error) {
+	if s, ok := value.(string); ok && kind != kindString && strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+
+	switch kind {
+	case kindString:
+		if s, ok := value.(string); ok {
+			return s, nil
+		}
+		return nil, fmt.Errorf("must be a string")
+
+	case kindInt:
+		switch v := value.(type) {
+		case int32:
+			return int64(v), nil
+		case int64:
+			return v, nil
+		case float64:
+			if v != float64(int64(v)) {
+				return nil, fmt.Errorf("must be a whole number")
+			}
+			return int64(v), nil
+		case string:
+			n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("must be a whole number")
+			}
+			return n, nil
+		}
+		return nil, fmt.Errorf("must be a whole number")
+
+	case kindFloat:
+		switch v := value.(type) {
+		case int32:
+			return float64(v), nil
+		case int64:
+			return float64(v), nil
+		case float64:
+			return v, nil
+		case string:
+			f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err != nil {
+				return nil, fmt.Errorf("must be a number")
+			}
+			return f, nil
+		}
+		return nil, fmt.Errorf("must be a number")
+
+	case kindBool:
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case string:
+			b, err := strconv.ParseBool(strings.TrimSpace(v))
+			if err != nil {
+				return nil, fmt.Errorf("must be true or false")
+			}
+			return b, nil
+		}
+		return nil, fmt.Errorf("must be true or false")
+
+	case kindTime:
+		switch v := value.(type) {
+		case primitive.DateTime:
+			return v.Time(), nil
+		case time.Time:
+			return v, nil
+		case string:
+			t, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(v))
+			if err != nil {
+				return nil, fmt.Errorf("must be an RFC 3339 timestamp")
+			}
+			return t, nil
+		}
+		return nil, fmt.Errorf("must be an RFC 3339 timestamp")
+
+	case kindObjectID:
+		return toObjectID(value)
+
+	case kindObjectIDs:
+		var items []interface{}
+		switch v := value.(type) {
+		case bson.A:
+			items = v
+		case []interface{}:
+			items = v
+		case string:
+			for _, part := range strings.Split(v, ";") {
+				if part = strings.TrimSpace(part); part != "" {
+					items = append(items, part)
+				}
+			}
+		default:
+			return nil, fmt.Errorf("must be a list of IDs")
+		}
+
+		ids := make(bson.A, 0, len(items))
+		for _, item := range items {
+			id, err := toObjectID(item)
+			if err != nil {
+				return nil, err
+			}
+			ids = append(ids, id)
+		}
+		return ids, nil
+	}
+
+	return value, nil
+}
+
+func toObjectID(value interface{}) (primitive.ObjectID, error) {
+	switch v := value.(type) {
+	case primitive.ObjectID:
+		return v, nil
+	case string:
+		id, err := primitive.ObjectIDFromHex(strings.TrimSpace(v))
+		if err != nil {
+			return primitive.NilObjectID, fmt.Errorf("invalid ID %q", v)
+		}
+		return id, nil
+	}
+	return primitive.NilObjectID, fmt.Errorf("must be an ID string")
+}
+
+// formatCell renders a stored value for a CSV cell
+func formatCell(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case primitive.ObjectID:
+		return v.Hex()
+	case primitive.DateTime:
+		return v.Time().UTC().Format(time.RFC3339Nano)
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	case bool:
+		return strconv.FormatBool(v)
+	case int32:
+		return strconv.FormatInt(int64(v), 10)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bson.A:
+		parts := make([]string, len(v))
+		for i, item := range v {
+			parts[i] = formatCell(item)
+		}
+		return strings.Join(parts, ";")
+	}
+	return fmt.Sprint(value)
+}
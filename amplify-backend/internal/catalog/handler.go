@@ -0,0 +1,94 @@
+package catalog
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RegisterAdminRoutes registers catalog export and import on the /admin group
+func RegisterAdminRoutes(router fiber.Router, catalog *Catalog) {
+	// Stream a collection as JSON Lines or CSV
+	router.Get("/export/:collection", func(c *fiber.Ctx) error {
+		collection := c.Params("collection")
+		format := c.Query("format", FormatJSONL)
+		if err := Validate(collection, format); err != nil {
+			return errorResponse(c, err)
+		}
+
+		if format == FormatCSV {
+			c.Set("Content-Type", "text/csv; charset=utf-8")
+		} else {
+			c.Set("Content-Type", "application/x-ndjson")
+		}
+		filename := fmt.Sprintf("%s-%s.%s", collection, time.Now().UTC().Format("20060102-150405"), format)
+		c.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+
+		c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+			ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+			defer cancel()
+
+			count, err := catalog.Export(ctx, w, collection, format)
+			if err != nil {
+				log.Printf("Export of %s failed after %d records: %v", collection, count, err)
+			}
+			w.Flush()
+		})
+
+		return nil
+	})
+
+	// Import a collection from the request body or a multipart "file" field.
+	// ?dry_run=true validates and reports without writing.
+	router.Post("/import/:collection", func(c *fiber.Ctx) error {
+		collection := c.Params("collection")
+		format := c.Query("format", FormatJSONL)
+		if err := Validate(collection, format); err != nil {
+			return errorResponse(c, err)
+		}
+
+		var body io.Reader = bytes.NewReader(c.Body())
+		if fileHeader, err := c.FormFile("file"); err == nil {
+			file, err := fileHeader.Open()
+			if err != nil {
+				return c.Status(400).JSON(fiber.Map{"error": "Failed to read uploaded file"})
+			}
+			defer file.Close()
+			body = file
+		} else if len(c.Body()) == 0 {
+			return c.Status(400).JSON(fiber.Map{"error": "No data provided"})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+		defer cancel()
+
+		report, err := catalog.Import(ctx, body, collection, format, c.QueryBool("dry_run"))
+		if err != nil {
+			if report != nil {
+				return c.Status(500).JSON(fiber.Map{"error": "Import stopped: " + err.Error(), "report": report})
+			}
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		return c.JSON(report)
+	})
+}
+
+// errorResponse maps catalog errors to HTTP status codes
+func errorResponse(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, ErrUnknownCollection):
+		return c.Status(404).JSON(fiber.Map{"error": "Unknown collection", "collections": Collections()})
+	case errors.Is(err, ErrUnknownFormat):
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	default:
+		return c.Status(500).JSON(fiber.Map{"error": "Catalog operation failed"})
+	}
+}
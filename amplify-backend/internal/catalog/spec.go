@@ -0,0 +1,260 @@
+package catalog
+
+import (
+	"amplify-backend/internal/like"
+	"amplify-backend/internal/music"
+	"amplify-backend/internal/playlist"
+	"amplify-backend/internal/validation"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Supported collections. Individual plays are not recorded yet (only play_count on tracks),
+// so there is no "plays" collection to export.
+const (
+	CollectionTracks    = "tracks"
+	CollectionPlaylists = "playlists"
+	CollectionLikes     = "likes"
+)
+
+type columnKind int
+
+const (
+	kindString columnKind = iota
+	kindInt
+	kindFloat
+	kindBool
+	kindTime
+	kindObjectID
+	kindObjectIDs
+)
+
+// column describes a top-level field: its CSV header and how values are coerced on import
+type column struct {
+	Name string
+	Kind columnKind
+}
+
+// collectionSpec describes how a collection is exported, validated and matched on import
+type collectionSpec struct {
+	Collection string
+	Columns    []column
+	// Fields are other persisted fields, only carried by JSON Lines records: nested values and
+	// counters the services maintain. They are written as given when present.
+	Fields []string
+
+	// prepare fills derived fields (content hash) before validation; nil if there are none
+	prepare func(doc bson.M)
+	// defaults returns values for fields a new document needs; existing documents keep theirs
+	defaults func(doc bson.M) bson.M
+	// validate checks a record; typed decoding has already succeeded
+	validate func(doc bson.M) validation.Errors
+	// matchKey returns a natural-key filter used when a record has no _id (nil to always insert)
+	matchKey func(doc bson.M) bson.M
+}
+
+var specs = map[string]*collectionSpec{
+	CollectionTracks: {
+		Collection: "tracks",
+		Columns: []column{
+			{"_id", kindObjectID},
+			{"title", kindString},
+			{"artist", kindString},
+			{"album", kindString},
+			{"genre", kindString},
+			{"duration", kindInt},
+			{"year", kindInt},
+			{"file_path", kindString},
+			{"file_name", kindString},
+			{"file_size", kindInt},
+			{"mime_type", kindString},
+			{"album_art_url", kindString},
+			{"url", kindString},
+			{"content_hash", kindString},
+			{"play_count", kindInt},
+			{"like_count", kindInt},
+			{"average_rating", kindFloat},
+			{"rating_count", kindInt},
+			{"revision", kindInt},
+			{"created_at", kindTime},
+			{"updated_at", kindTime},
+			{"last_played", kindTime},
+			{"deleted_at", kindTime},
+		},
+		prepare: func(doc bson.M) {
+			// A partial record keeps the stored hash, which its missing fields went into
+			title, hasTitle := doc["title"].(string)
+			artist, hasArtist := doc["artist"].(string)
+			duration, hasDuration := doc["duration"].(int64)
+			if hasTitle && hasArtist && hasDuration {
+				doc["content_hash"] = music.ContentHash(title, artist, int(duration))
+			}
+		},
+		defaults: func(doc bson.M) bson.M {
+			return timestamps()
+		},
+		validate: func(doc bson.M) validation.Errors {
+			var track music.Track
+			if errs := decodeTyped(doc, &track); len(errs) > 0 {
+				return errs
+			}
+			update := music.TrackUpdate{
+				Title:       &track.Title,
+				Artist:      &track.Artist,
+				Album:       &track.Album,
+				Genre:       &track.Genre,
+				Duration:    &track.Duration,
+				AlbumArtURL: &track.AlbumArtURL,
+			}
+			if track.Year != 0 {
+				update.Year = &track.Year
+			}
+			return update.Validate()
+		},
+		matchKey: func(doc bson.M) bson.M {
+			if _, ok := doc["content_hash"]; !ok {
+				return nil
+			}
+			return bson.M{"content_hash": doc["content_hash"]}
+		},
+	},
+	CollectionPlaylists: {
+		Collection: "playlists",
+		Columns: []column{
+			{"_id", kindObjectID},
+			{"name", kindString},
+			{"description", kindString},
+			{"is_public", kindBool},
+			{"created_by", kindString},
+			{"cover_art", kindString},
+			{"track_ids", kindObjectIDs},
+			{"version", kindInt},
+			{"created_at", kindTime},
+			{"updated_at", kindTime},
+			{"deleted_at", kindTime},
+		},
+		Fields: []string{
+			"entries", "collaborators", "rules",
+			"cover_generated", "cover_path", "cover_source",
+			"follower_count", "fork_count", "forked_from",
+		},
+		defaults: func(doc bson.M) bson.M {
+			defaults := timestamps()
+			defaults["track_ids"] = bson.A{}
+			return defaults
+		},
+		validate: func(doc bson.M) validation.Errors {
+			// Playlists have no natural key, so a record without an ID can't be matched and
+			// re-importing it would create a duplicate
+			if _, ok := doc["_id"]; !ok {
+				var errs validation.Errors
+				errs.Add("_id", validation.CodeRequired, "is required")
+				return errs
+			}
+			var p playlist.Playlist
+			if errs := decodeTyped(doc, &p); len(errs) > 0 {
+				return errs
+			}
+			update := playlist.PlaylistUpdate{
+				Name:        &p.Name,
+				Description: &p.Description,
+				CoverArt:    &p.CoverArt,
+			}
+			return update.Validate()
+		},
+	},
+	CollectionLikes: {
+		Collection: "likes",
+		Columns: []column{
+			{"_id", kindObjectID},
+			{"user_id", kindString},
+			{"track_id", kindObjectID},
+			{"created_at", kindTime},
+		},
+		defaults: func(doc bson.M) bson.M {
+			return bson.M{"created_at": time.Now()}
+		},
+		validate: func(doc bson.M) validation.Errors {
+			var l like.Like
+			if errs := decodeTyped(doc, &l); len(errs) > 0 {
+				return errs
+			}
+			var errs validation.Errors
+			if strings.TrimSpace(l.UserID) == "" {
+				errs.Add("user_id", validation.CodeRequired, "is required")
+			}
+			if l.TrackID.IsZero() {
+				errs.Add("track_id", validation.CodeRequired, "is required")
+			}
+			return errs
+		},
+		matchKey: func(doc bson.M) bson.M {
+			return bson.M{"user_id": doc["user_id"], "track_id": doc["track_id"]}
+		},
+	},
+}
+
+// persisted returns the record's columns and fields, without _id. Anything else in a JSON
+// Lines record is ignored.
+func (s *collectionSpec) persisted(doc bson.M) bson.M {
+	fields := bson.M{}
+	for _, col := range s.Columns {
+		if value, ok := doc[col.Name]; ok && col.Name != "_id" {
+			fields[col.Name] = value
+		}
+	}
+	for _, name := range s.Fields {
+		if value, ok := doc[name]; ok {
+			fields[name] = value
+		}
+	}
+	return fields
+}
+
+// Collections lists the collections that can be exported and imported
+func Collections() []string {
+	return []string{CollectionTracks, CollectionPlaylists, CollectionLikes}
+}
+
+func timestamps() bson.M {
+	now := time.Now()
+	return bson.M{"created_at": now, "updated_at": now}
+}
+
+// insertDefaults returns the spec's defaults for the fields missing from a record
+func (s *collectionSpec) insertDefaults(doc bson.M) bson.M {
+	defaults := bson.M{}
+	if s.defaults == nil {
+		return defaults
+	}
+	for name, value := range s.defaults(doc) {
+		if _, ok := doc[name]; !ok {
+			defaults[name] = value
+		}
+	}
+	return defaults
+}
+
+// decodeTyped round-trips the record through BSON into the model to catch wrongly typed fields
+func decodeTyped(doc bson.M, dst interface{}) validation.Errors {
+	var errs validation.Errors
+
+	data, err := bson.Marshal(doc)
+	if err == nil {
+		err = bson.Unmarshal(data, dst)
+	}
+	if err != nil {
+		errs.Add("", validation.CodeInvalidType, err.Error())
+	}
+
+	return errs
+}
+
+// objectIDOf returns the record's _id if it has a valid one
+func objectIDOf(doc bson.M) (primitive.ObjectID, bool) {
+	id, ok := doc["_id"].(primitive.ObjectID)
+	return id, ok && !id.IsZero()
+}
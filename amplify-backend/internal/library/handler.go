@@ -0,0 +1,247 @@
+package library
+
+import (
+	"amplify-backend/internal/middleware"
+	"errors"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RegisterRoutes registers library routes on the authenticated /me group.
+// Every change accepts the "version" last seen and returns the updated tree.
+func RegisterRoutes(router fiber.Router, service *LibraryService) {
+	// The library tree: pinned items, nested folders and playlists
+	router.Get("/library", func(c *fiber.Ctx) error {
+		userID, err := middleware.GetUserID(c)
+		if err != nil {
+			return c.Status(401).JSON(fiber.Map{
+				"error": "Unauthorized",
+			})
+		}
+
+		tree, err := service.GetTree(userID)
+		if err != nil {
+			return errorResponse(c, err, "Failed to get library")
+		}
+
+		return c.JSON(tree)
+	})
+
+	// Create a folder: {"name", "parent_id", "position", "version"}
+	router.Post("/library/folders", func(c *fiber.Ctx) error {
+		userID, err := middleware.GetUserID(c)
+		if err != nil {
+			return c.Status(401).JSON(fiber.Map{
+				"error": "Unauthorized",
+			})
+		}
+
+		var body struct {
+			Name     string `json:"name"`
+			ParentID string `json:"parent_id"`
+			Position *int   `json:"position"`
+			Version  *int   `json:"version"`
+		}
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid request",
+			})
+		}
+
+		folder, lib, err := service.CreateFolder(userID, body.Name, body.ParentID, body.Position, body.Version)
+		if err != nil {
+			return errorResponse(c, err, "Failed to create folder")
+		}
+
+		tree, err := service.BuildTree(lib)
+		if err != nil {
+			return errorResponse(c, err, "Failed to get library")
+		}
+
+		return c.Status(201).JSON(fiber.Map{
+			"folder":  folder,
+			"library": tree,
+		})
+	})
+
+	// Rename or move a folder: {"name", "parent_id" ("" for the top level), "position", "version"}
+	router.Patch("/library/folders/:id", func(c *fiber.Ctx) error {
+		userID, err := middleware.GetUserID(c)
+		if err != nil {
+			return c.Status(401).JSON(fiber.Map{
+				"error": "Unauthorized",
+			})
+		}
+
+		var update FolderUpdate
+		if err := c.BodyParser(&update); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid request",
+			})
+		}
+
+		lib, err := service.UpdateFolder(userID, c.Params("id"), update)
+		if err != nil {
+			return errorResponse(c, err, "Failed to update folder")
+		}
+
+		return treeResponse(c, service, lib)
+	})
+
+	// Delete a folder and its subfolders. ?keep_playlists=true moves their playlists to the
+	// parent instead of deleting owned ones and unfollowing followed ones. Optionally ?version=n
+	router.Delete("/library/folders/:id", func(c *fiber.Ctx) error {
+		userID, err := middleware.GetUserID(c)
+		if err != nil {
+			return c.Status(401).JSON(fiber.Map{
+				"error": "Unauthorized",
+			})
+		}
+
+		version, err := queryVersion(c)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "version must be a number",
+			})
+		}
+
+		result, err := service.DeleteFolder(userID, c.Params("id"), c.QueryBool("keep_playlists"), version)
+		if err != nil {
+			return errorResponse(c, err, "Failed to delete folder")
+		}
+
+		tree, err := service.BuildTree(result.Library)
+		if err != nil {
+			return errorResponse(c, err, "Failed to get library")
+		}
+
+		return c.JSON(fiber.Map{
+			"result":  result,
+			"library": tree,
+		})
+	})
+
+	// Move a playlist into a folder or to the top level: {"folder_id", "position", "version"}
+	router.Put("/library/playlists/:id", func(c *fiber.Ctx) error {
+		userID, err := middleware.GetUserID(c)
+		if err != nil {
+			return c.Status(401).JSON(fiber.Map{
+				"error": "Unauthorized",
+			})
+		}
+
+		var body struct {
+			FolderID string `json:"folder_id"`
+			Position *int   `json:"position"`
+			Version  *int   `json:"version"`
+		}
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid request",
+			})
+		}
+
+		lib, err := service.MovePlaylist(userID, c.Params("id"), body.FolderID, body.Position, body.Version)
+		if err != nil {
+			return errorResponse(c, err, "Failed to move playlist")
+		}
+
+		return treeResponse(c, service, lib)
+	})
+
+	// Pin a playlist or folder: {"type": "playlist"|"folder", "id", "position", "version"}
+	router.Put("/library/pins", func(c *fiber.Ctx) error {
+		userID, err := middleware.GetUserID(c)
+		if err != nil {
+			return c.Status(401).JSON(fiber.Map{
+				"error": "Unauthorized",
+			})
+		}
+
+		var body struct {
+			Type     string `json:"type"`
+			ID       string `json:"id"`
+			Position *int   `json:"position"`
+			Version  *int   `json:"version"`
+		}
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid request",
+			})
+		}
+
+		lib, err := service.Pin(userID, body.Type, body.ID, body.Position, body.Version)
+		if err != nil {
+			return errorResponse(c, err, "Failed to pin")
+		}
+
+		return treeResponse(c, service, lib)
+	})
+
+	// Unpin a playlist or folder, optionally ?version=n
+	router.Delete("/library/pins/:type/:id", func(c *fiber.Ctx) error {
+		userID, err := middleware.GetUserID(c)
+		if err != nil {
+			return c.Status(401).JSON(fiber.Map{
+				"error": "Unauthorized",
+			})
+		}
+
+		version, err := queryVersion(c)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "version must be a number",
+			})
+		}
+
+		lib, err := service.Unpin(userID, c.Params("type"), c.Params("id"), version)
+		if err != nil {
+			return errorResponse(c, err, "Failed to unpin")
+		}
+
+		return treeResponse(c, service, lib)
+	})
+}
+
+// treeResponse resolves and returns the library after a change
+func treeResponse(c *fiber.Ctx, service *LibraryService, lib *Library) error {
+	tree, err := service.BuildTree(lib)
+	if err != nil {
+		return errorResponse(c, err, "Failed to get library")
+	}
+
+	return c.JSON(tree)
+}
+
+// errorResponse maps library errors to HTTP status codes
+func errorResponse(c *fiber.Ctx, err error, fallback string) error {
+	switch {
+	case errors.Is(err, ErrVersionConflict):
+		return c.Status(409).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, ErrFolderNotFound), errors.Is(err, ErrPlaylistNotFound):
+		return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, ErrFolderCycle), errors.Is(err, ErrTooManyFolders), errors.Is(err, ErrFolderTooDeep),
+		errors.Is(err, ErrInvalidFolderName), errors.Is(err, ErrInvalidPosition), errors.Is(err, ErrInvalidPin),
+		errors.Is(err, ErrTooManyPins):
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, primitive.ErrInvalidHex):
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid ID"})
+	default:
+		return c.Status(500).JSON(fiber.Map{"error": fallback})
+	}
+}
+
+// queryVersion reads the optional ?version= expected library version
+func queryVersion(c *fiber.Ctx) (*int, error) {
+	raw := c.Query("version")
+	if raw == "" {
+		return nil, nil
+	}
+	version, err := strconv.Atoi(raw)
+	if err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
@@ -0,0 +1,79 @@
+package library
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Library is how one user organizes the playlists they own, collaborate on or follow.
+// The whole tree lives in a single document so every move is one atomic write.
+type Library struct {
+	ID        primitive.ObjectID   `bson:"_id,omitempty" json:"-"`
+	UserID    string               `bson:"user_id" json:"user_id"`
+	Folders   []Folder             `bson:"folders" json:"folders"` // Siblings are ordered by their position in this list
+	Root      []primitive.ObjectID `bson:"root" json:"root"`       // Ordered playlists at the top level
+	Pinned    []Pin                `bson:"pinned" json:"pinned"`   // Shown above the tree, in this order
+	Version   int                  `bson:"version" json:"version"` // Bumped on every change, for optimistic concurrency
+	UpdatedAt time.Time            `bson:"updated_at" json:"updated_at"`
+}
+
+// Folder groups playlists and other folders
+type Folder struct {
+	ID          string               `bson:"id" json:"id"`
+	Name        string               `bson:"name" json:"name"`
+	ParentID    string               `bson:"parent_id,omitempty" json:"parent_id,omitempty"` // Empty for top-level folders
+	PlaylistIDs []primitive.ObjectID `bson:"playlist_ids" json:"playlist_ids"`               // In display order
+	CreatedAt   time.Time            `bson:"created_at" json:"created_at"`
+}
+
+// Pin types
+const (
+	PinPlaylist = "playlist"
+	PinFolder   = "folder"
+)
+
+// Pin is a playlist or folder pinned to the top of the library
+type Pin struct {
+	Type string `bson:"type" json:"type"`
+	ID   string `bson:"id" json:"id"`
+}
+
+// PlaylistSummary is how a playlist appears in the library tree
+type PlaylistSummary struct {
+	ID         primitive.ObjectID `json:"id"`
+	Name       string             `json:"name"`
+	CoverArt   string             `json:"cover_art,omitempty"`
+	IsPublic   bool               `json:"is_public"`
+	CreatedBy  string             `json:"created_by,omitempty"`
+	Role       string             `json:"role"` // owner, editor, viewer or follower
+	TrackCount int                `json:"track_count"`
+	Smart      bool               `json:"smart,omitempty"`
+	Pinned     bool               `json:"pinned,omitempty"`
+	UpdatedAt  time.Time          `json:"updated_at"`
+}
+
+// FolderNode is a folder in the library tree with its contents resolved
+type FolderNode struct {
+	ID        string            `json:"id"`
+	Name      string            `json:"name"`
+	Pinned    bool              `json:"pinned,omitempty"`
+	Folders   []FolderNode      `json:"folders"`
+	Playlists []PlaylistSummary `json:"playlists"`
+}
+
+// PinnedNode is a pinned item with its playlist or folder resolved
+type PinnedNode struct {
+	Type     string           `json:"type"`
+	Playlist *PlaylistSummary `json:"playlist,omitempty"`
+	Folder   *FolderNode      `json:"folder,omitempty"`
+}
+
+// Tree is the library as returned by GET /me/library. Playlists not placed in a folder are
+// at the top level, after the ones the user ordered explicitly.
+type Tree struct {
+	Pinned    []PinnedNode      `json:"pinned"`
+	Folders   []FolderNode      `json:"folders"`
+	Playlists []PlaylistSummary `json:"playlists"`
+	Version   int               `json:"version"`
+}
@@ -0,0 +1,770 @@
+package library
+
+import (
+	"amplify-backend/internal/playlist"
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Limits on library size
+const (
+	MaxFolders          = 500
+	MaxFolderDepth      = 10
+	MaxFolderNameLength = 100
+	MaxPins             = 50
+)
+
+// conflictRetries is how often an edit without an expected version is retried after losing a race
+const conflictRetries = 3
+
+// RoleFollower is the library role of a playlist the user follows but is not a member of
+const RoleFollower = "follower"
+
+var (
+	ErrVersionConflict   = errors.New("library was modified concurrently, reload and try again")
+	ErrFolderNotFound    = errors.New("folder not found")
+	ErrPlaylistNotFound  = errors.New("playlist is not in your library")
+	ErrFolderCycle       = errors.New("a folder cannot be moved into itself or one of its subfolders")
+	ErrTooManyFolders    = errors.New("library has too many folders")
+	ErrFolderTooDeep     = errors.New("folders are nested too deeply")
+	ErrInvalidFolderName = errors.New("folder name must be 1 to 100 characters")
+	ErrInvalidPosition   = errors.New("position is out of range")
+	ErrInvalidPin        = errors.New("pin type must be playlist or folder")
+	ErrTooManyPins       = errors.New("too many pinned items")
+)
+
+type LibraryService struct {
+	LibraryCollection *mongo.Collection
+	Playlists         *playlist.PlaylistService
+}
+
+func NewLibraryService(db *mongo.Database, playlists *playlist.PlaylistService) *LibraryService {
+	return &LibraryService{
+		LibraryCollection: db.Collection("libraries"),
+		Playlists:         playlists,
+	}
+}
+
+// EnsureIndexes creates the unique user_id index (one library document per user)
+func (s *LibraryService) EnsureIndexes() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := s.LibraryCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+// GetLibrary returns the user's stored library, or an empty one if they never organized it
+func (s *LibraryService) GetLibrary(userID string) (*Library, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var lib Library
+	err := s.LibraryCollection.FindOne(ctx, bson.M{"user_id": userID}).Decode(&lib)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return &Library{UserID: userID, Folders: []Folder{}, Root: []primitive.ObjectID{}, Pinned: []Pin{}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if lib.Folders == nil {
+		lib.Folders = []Folder{}
+	}
+	if lib.Root == nil {
+		lib.Root = []primitive.ObjectID{}
+	}
+	if lib.Pinned == nil {
+		lib.Pinned = []Pin{}
+	}
+
+	return &lib, nil
+}
+
+// mutate applies fn to the user's library and writes it back, guarded by the library version.
+// With an expected version the edit fails on any mismatch; without one it is retried against
+// the latest state. The first write creates the document.
+func (s *LibraryService) mutate(userID string, expectedVersion *int, fn func(lib *Library) error) (*Library, error) {
+	attempts := conflictRetries
+	if expectedVersion != nil {
+		attempts = 1
+	}
+
+	for attempt := 0; attempt < attempts; attempt++ {
+		lib, err := s.GetLibrary(userID)
+		if err != nil {
+			return nil, err
+		}
+		if expectedVersion != nil && *expectedVersion != lib.Version {
+			return nil, ErrVersionConflict
+		}
+
+		if err := fn(lib); err != nil {
+			return nil, err
+		}
+
+		filter := bson.M{"user_id": userID, "version": lib.Version}
+		if lib.Version == 0 {
+			filter["version"] = bson.M{"$in": bson.A{0, nil}}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		now := time.Now()
+		res, err := s.LibraryCollection.UpdateOne(
+			ctx,
+			filter,
+			bson.M{"$set": bson.M{
+				"folders":    lib.Folders,
+				"root":       lib.Root,
+				"pinned":     lib.Pinned,
+				"version":    lib.Version + 1,
+				"updated_at": now,
+			}},
+			// Only the first write may create the document; later ones must match the version
+			options.Update().SetUpsert(lib.Version == 0),
+		)
+		cancel()
+		if mongo.IsDuplicateKeyError(err) {
+			// Someone else created or changed the library since it was read
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if res.MatchedCount == 0 && res.UpsertedCount == 0 {
+			continue
+		}
+
+		lib.Version++
+		lib.UpdatedAt = now
+		return lib, nil
+	}
+
+	return nil, ErrVersionConflict
+}
+
+// libraryPlaylists returns every playlist the user owns, collaborates on or follows, with their role
+func (s *LibraryService) libraryPlaylists(userID string) ([]PlaylistSummary, error) {
+	own, err := s.Playlists.GetUserPlaylists(userID)
+	if err != nil {
+		return nil, err
+	}
+	followed, err := s.Playlists.GetFollowedPlaylists(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]PlaylistSummary, 0, len(own)+len(followed))
+	seen := make(map[primitive.ObjectID]bool, len(own)+len(followed))
+	for i := range own {
+		seen[own[i].ID] = true
+		summaries = append(summaries, summarize(&own[i], own[i].RoleOf(userID)))
+	}
+	for i := range followed {
+		if !seen[followed[i].ID] {
+			seen[followed[i].ID] = true
+			summaries = append(summaries, summarize(&followed[i].Playlist, RoleFollower))
+		}
+	}
+
+	return summaries, nil
+}
+
+func summarize(p *playlist.Playlist, role string) PlaylistSummary {
+	return PlaylistSummary{
+		ID:         p.ID,
+		Name:       p.Name,
+		CoverArt:   p.CoverArt,
+		IsPublic:   p.IsPublic,
+		CreatedBy:  p.CreatedBy,
+		Role:       role,
+		TrackCount: len(p.TrackIDs),
+		Smart:      p.Rules != nil,
+		UpdatedAt:  p.UpdatedAt,
+	}
+}
+
+func validFolderName(name string) bool {
+	return name != "" && len(name) <= MaxFolderNameLength
+}
+
+func indexOfFolder(folders []Folder, id string) int {
+	for i, folder := range folders {
+		if folder.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// depthOf returns how many folders deep a folder is, 1 for a top-level folder
+func depthOf(folders []Folder, id string) int {
+	depth := 0
+	for id != "" && depth <= len(folders) {
+		i := indexOfFolder(folders, id)
+		if i < 0 {
+			break
+		}
+		depth++
+		id = folders[i].ParentID
+	}
+	return depth
+}
+
+// descendantsOf returns the IDs of a folder and every folder below it
+func descendantsOf(folders []Folder, id string) map[string]bool {
+	found := map[string]bool{id: true}
+	for changed := true; changed; {
+		changed = false
+		for _, folder := range folders {
+			if !found[folder.ID] && found[folder.ParentID] {
+				found[folder.ID] = true
+				changed = true
+			}
+		}
+	}
+	return found
+}
+
+// heightOf returns how many levels a folder's subtree spans, 1 for a folder without subfolders
+func heightOf(folders []Folder, id string) int {
+	height := 1
+	for _, folder := range folders {
+		if folder.ParentID == id {
+			if h := heightOf(folders, folder.ID) + 1; h > height {
+				height = h
+			}
+		}
+	}
+	return height
+}
+
+// placeFolder inserts a folder among its siblings at position (nil appends). The folder must
+// not be in the list.
+func placeFolder(folders []Folder, folder Folder, position *int) ([]Folder, error) {
+	var siblings []int
+	for i, other := range folders {
+		if other.ParentID == folder.ParentID {
+			siblings = append(siblings, i)
+		}
+	}
+
+	at := len(folders)
+	switch {
+	case position == nil || *position == len(siblings):
+		if len(siblings) > 0 {
+			at = siblings[len(siblings)-1] + 1
+		}
+	case *position < 0 || *position > len(siblings):
+		return nil, ErrInvalidPosition
+	default:
+		at = siblings[*position]
+	}
+
+	folders = append(folders, Folder{})
+	copy(folders[at+1:], folders[at:])
+	folders[at] = folder
+	return folders, nil
+}
+
+// insertAt inserts an ID at position (nil appends)
+func insertAt(ids []primitive.ObjectID, id primitive.ObjectID, position *int) ([]primitive.ObjectID, error) {
+	at := len(ids)
+	if position != nil {
+		if *position < 0 || *position > len(ids) {
+			return nil, ErrInvalidPosition
+		}
+		at = *position
+	}
+
+	ids = append(ids, primitive.NilObjectID)
+	copy(ids[at+1:], ids[at:])
+	ids[at] = id
+	return ids, nil
+}
+
+func removeID(ids []primitive.ObjectID, id primitive.ObjectID) []primitive.ObjectID {
+	kept := ids[:0]
+	for _, other := range ids {
+		if other != id {
+			kept = append(kept, other)
+		}
+	}
+	return kept
+}
+
+// unplace removes a playlist from the top level and from every folder
+func unplace(lib *Library, id primitive.ObjectID) {
+	lib.Root = removeID(lib.Root, id)
+	for i := range lib.Folders {
+		lib.Folders[i].PlaylistIDs = removeID(lib.Folders[i].PlaylistIDs, id)
+	}
+}
+
+func removePins(pins []Pin, match func(Pin) bool) []Pin {
+	kept := pins[:0]
+	for _, pin := range pins {
+		if !match(pin) {
+			kept = append(kept, pin)
+		}
+	}
+	return kept
+}
+
+// CreateFolder adds a folder under parentID (empty for the top level) at position among its siblings (nil appends)
+func (s *LibraryService) CreateFolder(userID, name, parentID string, position *int, expectedVersion *int) (*Folder, *Library, error) {
+	name = strings.TrimSpace(name)
+	if !validFolderName(name) {
+		return nil, nil, ErrInvalidFolderName
+	}
+
+	folder := Folder{
+		ID:          primitive.NewObjectID().Hex(),
+		Name:        name,
+		ParentID:    parentID,
+		PlaylistIDs: []primitive.ObjectID{},
+		CreatedAt:   time.Now(),
+	}
+
+	lib, err := s.mutate(userID, expectedVersion, func(lib *Library) error {
+		if len(lib.Folders) >= MaxFolders {
+			return ErrTooManyFolders
+		}
+		if parentID != "" {
+			if indexOfFolder(lib.Folders, parentID) < 0 {
+				return ErrFolderNotFound
+			}
+			if depthOf(lib.Folders, parentID)+1 > MaxFolderDepth {
+				return ErrFolderTooDeep
+			}
+		}
+
+		folders, err := placeFolder(lib.Folders, folder, position)
+		if err != nil {
+			return err
+		}
+		lib.Folders = folders
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &folder, lib, nil
+}
+
+// FolderUpdate changes a folder. Nil fields are left unchanged; an empty ParentID moves the
+// folder to the top level. Position orders the folder among its (new) siblings.
+type FolderUpdate struct {
+	Name     *string `json:"name"`
+	ParentID *string `json:"parent_id"`
+	Position *int    `json:"position"`
+	Version  *int    `json:"version"`
+}
+
+// UpdateFolder renames a folder or moves it to another parent or position, with its contents
+func (s *LibraryService) UpdateFolder(userID, folderID string, update FolderUpdate) (*Library, error) {
+	if update.Name != nil {
+		name := strings.TrimSpace(*update.Name)
+		if !validFolderName(name) {
+			return nil, ErrInvalidFolderName
+		}
+		update.Name = &name
+	}
+
+	return s.mutate(userID, update.Version, func(lib *Library) error {
+		i := indexOfFolder(lib.Folders, folderID)
+		if i < 0 {
+			return ErrFolderNotFound
+		}
+		folder := lib.Folders[i]
+
+		if update.Name != nil {
+			folder.Name = *update.Name
+		}
+
+		moved := false
+		if update.ParentID != nil && *update.ParentID != folder.ParentID {
+			parentID := *update.ParentID
+			if parentID != "" {
+				if indexOfFolder(lib.Folders, parentID) < 0 {
+					return ErrFolderNotFound
+				}
+				if descendantsOf(lib.Folders, folderID)[parentID] {
+					return ErrFolderCycle
+				}
+				if depthOf(lib.Folders, parentID)+heightOf(lib.Folders, folderID) > MaxFolderDepth {
+					return ErrFolderTooDeep
+				}
+			}
+			folder.ParentID = parentID
+			moved = true
+		}
+
+		// Sending the current parent alone keeps the folder where it is
+		if !moved && update.Position == nil {
+			lib.Folders[i] = folder
+			return nil
+		}
+
+		folders := append(lib.Folders[:i:i], lib.Folders[i+1:]...)
+		folders, err := placeFolder(folders, folder, update.Position)
+		if err != nil {
+			return err
+		}
+		lib.Folders = folders
+		return nil
+	})
+}
+
+// DeleteFolderResult reports what a folder delete did
+type DeleteFolderResult struct {
+	Library             *Library `json:"-"`
+	DeletedFolders      int      `json:"deleted_folders"`
+	MovedPlaylists      int      `json:"moved_playlists"`      // Kept and moved to the parent
+	DeletedPlaylists    int      `json:"deleted_playlists"`    // Owned playlists moved to the trash
+	UnfollowedPlaylists int      `json:"unfollowed_playlists"` // Followed playlists no longer followed
+	Errors              []string `json:"errors,omitempty"`
+}
+
+// DeleteFolder removes a folder and all of its subfolders. With keepPlaylists their playlists
+// move to the deleted folder's parent; otherwise playlists the user owns go to the trash, followed
+// ones are unfollowed and shared ones fall back to the top level.
+func (s *LibraryService) DeleteFolder(userID, folderID string, keepPlaylists bool, expectedVersion *int) (*DeleteFolderResult, error) {
+	result := &DeleteFolderResult{}
+	var removedPlaylists []primitive.ObjectID
+
+	lib, err := s.mutate(userID, expectedVersion, func(lib *Library) error {
+		i := indexOfFolder(lib.Folders, folderID)
+		if i < 0 {
+			return ErrFolderNotFound
+		}
+		parentID := lib.Folders[i].ParentID
+		removed := descendantsOf(lib.Folders, folderID)
+
+		// Contents in tree order, so kept playlists stay in a sensible order
+		var contents []primitive.ObjectID
+		var collect func(id string)
+		collect = func(id string) {
+			contents = append(contents, lib.Folders[indexOfFolder(lib.Folders, id)].PlaylistIDs...)
+			for _, folder := range lib.Folders {
+				if folder.ParentID == id {
+					collect(folder.ID)
+				}
+			}
+		}
+		collect(folderID)
+
+		kept := make([]Folder, 0, len(lib.Folders))
+		for _, folder := range lib.Folders {
+			if !removed[folder.ID] {
+				kept = append(kept, folder)
+			}
+		}
+		lib.Folders = kept
+		lib.Pinned = removePins(lib.Pinned, func(pin Pin) bool {
+			return pin.Type == PinFolder && removed[pin.ID]
+		})
+
+		result.DeletedFolders = len(removed)
+		result.MovedPlaylists = 0
+		removedPlaylists = nil
+
+		if !keepPlaylists {
+			gone := make(map[string]bool, len(contents))
+			for _, id := range contents {
+				gone[id.Hex()] = true
+			}
+			lib.Pinned = removePins(lib.Pinned, func(pin Pin) bool {
+				return pin.Type == PinPlaylist && gone[pin.ID]
+			})
+			removedPlaylists = contents
+			return nil
+		}
+
+		target := &lib.Root
+		if parentID != "" {
+			target = &lib.Folders[indexOfFolder(lib.Folders, parentID)].PlaylistIDs
+		}
+		present := make(map[primitive.ObjectID]bool, len(*target))
+		for _, id := range *target {
+			present[id] = true
+		}
+		for _, id := range contents {
+			if !present[id] {
+				present[id] = true
+				*target = append(*target, id)
+				result.MovedPlaylists++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	result.Library = lib
+
+	if len(removedPlaylists) > 0 {
+		summaries, err := s.libraryPlaylists(userID)
+		if err != nil {
+			return nil, err
+		}
+		roles := make(map[primitive.ObjectID]string, len(summaries))
+		for _, summary := range summaries {
+			roles[summary.ID] = summary.Role
+		}
+
+		// The folder is already gone; failures here leave the playlist at the top level
+		for _, id := range removedPlaylists {
+			switch roles[id] {
+			case playlist.RoleOwner:
+				err = s.Playlists.DeletePlaylist(id.Hex(), userID)
+				if err == nil {
+					result.DeletedPlaylists++
+				}
+			case RoleFollower:
+				err = s.Playlists.UnfollowPlaylist(id.Hex(), userID)
+				if err == nil {
+					result.UnfollowedPlaylists++
+				}
+			default:
+				err = nil
+			}
+			if err != nil {
+				log.Printf("Failed to remove playlist %s with folder %s: %v", id.Hex(), folderID, err)
+				result.Errors = append(result.Errors, "playlist "+id.Hex()+": "+err.Error())
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// MovePlaylist places a playlist from the user's library in a folder (empty for the top level)
+// at position (nil appends). The playlist leaves wherever it was in the same write.
+func (s *LibraryService) MovePlaylist(userID, playlistID, folderID string, position *int, expectedVersion *int) (*Library, error) {
+	objectID, err := primitive.ObjectIDFromHex(playlistID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkInLibrary(userID, objectID); err != nil {
+		return nil, err
+	}
+
+	return s.mutate(userID, expectedVersion, func(lib *Library) error {
+		unplace(lib, objectID)
+
+		if folderID == "" {
+			root, err := insertAt(lib.Root, objectID, position)
+			if err != nil {
+				return err
+			}
+			lib.Root = root
+			return nil
+		}
+
+		i := indexOfFolder(lib.Folders, folderID)
+		if i < 0 {
+			return ErrFolderNotFound
+		}
+		ids, err := insertAt(lib.Folders[i].PlaylistIDs, objectID, position)
+		if err != nil {
+			return err
+		}
+		lib.Folders[i].PlaylistIDs = ids
+		return nil
+	})
+}
+
+// checkInLibrary verifies the user owns, collaborates on or follows the playlist
+func (s *LibraryService) checkInLibrary(userID string, playlistID primitive.ObjectID) error {
+	summaries, err := s.libraryPlaylists(userID)
+	if err != nil {
+		return err
+	}
+	for _, summary := range summaries {
+		if summary.ID == playlistID {
+			return nil
+		}
+	}
+	return ErrPlaylistNotFound
+}
+
+// Pin pins a playlist or folder at position among the pins (nil appends). Pinning a pinned item moves it.
+func (s *LibraryService) Pin(userID, pinType, id string, position *int, expectedVersion *int) (*Library, error) {
+	switch pinType {
+	case PinPlaylist:
+		objectID, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.checkInLibrary(userID, objectID); err != nil {
+			return nil, err
+		}
+		// Stored as the tree renders playlist IDs, so the pin matches regardless of case
+		id = objectID.Hex()
+	case PinFolder:
+	default:
+		return nil, ErrInvalidPin
+	}
+
+	pin := Pin{Type: pinType, ID: id}
+	return s.mutate(userID, expectedVersion, func(lib *Library) error {
+		if pinType == PinFolder && indexOfFolder(lib.Folders, id) < 0 {
+			return ErrFolderNotFound
+		}
+
+		lib.Pinned = removePins(lib.Pinned, func(other Pin) bool { return other == pin })
+		if len(lib.Pinned) >= MaxPins {
+			return ErrTooManyPins
+		}
+
+		at := len(lib.Pinned)
+		if position != nil {
+			if *position < 0 || *position > len(lib.Pinned) {
+				return ErrInvalidPosition
+			}
+			at = *position
+		}
+		lib.Pinned = append(lib.Pinned, Pin{})
+		copy(lib.Pinned[at+1:], lib.Pinned[at:])
+		lib.Pinned[at] = pin
+		return nil
+	})
+}
+
+// Unpin removes a pin. Unpinning an item that is not pinned is a no-op.
+func (s *LibraryService) Unpin(userID, pinType, id string, expectedVersion *int) (*Library, error) {
+	if pinType != PinPlaylist && pinType != PinFolder {
+		return nil, ErrInvalidPin
+	}
+
+	return s.mutate(userID, expectedVersion, func(lib *Library) error {
+		lib.Pinned = removePins(lib.Pinned, func(other Pin) bool {
+			if other.Type != pinType {
+				return false
+			}
+			// Playlist IDs are hex, in any case
+			return other.ID == id || (pinType == PinPlaylist && strings.EqualFold(other.ID, id))
+		})
+		return nil
+	})
+}
+
+// GetTree returns the user's library with folders and playlists resolved
+func (s *LibraryService) GetTree(userID string) (*Tree, error) {
+	lib, err := s.GetLibrary(userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.BuildTree(lib)
+}
+
+// BuildTree resolves a library against the playlists the user can currently see. Playlists
+// that left the library (deleted, unfollowed, unshared) are skipped; playlists never placed
+// anywhere are listed at the top level, most recently updated first.
+func (s *LibraryService) BuildTree(lib *Library) (*Tree, error) {
+	summaries, err := s.libraryPlaylists(lib.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	pinned := make(map[Pin]bool, len(lib.Pinned))
+	for _, pin := range lib.Pinned {
+		pinned[pin] = true
+	}
+
+	available := make(map[primitive.ObjectID]*PlaylistSummary, len(summaries))
+	for i := range summaries {
+		summaries[i].Pinned = pinned[Pin{Type: PinPlaylist, ID: summaries[i].ID.Hex()}]
+		available[summaries[i].ID] = &summaries[i]
+	}
+
+	// Each playlist is shown once, in the first place it was put
+	placed := make(map[primitive.ObjectID]bool, len(summaries))
+	resolve := func(ids []primitive.ObjectID) []PlaylistSummary {
+		resolved := []PlaylistSummary{}
+		for _, id := range ids {
+			if summary, ok := available[id]; ok && !placed[id] {
+				placed[id] = true
+				resolved = append(resolved, *summary)
+			}
+		}
+		return resolved
+	}
+
+	children := make(map[string][]Folder)
+	for _, folder := range lib.Folders {
+		children[folder.ParentID] = append(children[folder.ParentID], folder)
+	}
+
+	nodes := make(map[string]*FolderNode, len(lib.Folders))
+	var build func(parentID string, depth int) []FolderNode
+	build = func(parentID string, depth int) []FolderNode {
+		list := []FolderNode{}
+		if depth > MaxFolderDepth {
+			return list
+		}
+		for _, folder := range children[parentID] {
+			list = append(list, FolderNode{
+				ID:        folder.ID,
+				Name:      folder.Name,
+				Pinned:    pinned[Pin{Type: PinFolder, ID: folder.ID}],
+				Playlists: resolve(folder.PlaylistIDs),
+				Folders:   build(folder.ID, depth+1),
+			})
+		}
+		for i := range list {
+			nodes[list[i].ID] = &list[i]
+		}
+		return list
+	}
+
+	tree := &Tree{
+		Pinned:  []PinnedNode{},
+		Folders: build("", 1),
+		Version: lib.Version,
+	}
+	tree.Playlists = resolve(lib.Root)
+
+	var unplaced []PlaylistSummary
+	for _, summary := range summaries {
+		if !placed[summary.ID] {
+			unplaced = append(unplaced, summary)
+		}
+	}
+	sort.SliceStable(unplaced, func(i, j int) bool {
+		return unplaced[i].UpdatedAt.After(unplaced[j].UpdatedAt)
+	})
+	tree.Playlists = append(tree.Playlists, unplaced...)
+
+	for _, pin := range lib.Pinned {
+		switch pin.Type {
+		case PinPlaylist:
+			id, err := primitive.ObjectIDFromHex(pin.ID)
+			if err != nil {
+				continue
+			}
+			if summary, ok := available[id]; ok {
+				tree.Pinned = append(tree.Pinned, PinnedNode{Type: PinPlaylist, Playlist: summary})
+			}
+		case PinFolder:
+			if node, ok := nodes[pin.ID]; ok {
+				tree.Pinned = append(tree.Pinned, PinnedNode{Type: PinFolder, Folder: node})
+			}
+		}
+	}
+
+	return tree, nil
+}
@@ -0,0 +1,106 @@
+package like
+
+import (
+	"amplify-backend/internal/middleware"
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// RegisterRoutes registers like-related routes on the authenticated /me group
+// The router must already apply middleware.SupabaseAuth so the user ID is available
+func RegisterRoutes(router fiber.Router, service *LikeService) {
+	// Get the current user's likes
+	router.Get("/likes", func(c *fiber.Ctx) error {
+		userID, err := middleware.GetUserID(c)
+		if err != nil {
+			return c.Status(401).JSON(fiber.Map{
+				"error": "Unauthorized",
+			})
+		}
+
+		likes, err := service.GetLikes(userID)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error": "Failed to get likes",
+			})
+		}
+
+		return c.JSON(likes)
+	})
+
+	// Check whether the current user liked a track
+	router.Get("/likes/:trackId", func(c *fiber.Ctx) error {
+		userID, err := middleware.GetUserID(c)
+		if err != nil {
+			return c.Status(401).JSON(fiber.Map{
+				"error": "Unauthorized",
+			})
+		}
+
+		liked, err := service.IsLiked(userID, c.Params("trackId"))
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid track ID",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"liked": liked,
+		})
+	})
+
+	// Like a track
+	router.Put("/likes/:trackId", func(c *fiber.Ctx) error {
+		userID, err := middleware.GetUserID(c)
+		if err != nil {
+			return c.Status(401).JSON(fiber.Map{
+				"error": "Unauthorized",
+			})
+		}
+
+		like, err := service.LikeTrack(userID, c.Params("trackId"))
+		if err != nil {
+			if errors.Is(err, primitive.ErrInvalidHex) {
+				return c.Status(400).JSON(fiber.Map{
+					"error": "Invalid track ID",
+				})
+			}
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return c.Status(404).JSON(fiber.Map{
+					"error": "Track not found",
+				})
+			}
+			return c.Status(500).JSON(fiber.Map{
+				"error": "Failed to like track",
+			})
+		}
+
+		return c.JSON(like)
+	})
+
+	// Unlike a track
+	router.Delete("/likes/:trackId", func(c *fiber.Ctx) error {
+		userID, err := middleware.GetUserID(c)
+		if err != nil {
+			return c.Status(401).JSON(fiber.Map{
+				"error": "Unauthorized",
+			})
+		}
+
+		if err := service.UnlikeTrack(userID, c.Params("trackId")); err != nil {
+			if errors.Is(err, primitive.ErrInvalidHex) {
+				return c.Status(400).JSON(fiber.Map{
+					"error": "Invalid track ID",
+				})
+			}
+			return c.Status(500).JSON(fiber.Map{
+				"error": "Failed to unlike track",
+			})
+		}
+
+		return c.SendStatus(204)
+	})
+}
@@ -0,0 +1,15 @@
+package like
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Like records that a user favorited a track
+type Like struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID    string             `bson:"user_id" json:"user_id"` // Supabase User ID
+	TrackID   primitive.ObjectID `bson:"track_id" json:"track_id"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
@@ -0,0 +1,233 @@
+package like
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type LikeService struct {
+	LikeCollection  *mongo.Collection
+	TrackCollection *mongo.Collection
+}
+
+func NewLikeService(db *mongo.Database) *LikeService {
+	return &LikeService{
+		LikeCollection:  db.Collection("likes"),
+		TrackCollection: db.Collection("tracks"),
+	}
+}
+
+// EnsureIndexes creates the unique (user_id, track_id) index so a track can only be liked once per user
+func (s *LikeService) EnsureIndexes() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := s.LikeCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "track_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}},
+		},
+	})
+	return err
+}
+
+// LikeTrack marks a track as liked by the user. Liking an already liked track is a no-op.
+func (s *LikeService) LikeTrack(userID, trackID string) (*Like, error) {
+	trackObjID, err := primitive.ObjectIDFromHex(trackID)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Make sure the track exists before recording the like
+	if err := s.TrackCollection.FindOne(ctx, bson.M{"_id": trackObjID, "deleted_at": bson.M{"$exists": false}}).Err(); err != nil {
+		return nil, err
+	}
+
+	filter := bson.M{"user_id": userID, "track_id": trackObjID}
+	res, err := s.LikeCollection.UpdateOne(
+		ctx,
+		filter,
+		bson.M{"$setOnInsert": bson.M{"created_at": time.Now()}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only count the like once, when it was actually created
+	if res.UpsertedCount > 0 {
+		_, err = s.TrackCollection.UpdateOne(
+			ctx,
+			bson.M{"_id": trackObjID},
+			bson.M{"$inc": bson.M{"like_count": 1}},
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var like Like
+	if err := s.LikeCollection.FindOne(ctx, filter).Decode(&like); err != nil {
+		return nil, err
+	}
+
+	return &like, nil
+}
+
+// UnlikeTrack removes the user's like from a track. Unliking a track that is not liked is a no-op.
+func (s *LikeService) UnlikeTrack(userID, trackID string) error {
+	trackObjID, err := primitive.ObjectIDFromHex(trackID)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := s.LikeCollection.DeleteOne(ctx, bson.M{"user_id": userID, "track_id": trackObjID})
+	if err != nil {
+		return err
+	}
+
+	if res.DeletedCount > 0 {
+		_, err = s.TrackCollection.UpdateOne(
+			ctx,
+			bson.M{"_id": trackObjID, "like_count": bson.M{"$gt": 0}},
+			bson.M{"$inc": bson.M{"like_count": -1}},
+		)
+	}
+
+	return err
+}
+
+// GetLikes returns the user's likes, most recent first
+func (s *LikeService) GetLikes(userID string) ([]Like, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := s.LikeCollection.Find(
+		ctx,
+		bson.M{"user_id": userID},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	likes := []Like{}
+	if err := cursor.All(ctx, &likes); err != nil {
+		return nil, err
+	}
+
+	return likes, nil
+}
+
+// GetLikedTrackIDs returns the IDs of the tracks the user liked, most recent first
+// Tracks in the trash or purged from it are left out
+func (s *LikeService) GetLikedTrackIDs(userID string) ([]primitive.ObjectID, error) {
+	likes, err := s.GetLikes(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(likes) == 0 {
+		return []primitive.ObjectID{}, nil
+	}
+
+	allIDs := make([]primitive.ObjectID, 0, len(likes))
+	for _, like := range likes {
+		allIDs = append(allIDs, like.TrackID)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := s.TrackCollection.Find(
+		ctx,
+		bson.M{"_id": bson.M{"$in": allIDs}, "deleted_at": bson.M{"$exists": false}},
+		options.Find().SetProjection(bson.M{"_id": 1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var available []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &available); err != nil {
+		return nil, err
+	}
+
+	keep := make(map[primitive.ObjectID]bool, len(available))
+	for _, t := range available {
+		keep[t.ID] = true
+	}
+
+	// Preserve the like order
+	trackIDs := make([]primitive.ObjectID, 0, len(available))
+	for _, id := range allIDs {
+		if keep[id] {
+			trackIDs = append(trackIDs, id)
+		}
+	}
+
+	return trackIDs, nil
+}
+
+// IsLiked reports whether the user liked the track
+func (s *LikeService) IsLiked(userID, trackID string) (bool, error) {
+	trackObjID, err := primitive.ObjectIDFromHex(trackID)
+	if err != nil {
+		return false, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	count, err := s.LikeCollection.CountDocuments(ctx, bson.M{"user_id": userID, "track_id": trackObjID})
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// GetTotalLikeCount returns the total number of likes across all users
+func (s *LikeService) GetTotalLikeCount() (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	count, err := s.LikeCollection.CountDocuments(ctx, bson.M{})
+	return count, err
+}
+
+// TrackTrashed keeps the likes of a trashed track, so restoring it brings them back
+func (s *LikeService) TrackTrashed(trackID primitive.ObjectID, deletedAt time.Time) error {
+	return nil
+}
+
+func (s *LikeService) TrackRestored(trackID primitive.ObjectID) error {
+	return nil
+}
+
+// TrackPurged removes the likes of a permanently deleted track
+func (s *LikeService) TrackPurged(trackID primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := s.LikeCollection.DeleteMany(ctx, bson.M{"track_id": trackID})
+	return err
+}
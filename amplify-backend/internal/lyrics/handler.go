@@ -0,0 +1,96 @@
+package lyrics
+
+import (
+	"amplify-backend/internal/middleware"
+	"errors"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// RegisterRoutes registers the public lyrics endpoint
+func RegisterRoutes(app *fiber.App, service *LyricsService) {
+	// Get lyrics for a track (?format=lrc returns the original upload as text)
+	app.Get("/tracks/:id/lyrics", func(c *fiber.Ctx) error {
+		lyrics, err := service.GetLyrics(c.Params("id"))
+		if err != nil {
+			return errorResponse(c, err, "Failed to get lyrics")
+		}
+
+		if c.Query("format") == "lrc" && lyrics.Synced {
+			c.Set("Content-Type", "text/plain; charset=utf-8")
+			return c.SendString(lyrics.Source)
+		}
+
+		return c.JSON(lyrics)
+	})
+}
+
+// RegisterAdminRoutes registers lyrics upload and removal on the /admin group
+func RegisterAdminRoutes(router fiber.Router, service *LyricsService) {
+	// Upload lyrics as JSON {"format", "language", "content"} or as a raw text body
+	// (?format= and ?language= query parameters apply to raw uploads)
+	router.Put("/tracks/:id/lyrics", func(c *fiber.Ctx) error {
+		editorID, _ := middleware.GetUserID(c)
+
+		format := c.Query("format")
+		language := c.Query("language")
+		content := string(c.Body())
+
+		if strings.HasPrefix(c.Get("Content-Type"), fiber.MIMEApplicationJSON) {
+			var body struct {
+				Format   string `json:"format"`
+				Language string `json:"language"`
+				Content  string `json:"content"`
+			}
+			if err := c.BodyParser(&body); err != nil {
+				return c.Status(400).JSON(fiber.Map{
+					"error": "Invalid request",
+				})
+			}
+			format, language, content = body.Format, body.Language, body.Content
+		}
+
+		lyrics, err := service.SaveLyrics(c.Params("id"), format, content, language, editorID)
+		if err != nil {
+			var parseErr *ParseError
+			if errors.As(err, &parseErr) {
+				return c.Status(400).JSON(fiber.Map{
+					"error":   "Invalid lyrics",
+					"details": parseErr,
+				})
+			}
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return c.Status(404).JSON(fiber.Map{
+					"error": "Track not found",
+				})
+			}
+			return errorResponse(c, err, "Failed to save lyrics")
+		}
+
+		return c.JSON(lyrics)
+	})
+
+	// Remove lyrics from a track
+	router.Delete("/tracks/:id/lyrics", func(c *fiber.Ctx) error {
+		if err := service.DeleteLyrics(c.Params("id")); err != nil {
+			return errorResponse(c, err, "Failed to delete lyrics")
+		}
+
+		return c.SendStatus(204)
+	})
+}
+
+// errorResponse maps service errors to HTTP status codes
+func errorResponse(c *fiber.Ctx, err error, fallback string) error {
+	switch {
+	case errors.Is(err, primitive.ErrInvalidHex):
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid track ID"})
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return c.Status(404).JSON(fiber.Map{"error": "Lyrics not found"})
+	default:
+		return c.Status(500).JSON(fiber.Map{"error": fallback})
+	}
+}
@@ -0,0 +1,49 @@
+package lyrics
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Supported lyrics formats
+const (
+	FormatPlain    = "plain" // Unsynchronized text
+	FormatLRC      = "lrc"   // Line-synced LRC
+	FormatEnhanced = "elrc"  // Enhanced LRC with per-word timing
+)
+
+// Lyrics holds the lyrics of a single track
+type Lyrics struct {
+	ID       primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	TrackID  primitive.ObjectID `bson:"track_id" json:"track_id"`
+	Format   string             `bson:"format" json:"format"`
+	Language string             `bson:"language,omitempty" json:"language,omitempty"`
+	Synced   bool               `bson:"synced" json:"synced"`
+
+	// Plain text (always present, derived from the lines for synced formats)
+	Plain string `bson:"plain" json:"plain"`
+
+	// Time-synced lines, sorted by time (empty for plain lyrics)
+	Lines []Line `bson:"lines,omitempty" json:"lines,omitempty"`
+
+	// Original upload, kept so it can be re-parsed or downloaded
+	Source string `bson:"source" json:"-"`
+
+	UpdatedBy string    `bson:"updated_by,omitempty" json:"updated_by,omitempty"` // Supabase User ID
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// Line is a lyric line starting at Time milliseconds into the track
+type Line struct {
+	Time  int    `bson:"time" json:"time"` // milliseconds
+	Text  string `bson:"text" json:"text"`
+	Words []Word `bson:"words,omitempty" json:"words,omitempty"` // Enhanced LRC only
+}
+
+// Word is a word-level timing inside an enhanced LRC line
+type Word struct {
+	Time int    `bson:"time" json:"time"` // milliseconds
+	Text string `bson:"text" json:"text"`
+}
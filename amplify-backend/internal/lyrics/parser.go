@@ -0,0 +1,286 @@
+package lyrics
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Parsing limits
+const (
+	MaxSourceLength = 64 * 1024
+	MaxLines        = 2000
+	MaxLineLength   = 500
+)
+
+var (
+	// [mm:ss], [mm:ss.xx] or [mm:ss:xx]
+	lineTimeTag = regexp.MustCompile(`^\[(\d{1,3}):(\d{1,2})(?:[.:](\d{1,3}))?\]`)
+	// <mm:ss.xx> word timing used by enhanced LRC
+	wordTimeTag = regexp.MustCompile(`<(\d{1,3}):(\d{1,2})(?:[.:](\d{1,3}))?>`)
+	// [key:value] ID tags such as [ar:Artist] or [offset:+250]
+	idTag = regexp.MustCompile(`^\[([a-zA-Z#]+):(.*)\]$`)
+)
+
+// ParseError describes a problem at a specific line of the uploaded lyrics
+type ParseError struct {
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+func (e *ParseError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+	}
+	return e.Message
+}
+
+// Parsed is the result of parsing uploaded lyrics
+type Parsed struct {
+	Format string
+	Plain  string
+	Lines  []Line
+}
+
+// DetectFormat guesses the format of uploaded lyrics from their content
+func DetectFormat(content string) string {
+	for _, raw := range strings.Split(content, "\n") {
+		line := strings.TrimSpace(raw)
+		if lineTimeTag.MatchString(line) {
+			if wordTimeTag.MatchString(line) {
+				return FormatEnhanced
+			}
+			return FormatLRC
+		}
+	}
+	return FormatPlain
+}
+
+// Parse parses and validates lyrics in the given format
+// durationMs is the track duration used to reject timestamps past the end (0 disables the check)
+func Parse(content, format string, durationMs int) (*Parsed, error) {
+	if len(content) > MaxSourceLength {
+		return nil, &ParseError{Message: fmt.Sprintf("lyrics must be at most %d bytes", MaxSourceLength)}
+	}
+
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	if strings.TrimSpace(content) == "" {
+		return nil, &ParseError{Message: "lyrics are empty"}
+	}
+
+	if format == "" {
+		format = DetectFormat(content)
+	}
+
+	switch format {
+	case FormatPlain:
+		return parsePlain(content)
+	case FormatLRC, FormatEnhanced:
+		return parseLRC(content, format, durationMs)
+	default:
+		return nil, &ParseError{Message: fmt.Sprintf("unsupported format %q", format)}
+	}
+}
+
+func parsePlain(content string) (*Parsed, error) {
+	lines := strings.Split(strings.TrimSpace(content), "\n")
+	if len(lines) > MaxLines {
+		return nil, &ParseError{Message: fmt.Sprintf("lyrics must have at most %d lines", MaxLines)}
+	}
+
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+		if len([]rune(lines[i])) > MaxLineLength {
+			return nil, &ParseError{Line: i + 1, Message: fmt.Sprintf("line is longer than %d characters", MaxLineLength)}
+		}
+	}
+
+	return &Parsed{
+		Format: FormatPlain,
+		Plain:  strings.Join(lines, "\n"),
+	}, nil
+}
+
+func parseLRC(content, format string, durationMs int) (*Parsed, error) {
+	offset := 0
+	var lines []Line
+
+	for i, raw := range strings.Split(content, "\n") {
+		lineNo := i + 1
+		line := strings.TrimSpace(raw)
+		if line == "" {
+			continue
+		}
+
+		// A line may carry several timestamps: [00:12.00][01:30.50]Chorus
+		var times []int
+		rest := line
+		for {
+			match := lineTimeTag.FindStringSubmatch(rest)
+			if match == nil {
+				break
+			}
+			ms, err := timestampToMs(match[1], match[2], match[3])
+			if err != nil {
+				return nil, &ParseError{Line: lineNo, Message: err.Error()}
+			}
+			times = append(times, ms)
+			rest = rest[len(match[0]):]
+		}
+
+		if len(times) == 0 {
+			// ID tags carry metadata; only the offset affects timing
+			if match := idTag.FindStringSubmatch(line); match != nil {
+				if strings.EqualFold(match[1], "offset") {
+					value, err := strconv.Atoi(strings.TrimSpace(match[2]))
+					if err != nil {
+						return nil, &ParseError{Line: lineNo, Message: "invalid offset tag"}
+					}
+					offset = value
+				}
+				continue
+			}
+			return nil, &ParseError{Line: lineNo, Message: "line has no timestamp"}
+		}
+
+		text, words, err := parseWords(rest, format)
+		if err != nil {
+			return nil, &ParseError{Line: lineNo, Message: err.Error()}
+		}
+		if len([]rune(text)) > MaxLineLength {
+			return nil, &ParseError{Line: lineNo, Message: fmt.Sprintf("line is longer than %d characters", MaxLineLength)}
+		}
+
+		// Word times belong to the first timestamp; a repeat of the line (a chorus) gets them
+		// shifted to its own time
+		if len(words) > 0 && words[0].Time < times[0] {
+			return nil, &ParseError{Line: lineNo, Message: "word timing starts before the line"}
+		}
+		for i, t := range times {
+			lineWords := words
+			if i > 0 && len(words) > 0 {
+				lineWords = make([]Word, len(words))
+				for j, word := range words {
+					lineWords[j] = Word{Time: word.Time + t - times[0], Text: word.Text}
+				}
+			}
+			lines = append(lines, Line{Time: t, Text: text, Words: lineWords})
+		}
+
+		if len(lines) > MaxLines {
+			return nil, &ParseError{Message: fmt.Sprintf("lyrics must have at most %d lines", MaxLines)}
+		}
+	}
+
+	if len(lines) == 0 {
+		return nil, &ParseError{Message: "synced lyrics need at least one timed line"}
+	}
+
+	// A positive offset makes lyrics appear sooner
+	for i := range lines {
+		lines[i].Time = max(lines[i].Time-offset, 0)
+		if len(lines[i].Words) > 0 {
+			words := make([]Word, len(lines[i].Words))
+			for j, word := range lines[i].Words {
+				words[j] = Word{Time: max(word.Time-offset, 0), Text: word.Text}
+			}
+			lines[i].Words = words
+		}
+	}
+
+	sort.SliceStable(lines, func(a, b int) bool {
+		return lines[a].Time < lines[b].Time
+	})
+
+	if durationMs > 0 && lines[len(lines)-1].Time > durationMs {
+		return nil, &ParseError{Message: "a timestamp is past the end of the track"}
+	}
+
+	texts := make([]string, len(lines))
+	for i, line := range lines {
+		texts[i] = line.Text
+	}
+
+	return &Parsed{
+		Format: format,
+		Plain:  strings.Join(texts, "\n"),
+		Lines:  lines,
+	}, nil
+}
+
+// parseWords strips enhanced LRC word tags from a line and returns the text and word timings
+func parseWords(rest, format string) (string, []Word, error) {
+	matches := wordTimeTag.FindAllStringSubmatchIndex(rest, -1)
+	if len(matches) == 0 {
+		return strings.TrimSpace(rest), nil, nil
+	}
+
+	if format != FormatEnhanced {
+		// Plain LRC: keep the text, drop stray word tags
+		return strings.TrimSpace(wordTimeTag.ReplaceAllString(rest, "")), nil, nil
+	}
+
+	var words []Word
+	for i, m := range matches {
+		ms, err := timestampToMs(rest[m[2]:m[3]], rest[m[4]:m[5]], optionalGroup(rest, m[6], m[7]))
+		if err != nil {
+			return "", nil, err
+		}
+
+		end := len(rest)
+		if i+1 < len(matches) {
+			end = matches[i+1][0]
+		}
+		word := strings.TrimSpace(rest[m[1]:end])
+		if word == "" {
+			continue // Trailing tag marking the end of the last word
+		}
+		if len(words) > 0 && ms < words[len(words)-1].Time {
+			return "", nil, fmt.Errorf("word timestamps must not go backwards")
+		}
+		words = append(words, Word{Time: ms, Text: word})
+	}
+
+	text := strings.Join(strings.Fields(wordTimeTag.ReplaceAllString(rest, " ")), " ")
+	return text, words, nil
+}
+
+func optionalGroup(s string, start, end int) string {
+	if start < 0 {
+		return ""
+	}
+	return s[start:end]
+}
+
+// timestampToMs converts LRC minute, second and fraction parts to milliseconds
+func timestampToMs(minutes, seconds, fraction string) (int, error) {
+	m, _ := strconv.Atoi(minutes)
+	s, _ := strconv.Atoi(seconds)
+	if s >= 60 {
+		return 0, fmt.Errorf("invalid timestamp %s:%s", minutes, seconds)
+	}
+
+	ms := 0
+	switch len(fraction) {
+	case 1:
+		f, _ := strconv.Atoi(fraction)
+		ms = f * 100 // tenths
+	case 2:
+		f, _ := strconv.Atoi(fraction)
+		ms = f * 10 // hundredths
+	case 3:
+		ms, _ = strconv.Atoi(fraction)
+	}
+
+	return (m*60+s)*1000 + ms, nil
+}
+
+// LineIndexAt returns the index of the line active at positionMs, or -1 before the first line
+// lineTimes must be sorted in ascending order
+func LineIndexAt(lineTimes []int, positionMs int) int {
+	return sort.Search(len(lineTimes), func(i int) bool {
+		return lineTimes[i] > positionMs
+	}) - 1
+}
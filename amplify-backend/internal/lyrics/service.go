@@ -0,0 +1,171 @@
+package lyrics
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type LyricsService struct {
+	LyricsCollection *mongo.Collection
+	TrackCollection  *mongo.Collection
+}
+
+func NewLyricsService(db *mongo.Database) *LyricsService {
+	return &LyricsService{
+		LyricsCollection: db.Collection("lyrics"),
+		TrackCollection:  db.Collection("tracks"),
+	}
+}
+
+// EnsureIndexes creates the unique track_id index (one lyrics document per track)
+func (s *LyricsService) EnsureIndexes() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := s.LyricsCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "track_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+// SaveLyrics parses, validates and stores the lyrics for a track, replacing any existing lyrics
+// An empty format is detected from the content
+func (s *LyricsService) SaveLyrics(trackID, format, content, language, editorID string) (*Lyrics, error) {
+	trackObjID, err := primitive.ObjectIDFromHex(trackID)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Timestamps are validated against the track duration
+	var track struct {
+		Duration int `bson:"duration"` // seconds
+	}
+	if err := s.TrackCollection.FindOne(ctx, bson.M{"_id": trackObjID, "deleted_at": bson.M{"$exists": false}}).Decode(&track); err != nil {
+		return nil, err
+	}
+
+	parsed, err := Parse(content, format, track.Duration*1000)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var lyrics Lyrics
+	err = s.LyricsCollection.FindOneAndUpdate(
+		ctx,
+		bson.M{"track_id": trackObjID},
+		bson.M{
+			"$set": bson.M{
+				"format":     parsed.Format,
+				"language":   language,
+				"synced":     len(parsed.Lines) > 0,
+				"plain":      parsed.Plain,
+				"lines":      parsed.Lines,
+				"source":     content,
+				"updated_by": editorID,
+				"updated_at": now,
+			},
+			"$setOnInsert": bson.M{
+				"created_at": now,
+			},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&lyrics)
+	if err != nil {
+		return nil, err
+	}
+
+	return &lyrics, nil
+}
+
+// GetLyrics returns the lyrics of a track
+func (s *LyricsService) GetLyrics(trackID string) (*Lyrics, error) {
+	trackObjID, err := primitive.ObjectIDFromHex(trackID)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var lyrics Lyrics
+	err = s.LyricsCollection.FindOne(ctx, bson.M{"track_id": trackObjID}).Decode(&lyrics)
+	if err != nil {
+		return nil, err
+	}
+
+	return &lyrics, nil
+}
+
+// GetLineTimes returns the sorted start times of the synced lines of a track
+// Tracks without synced lyrics return an empty slice
+func (s *LyricsService) GetLineTimes(trackID string) ([]int, error) {
+	trackObjID, err := primitive.ObjectIDFromHex(trackID)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	var lyrics Lyrics
+	err = s.LyricsCollection.FindOne(
+		ctx,
+		bson.M{"track_id": trackObjID, "synced": true},
+		options.FindOne().SetProjection(bson.M{"lines.time": 1}),
+	).Decode(&lyrics)
+	if err == mongo.ErrNoDocuments {
+		return []int{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	times := make([]int, len(lyrics.Lines))
+	for i, line := range lyrics.Lines {
+		times[i] = line.Time
+	}
+
+	return times, nil
+}
+
+// DeleteLyrics removes the lyrics of a track
+func (s *LyricsService) DeleteLyrics(trackID string) error {
+	trackObjID, err := primitive.ObjectIDFromHex(trackID)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err = s.LyricsCollection.DeleteOne(ctx, bson.M{"track_id": trackObjID})
+	return err
+}
+
+// TrackTrashed keeps the lyrics of a trashed track, so restoring it brings them back
+func (s *LyricsService) TrackTrashed(trackID primitive.ObjectID, deletedAt time.Time) error {
+	return nil
+}
+
+func (s *LyricsService) TrackRestored(trackID primitive.ObjectID) error {
+	return nil
+}
+
+// TrackPurged removes the lyrics of a permanently deleted track
+func (s *LyricsService) TrackPurged(trackID primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := s.LyricsCollection.DeleteOne(ctx, bson.M{"track_id": trackID})
+	return err
+}
@@ -169,6 +169,58 @@ func SupabaseAdminAuth(config *SupabaseConfig) fiber.Handler {
 	}
 }
 
+// SupabaseOptionalAuth identifies the user when a valid token is sent but lets anonymous
+// requests through. A malformed or expired token is still rejected so clients notice.
+func SupabaseOptionalAuth(config *SupabaseConfig) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		authHeader := c.Get("Authorization")
+		if authHeader == "" {
+			return c.Next()
+		}
+
+		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+		if tokenString == authHeader {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Invalid authorization header format",
+			})
+		}
+
+		claims, err := VerifySupabaseToken(c.Context(), tokenString, config)
+		if err != nil || claims.Subject == "" {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Invalid or expired token",
+			})
+		}
+
+		c.Locals("user_id", claims.Subject)
+		c.Locals("supabase_claims", claims)
+		c.Locals("user_email", claims.Email)
+
+		return c.Next()
+	}
+}
+
+// IsAdmin reports whether the authenticated user has the admin role.
+// The result is cached on the request so the profile is fetched at most once.
+func IsAdmin(c *fiber.Ctx, config *SupabaseConfig) (bool, error) {
+	if isAdmin, ok := c.Locals("is_admin").(bool); ok {
+		return isAdmin, nil
+	}
+
+	userID, err := GetUserID(c)
+	if err != nil {
+		return false, err
+	}
+
+	role, err := FetchUserRole(c.Context(), userID, config)
+	if err != nil {
+		return false, err
+	}
+
+	c.Locals("is_admin", role == "admin")
+	return role == "admin", nil
+}
+
 // GetUserID helper to extract user ID from context
 func GetUserID(c *fiber.Ctx) (string, error) {
 	userID, ok := c.Locals("user_id").(string)
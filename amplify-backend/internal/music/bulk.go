@@ -0,0 +1,269 @@
+package music
+
+import (
+	"amplify-backend/internal/validation"
+	"context"
+	"errors"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MaxBulkTracks caps how many tracks a single bulk edit may touch
+const MaxBulkTracks = 500
+
+// ErrTooManyTracks is returned when a bulk filter matches more than MaxBulkTracks tracks
+var ErrTooManyTracks = errors.New("filter matches too many tracks")
+
+// BulkFilter selects the tracks of a bulk edit. IDs and the artist/album match can be combined.
+type BulkFilter struct {
+	IDs    []string `json:"ids"`
+	Artist *string  `json:"artist"` // Case-insensitive exact match
+	Album  *string  `json:"album"`  // Case-insensitive exact match
+}
+
+// BulkUpdateRequest is the body of PATCH /tracks
+type BulkUpdateRequest struct {
+	Filter BulkFilter  `json:"filter"`
+	Set    TrackUpdate `json:"set"`
+	DryRun bool        `json:"dry_run"`
+}
+
+// BulkTrackChange is the diff for one track in a bulk edit
+type BulkTrackChange struct {
+	TrackID  primitive.ObjectID `json:"track_id"`
+	Title    string             `json:"title"`
+	Revision int                `json:"revision"` // Revision the change creates (or would create)
+	Changes  []FieldChange      `json:"changes"`
+}
+
+// BulkUpdateResult reports what a bulk edit changed (or would change for a dry run)
+type BulkUpdateResult struct {
+	DryRun    bool                 `json:"dry_run"`
+	Matched   int                  `json:"matched"`
+	Changed   int                  `json:"changed"`
+	Tracks    []BulkTrackChange    `json:"tracks"`
+	Conflicts []primitive.ObjectID `json:"conflicts,omitempty"` // Tracks edited concurrently and skipped
+
+	// Tracks changed without a recorded revision, whose change can't be reverted
+	Unrecorded []primitive.ObjectID `json:"unrecorded,omitempty"`
+}
+
+// Validate checks the filter and the field changes
+func (r BulkUpdateRequest) Validate() validation.Errors {
+	var errs validation.Errors
+
+	filter := r.Filter
+	if len(filter.IDs) == 0 && blank(filter.Artist) && blank(filter.Album) {
+		errs.Add("filter", validation.CodeRequired, "must select tracks by ids, artist or album")
+	}
+	if len(filter.IDs) > MaxBulkTracks {
+		errs.Add("filter.ids", validation.CodeTooLong, "must contain at most 500 IDs")
+	}
+	for _, id := range filter.IDs {
+		if _, err := primitive.ObjectIDFromHex(id); err != nil {
+			errs.Add("filter.ids", validation.CodeInvalidType, "must contain valid track IDs")
+			break
+		}
+	}
+
+	errs = append(errs, r.Set.Validate().Prefix("set")...)
+
+	return errs
+}
+
+// BulkUpdateTracks applies the same metadata changes to every matching track in one bulk write
+// Each changed track gets its own revision. With dryRun nothing is written.
+func (s *MusicService) BulkUpdateTracks(req BulkUpdateRequest, editorID string) (*BulkUpdateResult, error) {
+	if errs := req.Validate(); len(errs) > 0 {
+		return nil, errs
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	filter := notDeleted(bson.M{})
+	if len(req.Filter.IDs) > 0 {
+		ids := make([]primitive.ObjectID, 0, len(req.Filter.IDs))
+		for _, id := range req.Filter.IDs {
+			objectID, _ := primitive.ObjectIDFromHex(id)
+			ids = append(ids, objectID)
+		}
+		filter["_id"] = bson.M{"$in": ids}
+	}
+	if !blank(req.Filter.Artist) {
+		filter["artist"] = exactMatch(*req.Filter.Artist)
+	}
+	if !blank(req.Filter.Album) {
+		filter["album"] = exactMatch(*req.Filter.Album)
+	}
+
+	cursor, err := s.TrackCollection.Find(
+		ctx,
+		filter,
+		options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(MaxBulkTracks+1),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var docs []bson.M
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	if len(docs) > MaxBulkTracks {
+		return nil, ErrTooManyTracks
+	}
+
+	set, unset := req.Set.Fields()
+	result := &BulkUpdateResult{
+		DryRun:  req.DryRun,
+		Matched: len(docs),
+		Tracks:  []BulkTrackChange{},
+	}
+
+	now := time.Now()
+
+	// Tags the tracks this write changes, so a concurrent edit to the same revision number
+	// can't be mistaken for ours
+	writeID := primitive.NewObjectID()
+
+	var models []mongo.WriteModel
+	for _, doc := range docs {
+		changes := diffFields(doc, set, unset)
+		if len(changes) == 0 {
+			continue
+		}
+
+		id := doc["_id"].(primitive.ObjectID)
+		revision := revisionOf(doc)
+		title, _ := doc["title"].(string)
+
+		result.Tracks = append(result.Tracks, BulkTrackChange{
+			TrackID:  id,
+			Title:    title,
+			Revision: revision + 1,
+			Changes:  changes,
+		})
+		update := revisionUpdate(doc, changes, now)
+		update["$set"].(bson.M)["bulk_write_id"] = writeID
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(revisionFilter(id, revision)).
+			SetUpdate(update))
+	}
+
+	result.Changed = len(result.Tracks)
+	if req.DryRun || len(models) == 0 {
+		return result, nil
+	}
+
+	if _, err := s.TrackCollection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false)); err != nil {
+		return nil, err
+	}
+
+	// A track without our write ID was edited concurrently and skipped
+	applied, err := s.appliedTracks(ctx, result.Tracks, writeID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.TrackCollection.UpdateMany(ctx, bson.M{"bulk_write_id": writeID}, bson.M{"$unset": bson.M{"bulk_write_id": ""}}); err != nil {
+		log.Printf("Failed to clear write ID of bulk edit %s: %v", writeID.Hex(), err)
+	}
+
+	var revisions []interface{}
+	changed := result.Tracks[:0]
+	for _, track := range result.Tracks {
+		if !applied[track.TrackID] {
+			result.Conflicts = append(result.Conflicts, track.TrackID)
+			continue
+		}
+		changed = append(changed, track)
+		revisions = append(revisions, TrackRevision{
+			TrackID:   track.TrackID,
+			Revision:  track.Revision,
+			EditorID:  editorID,
+			Changes:   track.Changes,
+			CreatedAt: now,
+		})
+	}
+	result.Tracks = changed
+	result.Changed = len(changed)
+
+	// The tracks are already written, so tracks whose revision could not be inserted are
+	// reported rather than failing the edit; unordered so one failure doesn't skip the rest
+	if len(revisions) > 0 {
+		if _, err := s.RevisionCollection.InsertMany(ctx, revisions, options.InsertMany().SetOrdered(false)); err != nil {
+			log.Printf("Failed to record revisions of bulk edit %s: %v", writeID.Hex(), err)
+			result.Unrecorded = unrecordedTracks(changed, err)
+		}
+	}
+
+	return result, nil
+}
+
+// unrecordedTracks returns the tracks whose revision failed to insert. Without per-document
+// errors none of them is known to be recorded.
+func unrecordedTracks(tracks []BulkTrackChange, err error) []primitive.ObjectID {
+	var unrecorded []primitive.ObjectID
+	var bulkErr mongo.BulkWriteException
+	if !errors.As(err, &bulkErr) || len(bulkErr.WriteErrors) == 0 {
+		for _, track := range tracks {
+			unrecorded = append(unrecorded, track.TrackID)
+		}
+		return unrecorded
+	}
+	for _, writeErr := range bulkErr.WriteErrors {
+		if writeErr.Index >= 0 && writeErr.Index < len(tracks) {
+			unrecorded = append(unrecorded, tracks[writeErr.Index].TrackID)
+		}
+	}
+	return unrecorded
+}
+
+// appliedTracks returns which of the tracks carry the write ID of a bulk write
+func (s *MusicService) appliedTracks(ctx context.Context, tracks []BulkTrackChange, writeID primitive.ObjectID) (map[primitive.ObjectID]bool, error) {
+	ids := make([]primitive.ObjectID, len(tracks))
+	for i, track := range tracks {
+		ids[i] = track.TrackID
+	}
+
+	cursor, err := s.TrackCollection.Find(
+		ctx,
+		bson.M{"_id": bson.M{"$in": ids}, "bulk_write_id": writeID},
+		options.Find().SetProjection(bson.M{"_id": 1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var docs []bson.M
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+
+	applied := make(map[primitive.ObjectID]bool, len(docs))
+	for _, doc := range docs {
+		applied[doc["_id"].(primitive.ObjectID)] = true
+	}
+	return applied, nil
+}
+
+// exactMatch builds a case-insensitive, whitespace-trimmed equality match
+func exactMatch(value string) primitive.Regex {
+	return primitive.Regex{
+		Pattern: "^" + regexp.QuoteMeta(strings.TrimSpace(value)) + "$",
+		Options: "i",
+	}
+}
+
+func blank(value *string) bool {
+	return value == nil || strings.TrimSpace(*value) == ""
+}
@@ -1,7 +1,11 @@
 package music
 
 import (
+	"amplify-backend/internal/middleware"
 	"amplify-backend/internal/storage"
+	"amplify-backend/internal/validation"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 
@@ -11,7 +15,8 @@ import (
 	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 // AnalyticsServices holds references to services needed for analytics
@@ -23,16 +28,22 @@ type AnalyticsServices struct {
 	AuthService interface {
 		GetTotalUserCount() (int64, error)
 	}
+	LikeService interface {
+		GetTotalLikeCount() (int64, error)
+	}
 }
 
-func RegisterRoutes(app *fiber.App, service *MusicService, storageService storage.StorageProvider) {
-	RegisterRoutesWithAnalytics(app, service, storageService, nil)
+func RegisterRoutes(app *fiber.App, service *MusicService, storageService storage.StorageProvider, config *middleware.SupabaseConfig) {
+	RegisterRoutesWithAnalytics(app, service, storageService, nil, config)
 }
 
 // RegisterRoutesWithAnalytics registers music-related routes
-// All routes are PUBLIC and do not require authentication (guest mode support)
+// Browsing and streaming routes are PUBLIC and do not require authentication (guest mode support)
 // This allows users to browse and stream music without signing in
-func RegisterRoutesWithAnalytics(app *fiber.App, service *MusicService, storageService storage.StorageProvider, analyticsServices *AnalyticsServices) {
+// Metadata edits require a Supabase token so every change can be attributed to its editor
+func RegisterRoutesWithAnalytics(app *fiber.App, service *MusicService, storageService storage.StorageProvider, analyticsServices *AnalyticsServices, config *middleware.SupabaseConfig) {
+	requireAuth := middleware.SupabaseAuth(config)
+
 	// Legacy endpoint for adding tracks with JSON (kept for backward compatibility)
 	app.Post("/tracks", func(c *fiber.Ctx) error {
 		var track Track
@@ -155,7 +166,26 @@ func RegisterRoutesWithAnalytics(app *fiber.App, service *MusicService, storageS
 	})
 
 	// Get all tracks
+	// ?q= filters with the track query grammar (see query.go), ?sort=-play_count,title and ?limit= order and cap it
 	app.Get("/tracks", func(c *fiber.Ctx) error {
+		if c.Query("q") != "" || c.Query("sort") != "" || c.Query("limit") != "" {
+			query, err := parseTrackListQuery(c)
+			if err != nil {
+				return c.Status(400).JSON(fiber.Map{
+					"error": err.Error(),
+				})
+			}
+
+			tracks, err := service.FindTracks(query, DefaultQueryLimit)
+			if err != nil {
+				return c.Status(500).JSON(fiber.Map{
+					"error": "Failed to get tracks",
+				})
+			}
+
+			return c.JSON(tracks)
+		}
+
 		tracks, err := service.GetAllTracks()
 		if err != nil {
 			return c.Status(500).JSON(fiber.Map{
@@ -180,56 +210,102 @@ func RegisterRoutesWithAnalytics(app *fiber.App, service *MusicService, storageS
 	})
 
 	// Update track metadata
-	app.Put("/tracks/:id", func(c *fiber.Ctx) error {
+	app.Put("/tracks/:id", requireAuth, func(c *fiber.Ctx) error {
 		id := c.Params("id")
+		editorID, _ := middleware.GetUserID(c)
 
-		var updates bson.M
-		if err := c.BodyParser(&updates); err != nil {
-			return c.Status(400).JSON(fiber.Map{
-				"error": "Invalid request",
-			})
+		var update TrackUpdate
+		if errs := validation.DecodeStrict(c.Body(), &update, TrackReadOnlyFields...); len(errs) > 0 {
+			return validation.Response(c, errs)
 		}
 
-		// Don't allow updating file paths or system fields
-		delete(updates, "_id")
-		delete(updates, "id")
-		delete(updates, "file_path")
-		delete(updates, "file_name")
-		delete(updates, "file_size")
-		delete(updates, "mime_type")
-		delete(updates, "created_at")
-		delete(updates, "play_count")
-		delete(updates, "last_played")
+		updated, err := service.UpdateTrack(id, update, editorID)
+		if err != nil {
+			return revisionErrorResponse(c, err, "Failed to update track")
+		}
+
+		return c.JSON(updated)
+	})
+
+	// Bulk edit metadata of tracks selected by IDs or artist/album (dry_run previews the diff)
+	app.Patch("/tracks", requireAuth, func(c *fiber.Ctx) error {
+		editorID, _ := middleware.GetUserID(c)
 
-		updated, err := service.UpdateTrack(id, updates)
+		var body struct {
+			Filter json.RawMessage `json:"filter"`
+			Set    json.RawMessage `json:"set"`
+			DryRun bool            `json:"dry_run"`
+		}
+		errs := validation.DecodeStrict(c.Body(), &body)
+
+		req := BulkUpdateRequest{DryRun: body.DryRun}
+		if len(body.Filter) > 0 {
+			errs = append(errs, validation.DecodeStrict(body.Filter, &req.Filter).Prefix("filter")...)
+		}
+		if len(body.Set) > 0 {
+			errs = append(errs, validation.DecodeStrict(body.Set, &req.Set).Prefix("set")...)
+		}
+		if len(errs) > 0 {
+			return validation.Response(c, errs)
+		}
+
+		result, err := service.BulkUpdateTracks(req, editorID)
 		if err != nil {
-			return c.Status(500).JSON(fiber.Map{
-				"error": "Failed to update track",
+			if errors.Is(err, ErrTooManyTracks) {
+				return c.Status(400).JSON(fiber.Map{
+					"error": fmt.Sprintf("Filter matches more than %d tracks", MaxBulkTracks),
+				})
+			}
+			return revisionErrorResponse(c, err, "Failed to update tracks")
+		}
+
+		return c.JSON(result)
+	})
+
+	// Get the metadata revision history of a track
+	app.Get("/tracks/:id/revisions", requireAuth, func(c *fiber.Ctx) error {
+		revisions, err := service.GetRevisions(c.Params("id"))
+		if err != nil {
+			return revisionErrorResponse(c, err, "Failed to get revisions")
+		}
+
+		return c.JSON(revisions)
+	})
+
+	// Undo the changes made in a revision
+	app.Post("/tracks/:id/revisions/:rev/revert", requireAuth, func(c *fiber.Ctx) error {
+		editorID, _ := middleware.GetUserID(c)
+
+		rev, err := strconv.Atoi(c.Params("rev"))
+		if err != nil || rev < 1 {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid revision",
 			})
 		}
 
+		updated, err := service.RevertRevision(c.Params("id"), rev, editorID)
+		if err != nil {
+			return revisionErrorResponse(c, err, "Failed to revert revision")
+		}
+
 		return c.JSON(updated)
 	})
 
-	// Delete track
+	// Delete track (moves it to the trash; files are removed when the trash is purged)
 	app.Delete("/tracks/:id", func(c *fiber.Ctx) error {
 		id := c.Params("id")
 
-		// Delete from database and get track info for file cleanup
-		track, err := service.DeleteTrack(id)
-		if err != nil {
+		if _, err := service.DeleteTrack(id); err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return c.Status(404).JSON(fiber.Map{
+					"error": "Track not found",
+				})
+			}
 			return c.Status(500).JSON(fiber.Map{
 				"error": "Failed to delete track",
 			})
 		}
 
-		// Delete associated files
-		if track.FilePath != "" {
-			if err := storageService.DeleteFile(track.FilePath); err != nil {
-				log.Printf("Failed to delete audio file: %v", err)
-			}
-		}
-
 		return c.SendStatus(204)
 	})
 
@@ -314,6 +390,24 @@ func RegisterRoutesWithAnalytics(app *fiber.App, service *MusicService, storageS
 		return c.JSON(tracks)
 	})
 
+	app.Get("/analytics/liked", func(c *fiber.Ctx) error {
+		limit := 10 // Default limit
+		if limitParam := c.Query("limit"); limitParam != "" {
+			if parsedLimit, err := strconv.Atoi(limitParam); err == nil {
+				limit = parsedLimit
+			}
+		}
+
+		tracks, err := service.GetMostLikedTracks(limit)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error": "Failed to get most liked tracks",
+			})
+		}
+
+		return c.JSON(tracks)
+	})
+
 	app.Get("/analytics/recent", func(c *fiber.Ctx) error {
 		limit := 10 // Default limit
 		if limitParam := c.Query("limit"); limitParam != "" {
@@ -364,8 +458,67 @@ func RegisterRoutesWithAnalytics(app *fiber.App, service *MusicService, storageS
 					stats["total_users"] = count
 				}
 			}
+			if analyticsServices.LikeService != nil {
+				if count, err := analyticsServices.LikeService.GetTotalLikeCount(); err == nil {
+					stats["total_likes"] = count
+				}
+			}
 		}
 
 		return c.JSON(stats)
 	})
 }
+
+// parseTrackListQuery builds a query from ?q=, ?sort= and ?limit=. The sort and limit
+// parameters override ORDER BY and LIMIT in q.
+func parseTrackListQuery(c *fiber.Ctx) (*Query, error) {
+	query := &Query{}
+	if text := c.Query("q"); text != "" {
+		parsed, err := ParseQuery(text)
+		if err != nil {
+			return nil, err
+		}
+		query = parsed
+	}
+
+	if sortParam := c.Query("sort"); sortParam != "" {
+		query.Sort = nil
+		for _, field := range strings.Split(sortParam, ",") {
+			field = strings.TrimSpace(field)
+			desc := strings.HasPrefix(field, "-")
+			query.Sort = append(query.Sort, SortField{Field: strings.TrimPrefix(field, "-"), Desc: desc})
+		}
+	}
+
+	if limitParam := c.Query("limit"); limitParam != "" {
+		limit, err := strconv.Atoi(limitParam)
+		if err != nil || limit < 1 {
+			return nil, &QueryError{Position: -1, Message: "limit must be a positive number"}
+		}
+		query.Limit = limit
+	}
+
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+	return query, nil
+}
+
+// revisionErrorResponse maps metadata edit errors to HTTP status codes
+func revisionErrorResponse(c *fiber.Ctx, err error, fallback string) error {
+	var validationErrs validation.Errors
+	switch {
+	case errors.As(err, &validationErrs):
+		return validation.Response(c, validationErrs)
+	case errors.Is(err, primitive.ErrInvalidHex):
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid track ID"})
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return c.Status(404).JSON(fiber.Map{"error": "Track or revision not found"})
+	case errors.Is(err, ErrRevisionConflict):
+		return c.Status(409).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, ErrNothingToRevert):
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	default:
+		return c.Status(500).JSON(fiber.Map{"error": fallback})
+	}
+}
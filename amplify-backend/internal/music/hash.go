@@ -0,0 +1,61 @@
+package music
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ContentHash identifies a recording independently of its database ID, so catalog imports and
+// playlist imports can match tracks across deployments. It covers the normalized title and
+// artist and the duration in whole seconds.
+func ContentHash(title, artist string, duration int) string {
+	normalized := normalizeForHash(title) + "\x1f" + normalizeForHash(artist) + "\x1f" + strconv.Itoa(duration)
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:16])
+}
+
+// normalizeForHash lowercases and collapses whitespace
+func normalizeForHash(value string) string {
+	return strings.Join(strings.Fields(strings.ToLower(value)), " ")
+}
+
+// contentHashAfter returns the content hash a track document will have once the changes are applied,
+// and whether it differs from the stored one
+func contentHashAfter(doc bson.M, changes []FieldChange) (string, bool) {
+	values := bson.M{
+		"title":    doc["title"],
+		"artist":   doc["artist"],
+		"duration": doc["duration"],
+	}
+	for _, change := range changes {
+		if _, ok := values[change.Field]; ok {
+			values[change.Field] = change.New
+		}
+	}
+
+	title, _ := values["title"].(string)
+	artist, _ := values["artist"].(string)
+	hash := ContentHash(title, artist, toInt(values["duration"]))
+
+	stored, _ := doc["content_hash"].(string)
+	return hash, hash != stored
+}
+
+func toInt(value interface{}) int {
+	switch v := value.(type) {
+	case int:
+		return v
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	case float64:
+		return int(v)
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,31 @@
+package music
+
+import (
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TrackListener is told when a track moves into or out of the trash or is purged, so services
+// holding references to tracks (playlists, likes, reviews, lyrics) can keep them consistent
+type TrackListener interface {
+	TrackTrashed(trackID primitive.ObjectID, deletedAt time.Time) error
+	TrackRestored(trackID primitive.ObjectID) error
+	TrackPurged(trackID primitive.ObjectID) error
+}
+
+// AddTrackListener registers a listener for track lifecycle events
+func (s *MusicService) AddTrackListener(listener TrackListener) {
+	s.listeners = append(s.listeners, listener)
+}
+
+// notifyListeners calls every listener. Failures are logged rather than returned: the track change
+// has already been committed and the consistency checker repairs anything left behind.
+func (s *MusicService) notifyListeners(event string, trackID primitive.ObjectID, call func(TrackListener) error) {
+	for _, listener := range s.listeners {
+		if err := call(listener); err != nil {
+			log.Printf("Track %s listener failed for %s: %v", event, trackID.Hex(), err)
+		}
+	}
+}
@@ -24,6 +24,9 @@ type Track struct {
 	// Album art
 	AlbumArtURL  string `bson:"album_art_url,omitempty" json:"album_art_url,omitempty"` // Stored in DB and returned in API
 
+	// Hash of normalized title, artist and duration (see ContentHash)
+	ContentHash string `bson:"content_hash,omitempty" json:"content_hash,omitempty"`
+
 	// Legacy support for external URLs
 	URL string `bson:"url,omitempty" json:"url,omitempty"` // External URL (optional)
 
@@ -31,6 +34,15 @@ type Track struct {
 	CreatedAt  time.Time  `bson:"created_at" json:"created_at"`
 	UpdatedAt  time.Time  `bson:"updated_at" json:"updated_at"`
 	PlayCount  int        `bson:"play_count" json:"play_count"`
+	LikeCount  int        `bson:"like_count" json:"like_count"` // Maintained by the like service
+
+	// Ratings (maintained by the review service)
+	AverageRating float64 `bson:"average_rating" json:"average_rating"`
+	RatingCount   int     `bson:"rating_count" json:"rating_count"`
 	LastPlayed *time.Time `bson:"last_played,omitempty" json:"last_played,omitempty"`
+	Revision   int        `bson:"revision" json:"revision"` // Incremented on every metadata edit
+
+	// Trash (set while the track is soft-deleted)
+	DeletedAt *time.Time `bson:"deleted_at,omitempty" json:"deleted_at,omitempty"`
 }
 	
\ No newline at end of file
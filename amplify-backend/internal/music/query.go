@@ -0,0 +1,789 @@
+package music
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Track queries filter and sort the catalog with a small grammar shared by GET /tracks?q=
+// and smart playlists, for example:
+//
+//	genre = Lo-fi AND year >= 2020 ORDER BY play_count DESC LIMIT 50
+//	created_at WITHIN 30d
+//	(artist = "Nujabes" OR artist IN (Tomppabeats, "J Dilla")) AND NOT title ~ remix
+//
+// Comparisons are =, !=, >, >=, <, <=, ~ (contains), IN (...) and WITHIN <n>d|h|w.
+// Strings compare case-insensitively. Times accept YYYY-MM-DD or RFC 3339.
+
+// Query limits
+const (
+	DefaultQueryLimit = 100
+	MaxQueryLimit     = 1000
+	maxRuleDepth      = 8
+	maxRuleCount      = 50
+)
+
+// Rule operators
+const (
+	OpAnd      = "and"
+	OpOr       = "or"
+	OpNot      = "not"
+	OpEq       = "eq"
+	OpNe       = "ne"
+	OpGt       = "gt"
+	OpGte      = "gte"
+	OpLt       = "lt"
+	OpLte      = "lte"
+	OpContains = "contains"
+	OpIn       = "in"
+	OpWithin   = "within"
+)
+
+var ErrInvalidQuery = errors.New("invalid track query")
+
+// QueryError describes why a query could not be parsed or validated
+type QueryError struct {
+	Position int // Byte offset in the query text, -1 for rule trees
+	Message  string
+}
+
+func (e *QueryError) Error() string {
+	if e.Position < 0 {
+		return e.Message
+	}
+	return fmt.Sprintf("%s (at position %d)", e.Message, e.Position)
+}
+
+func (e *QueryError) Unwrap() error {
+	return ErrInvalidQuery
+}
+
+type fieldType int
+
+const (
+	fieldString fieldType = iota
+	fieldInt
+	fieldFloat
+	fieldTime
+)
+
+// queryFields are the track fields that can be filtered and sorted on
+var queryFields = map[string]fieldType{
+	"title":          fieldString,
+	"artist":         fieldString,
+	"album":          fieldString,
+	"genre":          fieldString,
+	"year":           fieldInt,
+	"duration":       fieldInt,
+	"play_count":     fieldInt,
+	"like_count":     fieldInt,
+	"rating_count":   fieldInt,
+	"average_rating": fieldFloat,
+	"created_at":     fieldTime,
+	"updated_at":     fieldTime,
+	"last_played":    fieldTime,
+}
+
+// Rule is a node of a query's filter tree: a boolean combination (and, or, not) of Rules,
+// or a comparison of a field with a value
+type Rule struct {
+	Op    string      `bson:"op" json:"op"`
+	Field string      `bson:"field,omitempty" json:"field,omitempty"`
+	Value interface{} `bson:"value,omitempty" json:"value,omitempty"`
+	Rules []Rule      `bson:"rules,omitempty" json:"rules,omitempty"`
+}
+
+// SortField orders query results
+type SortField struct {
+	Field string `bson:"field" json:"field"`
+	Desc  bool   `bson:"desc,omitempty" json:"desc,omitempty"`
+}
+
+// Query is a parsed track query: an optional filter, sort order and limit
+type Query struct {
+	Filter *Rule       `bson:"filter,omitempty" json:"filter,omitempty"`
+	Sort   []SortField `bson:"sort,omitempty" json:"sort,omitempty"`
+	Limit  int         `bson:"limit,omitempty" json:"limit,omitempty"`
+}
+
+// ParseQuery parses query text into a validated Query
+func ParseQuery(text string) (*Query, error) {
+	tokens, err := tokenize(text)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &queryParser{tokens: tokens}
+	query := &Query{}
+
+	if !p.atKeyword("ORDER") && !p.atKeyword("LIMIT") && !p.done() {
+		filter, err := p.parseOr(0)
+		if err != nil {
+			return nil, err
+		}
+		query.Filter = filter
+	}
+
+	if p.atKeyword("ORDER") {
+		p.next()
+		if !p.atKeyword("BY") {
+			return nil, p.errorf("expected BY after ORDER")
+		}
+		p.next()
+		for {
+			tok := p.next()
+			if tok.kind != tokenWord {
+				return nil, p.errorAt(tok, "expected a field to sort by")
+			}
+			sort := SortField{Field: strings.ToLower(tok.text)}
+			if p.atKeyword("DESC") {
+				p.next()
+				sort.Desc = true
+			} else if p.atKeyword("ASC") {
+				p.next()
+			}
+			query.Sort = append(query.Sort, sort)
+
+			if p.peek().kind != tokenComma {
+				break
+			}
+			p.next()
+		}
+	}
+
+	if p.atKeyword("LIMIT") {
+		p.next()
+		tok := p.next()
+		limit, err := strconv.Atoi(tok.text)
+		if tok.kind != tokenWord || err != nil {
+			return nil, p.errorAt(tok, "expected a number after LIMIT")
+		}
+		query.Limit = limit
+	}
+
+	if !p.done() {
+		return nil, p.errorAt(p.peek(), fmt.Sprintf("unexpected %q", p.peek().text))
+	}
+
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+	return query, nil
+}
+
+// Validate checks fields, operators and values, and normalizes values to their field types.
+// Rule trees submitted as JSON go through the same checks as parsed text.
+func (q *Query) Validate() error {
+	if q.Filter != nil {
+		count := 0
+		if err := q.Filter.validate(0, &count); err != nil {
+			return err
+		}
+	}
+
+	for _, sort := range q.Sort {
+		if _, ok := queryFields[sort.Field]; !ok {
+			return &QueryError{Position: -1, Message: fmt.Sprintf("cannot sort by %q", sort.Field)}
+		}
+	}
+
+	if q.Limit < 0 || q.Limit > MaxQueryLimit {
+		return &QueryError{Position: -1, Message: fmt.Sprintf("limit must be between 1 and %d", MaxQueryLimit)}
+	}
+
+	return nil
+}
+
+func (r *Rule) validate(depth int, count *int) error {
+	*count++
+	if depth > maxRuleDepth || *count > maxRuleCount {
+		return &QueryError{Position: -1, Message: "query is too complex"}
+	}
+
+	switch r.Op {
+	case OpAnd, OpOr:
+		if len(r.Rules) == 0 {
+			return &QueryError{Position: -1, Message: r.Op + " needs at least one rule"}
+		}
+		for i := range r.Rules {
+			if err := r.Rules[i].validate(depth+1, count); err != nil {
+				return err
+			}
+		}
+		return nil
+	case OpNot:
+		if len(r.Rules) != 1 {
+			return &QueryError{Position: -1, Message: "not needs exactly one rule"}
+		}
+		return r.Rules[0].validate(depth+1, count)
+	}
+
+	kind, ok := queryFields[r.Field]
+	if !ok {
+		return &QueryError{Position: -1, Message: fmt.Sprintf("unknown field %q", r.Field)}
+	}
+
+	invalid := func(message string) error {
+		return &QueryError{Position: -1, Message: fmt.Sprintf("%s: %s", r.Field, message)}
+	}
+
+	switch r.Op {
+	case OpEq, OpNe:
+	case OpGt, OpGte, OpLt, OpLte:
+		if kind == fieldString {
+			return invalid("text fields support =, !=, ~ and IN")
+		}
+	case OpContains:
+		if kind != fieldString {
+			return invalid("~ only applies to text fields")
+		}
+	case OpWithin:
+		if kind != fieldTime {
+			return invalid("WITHIN only applies to dates")
+		}
+		text, _ := r.Value.(string)
+		if _, err := parseWindow(text); err != nil {
+			return invalid(err.Error())
+		}
+		return nil
+	case OpIn:
+		values, ok := toList(r.Value)
+		if !ok || len(values) == 0 {
+			return invalid("IN needs a list of values")
+		}
+		for i, value := range values {
+			normalized, err := coerceQueryValue(kind, value)
+			if err != nil {
+				return invalid(err.Error())
+			}
+			values[i] = normalized
+		}
+		r.Value = values
+		return nil
+	default:
+		return &QueryError{Position: -1, Message: fmt.Sprintf("unknown operator %q", r.Op)}
+	}
+
+	normalized, err := coerceQueryValue(kind, r.Value)
+	if err != nil {
+		return invalid(err.Error())
+	}
+	r.Value = normalized
+	return nil
+}
+
+func toList(value interface{}) ([]interface{}, bool) {
+	switch v := value.(type) {
+	case []interface{}:
+		return v, true
+	case bson.A:
+		return v, true
+	}
+	return nil, false
+}
+
+// coerceQueryValue converts a value to the representation stored for its field type:
+// strings for text and dates, int64 for whole numbers and float64 for ratings
+func coerceQueryValue(kind fieldType, value interface{}) (interface{}, error) {
+	switch kind {
+	case fieldString:
+		if s, ok := value.(string); ok {
+			return s, nil
+		}
+		return nil, errors.New("expected text")
+
+	case fieldInt:
+		switch v := value.(type) {
+		case int:
+			return int64(v), nil
+		case int32:
+			return int64(v), nil
+		case int64:
+			return v, nil
+		case float64:
+			if v == float64(int64(v)) {
+				return int64(v), nil
+			}
+		case string:
+			if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+				return n, nil
+			}
+		}
+		return nil, errors.New("expected a whole number")
+
+	case fieldFloat:
+		switch v := value.(type) {
+		case int:
+			return float64(v), nil
+		case int32:
+			return float64(v), nil
+		case int64:
+			return float64(v), nil
+		case float64:
+			return v, nil
+		case string:
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				return f, nil
+			}
+		}
+		return nil, errors.New("expected a number")
+
+	case fieldTime:
+		if s, ok := value.(string); ok {
+			if _, err := parseQueryTime(s); err == nil {
+				return s, nil
+			}
+		}
+		return nil, errors.New("expected a date (YYYY-MM-DD or RFC 3339)")
+	}
+
+	return nil, errors.New("unsupported field")
+}
+
+func parseQueryTime(value string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// parseWindow parses a WITHIN duration such as 30d, 12h or 2w
+func parseWindow(value string) (time.Duration, error) {
+	if len(value) < 2 {
+		return 0, errors.New("expected a duration like 30d, 12h or 2w")
+	}
+
+	n, err := strconv.Atoi(value[:len(value)-1])
+	if err != nil || n <= 0 {
+		return 0, errors.New("expected a duration like 30d, 12h or 2w")
+	}
+
+	switch strings.ToLower(value[len(value)-1:]) {
+	case "h":
+		return time.Duration(n) * time.Hour, nil
+	case "d":
+		return time.Duration(n) * 24 * time.Hour, nil
+	case "w":
+		return time.Duration(n) * 7 * 24 * time.Hour, nil
+	}
+	return 0, errors.New("expected a duration like 30d, 12h or 2w")
+}
+
+// Mongo builds the filter for a validated query. Relative dates are resolved against now.
+// Trashed tracks are always excluded.
+func (q *Query) Mongo(now time.Time) bson.M {
+	if q.Filter == nil {
+		return notDeleted(bson.M{})
+	}
+	return bson.M{"$and": bson.A{
+		q.Filter.mongo(now),
+		notDeleted(bson.M{}),
+	}}
+}
+
+func (r *Rule) mongo(now time.Time) bson.M {
+	switch r.Op {
+	case OpAnd, OpOr:
+		parts := make(bson.A, len(r.Rules))
+		for i := range r.Rules {
+			parts[i] = r.Rules[i].mongo(now)
+		}
+		return bson.M{"$" + r.Op: parts}
+	case OpNot:
+		return bson.M{"$nor": bson.A{r.Rules[0].mongo(now)}}
+	}
+
+	kind := queryFields[r.Field]
+	value := func(v interface{}) interface{} {
+		switch kind {
+		case fieldString:
+			return exactMatch(v.(string))
+		case fieldTime:
+			t, _ := parseQueryTime(v.(string))
+			return t
+		}
+		return v
+	}
+
+	switch r.Op {
+	case OpEq:
+		return bson.M{r.Field: value(r.Value)}
+	case OpNe:
+		if kind == fieldString {
+			return bson.M{r.Field: bson.M{"$not": value(r.Value)}}
+		}
+		return bson.M{r.Field: bson.M{"$ne": value(r.Value)}}
+	case OpContains:
+		return bson.M{r.Field: primitive.Regex{Pattern: regexp.QuoteMeta(r.Value.(string)), Options: "i"}}
+	case OpWithin:
+		window, _ := parseWindow(r.Value.(string))
+		return bson.M{r.Field: bson.M{"$gte": now.Add(-window)}}
+	case OpIn:
+		values, _ := toList(r.Value)
+		in := make(bson.A, len(values))
+		for i, v := range values {
+			in[i] = value(v)
+		}
+		return bson.M{r.Field: bson.M{"$in": in}}
+	}
+
+	return bson.M{r.Field: bson.M{"$" + r.Op: value(r.Value)}}
+}
+
+// FindOptions returns the sort and limit. A zero limit uses fallback.
+func (q *Query) FindOptions(fallback int) *options.FindOptions {
+	sort := bson.D{}
+	for _, field := range q.Sort {
+		direction := 1
+		if field.Desc {
+			direction = -1
+		}
+		sort = append(sort, bson.E{Key: field.Field, Value: direction})
+	}
+	// Stable order for equal sort keys
+	sort = append(sort, bson.E{Key: "_id", Value: 1})
+
+	limit := q.Limit
+	if limit == 0 {
+		limit = fallback
+	}
+
+	return options.Find().SetSort(sort).SetLimit(int64(limit))
+}
+
+// FindTracks runs a query. A query without a limit returns up to fallbackLimit tracks.
+func (s *MusicService) FindTracks(q *Query, fallbackLimit int) ([]Track, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := s.TrackCollection.Find(ctx, q.Mongo(time.Now()), q.FindOptions(fallbackLimit))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	tracks := []Track{}
+	if err := cursor.All(ctx, &tracks); err != nil {
+		return nil, err
+	}
+
+	return tracks, nil
+}
+
+// String renders the query back into the text grammar
+func (q *Query) String() string {
+	var parts []string
+	if q.Filter != nil {
+		parts = append(parts, q.Filter.String())
+	}
+	if len(q.Sort) > 0 {
+		fields := make([]string, len(q.Sort))
+		for i, field := range q.Sort {
+			fields[i] = field.Field
+			if field.Desc {
+				fields[i] += " DESC"
+			}
+		}
+		parts = append(parts, "ORDER BY "+strings.Join(fields, ", "))
+	}
+	if q.Limit > 0 {
+		parts = append(parts, "LIMIT "+strconv.Itoa(q.Limit))
+	}
+	return strings.Join(parts, " ")
+}
+
+var ruleSymbols = map[string]string{
+	OpEq: "=", OpNe: "!=", OpGt: ">", OpGte: ">=", OpLt: "<", OpLte: "<=", OpContains: "~", OpWithin: "WITHIN",
+}
+
+func (r *Rule) String() string {
+	switch r.Op {
+	case OpAnd, OpOr:
+		parts := make([]string, len(r.Rules))
+		for i := range r.Rules {
+			parts[i] = r.Rules[i].String()
+			if len(r.Rules[i].Rules) > 1 {
+				parts[i] = "(" + parts[i] + ")"
+			}
+		}
+		return strings.Join(parts, " "+strings.ToUpper(r.Op)+" ")
+	case OpNot:
+		inner := r.Rules[0].String()
+		if len(r.Rules[0].Rules) > 1 {
+			inner = "(" + inner + ")"
+		}
+		return "NOT " + inner
+	case OpIn:
+		values, _ := toList(r.Value)
+		parts := make([]string, len(values))
+		for i, v := range values {
+			parts[i] = quoteQueryValue(v)
+		}
+		return r.Field + " IN (" + strings.Join(parts, ", ") + ")"
+	}
+	return r.Field + " " + ruleSymbols[r.Op] + " " + quoteQueryValue(r.Value)
+}
+
+func quoteQueryValue(value interface{}) string {
+	s := fmt.Sprint(value)
+	if _, ok := value.(string); !ok {
+		return s
+	}
+	if s == "" || strings.ContainsAny(s, " \t\"(),=!<>~") || isKeyword(s) {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// Tokenizer and recursive-descent parser for the text grammar
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenWord
+	tokenString
+	tokenOp
+	tokenLParen
+	tokenRParen
+	tokenComma
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+var queryKeywords = map[string]bool{
+	"AND": true, "OR": true, "NOT": true, "IN": true, "WITHIN": true,
+	"ORDER": true, "BY": true, "LIMIT": true, "ASC": true, "DESC": true,
+}
+
+func isKeyword(word string) bool {
+	return queryKeywords[strings.ToUpper(word)]
+}
+
+func tokenize(text string) ([]token, error) {
+	var tokens []token
+	i := 0
+	for i < len(text) {
+		c := rune(text[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(':
+			tokens = append(tokens, token{tokenLParen, "(", i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{tokenRParen, ")", i})
+			i++
+		case c == ',':
+			tokens = append(tokens, token{tokenComma, ",", i})
+			i++
+		case strings.ContainsRune("=!<>~", c):
+			start := i
+			i++
+			if i < len(text) && text[i] == '=' && c != '=' && c != '~' {
+				i++
+			}
+			op := text[start:i]
+			if op == "!" {
+				return nil, &QueryError{Position: start, Message: "expected != "}
+			}
+			tokens = append(tokens, token{tokenOp, op, start})
+		case c == '"':
+			start := i
+			var sb strings.Builder
+			i++
+			for {
+				if i >= len(text) {
+					return nil, &QueryError{Position: start, Message: "unterminated string"}
+				}
+				if text[i] == '\\' && i+1 < len(text) {
+					sb.WriteByte(text[i+1])
+					i += 2
+					continue
+				}
+				if text[i] == '"' {
+					i++
+					break
+				}
+				sb.WriteByte(text[i])
+				i++
+			}
+			tokens = append(tokens, token{tokenString, sb.String(), start})
+		default:
+			start := i
+			for i < len(text) && !unicode.IsSpace(rune(text[i])) && !strings.ContainsRune("()\",=!<>~", rune(text[i])) {
+				i++
+			}
+			tokens = append(tokens, token{tokenWord, text[start:i], start})
+		}
+	}
+	return append(tokens, token{tokenEOF, "", len(text)}), nil
+}
+
+type queryParser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *queryParser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *queryParser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *queryParser) done() bool {
+	return p.peek().kind == tokenEOF
+}
+
+func (p *queryParser) atKeyword(keyword string) bool {
+	tok := p.peek()
+	return tok.kind == tokenWord && strings.EqualFold(tok.text, keyword)
+}
+
+func (p *queryParser) errorAt(tok token, message string) error {
+	if tok.kind == tokenEOF {
+		message += " at end of query"
+	}
+	return &QueryError{Position: tok.pos, Message: message}
+}
+
+func (p *queryParser) errorf(message string) error {
+	return p.errorAt(p.peek(), message)
+}
+
+func (p *queryParser) parseOr(depth int) (*Rule, error) {
+	return p.parseJoined(depth, "OR", OpOr, p.parseAnd)
+}
+
+func (p *queryParser) parseAnd(depth int) (*Rule, error) {
+	return p.parseJoined(depth, "AND", OpAnd, p.parseUnary)
+}
+
+// parseJoined parses operands separated by keyword and flattens them into one rule
+func (p *queryParser) parseJoined(depth int, keyword, op string, operand func(int) (*Rule, error)) (*Rule, error) {
+	first, err := operand(depth)
+	if err != nil {
+		return nil, err
+	}
+	if !p.atKeyword(keyword) {
+		return first, nil
+	}
+
+	rule := &Rule{Op: op, Rules: []Rule{*first}}
+	for p.atKeyword(keyword) {
+		p.next()
+		next, err := operand(depth)
+		if err != nil {
+			return nil, err
+		}
+		rule.Rules = append(rule.Rules, *next)
+	}
+	return rule, nil
+}
+
+func (p *queryParser) parseUnary(depth int) (*Rule, error) {
+	if depth > maxRuleDepth {
+		return nil, p.errorf("query is nested too deeply")
+	}
+
+	if p.atKeyword("NOT") {
+		p.next()
+		inner, err := p.parseUnary(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return &Rule{Op: OpNot, Rules: []Rule{*inner}}, nil
+	}
+
+	if p.peek().kind == tokenLParen {
+		p.next()
+		inner, err := p.parseOr(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if p.peek().kind != tokenRParen {
+			return nil, p.errorf("expected )")
+		}
+		p.next()
+		return inner, nil
+	}
+
+	return p.parseCondition()
+}
+
+var opSymbols = map[string]string{
+	"=": OpEq, "!=": OpNe, ">": OpGt, ">=": OpGte, "<": OpLt, "<=": OpLte, "~": OpContains,
+}
+
+func (p *queryParser) parseCondition() (*Rule, error) {
+	fieldTok := p.next()
+	if fieldTok.kind != tokenWord || isKeyword(fieldTok.text) {
+		return nil, p.errorAt(fieldTok, "expected a field name")
+	}
+	rule := &Rule{Field: strings.ToLower(fieldTok.text)}
+
+	opTok := p.next()
+	switch {
+	case opTok.kind == tokenOp:
+		rule.Op = opSymbols[opTok.text]
+		if rule.Op == "" {
+			return nil, p.errorAt(opTok, fmt.Sprintf("unknown operator %q", opTok.text))
+		}
+	case opTok.kind == tokenWord && strings.EqualFold(opTok.text, "IN"):
+		rule.Op = OpIn
+		if p.peek().kind != tokenLParen {
+			return nil, p.errorf("expected ( after IN")
+		}
+		p.next()
+		var values []interface{}
+		for {
+			valueTok := p.next()
+			if valueTok.kind != tokenWord && valueTok.kind != tokenString {
+				return nil, p.errorAt(valueTok, "expected a value")
+			}
+			values = append(values, valueTok.text)
+			if p.peek().kind == tokenComma {
+				p.next()
+				continue
+			}
+			if p.peek().kind != tokenRParen {
+				return nil, p.errorf("expected , or )")
+			}
+			p.next()
+			break
+		}
+		rule.Value = values
+		return rule, nil
+	case opTok.kind == tokenWord && strings.EqualFold(opTok.text, "WITHIN"):
+		rule.Op = OpWithin
+	default:
+		return nil, p.errorAt(opTok, "expected a comparison operator")
+	}
+
+	valueTok := p.next()
+	if valueTok.kind != tokenWord && valueTok.kind != tokenString {
+		return nil, p.errorAt(valueTok, "expected a value")
+	}
+	rule.Value = valueTok.text
+	return rule, nil
+}
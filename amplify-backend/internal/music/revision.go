@@ -0,0 +1,250 @@
+package music
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	// ErrRevisionConflict is returned when the track changed while an edit was being applied
+	ErrRevisionConflict = errors.New("track was modified concurrently")
+	// ErrNothingToRevert is returned when a revision has no field changes to undo
+	ErrNothingToRevert = errors.New("revision has no changes to revert")
+)
+
+// TrackRevision records one metadata change of a track
+type TrackRevision struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	TrackID   primitive.ObjectID `bson:"track_id" json:"track_id"`
+	Revision  int                `bson:"revision" json:"revision"`
+	EditorID  string             `bson:"editor_id" json:"editor_id"` // Supabase User ID
+	Changes   []FieldChange      `bson:"changes" json:"changes"`
+	RevertOf  *int               `bson:"revert_of,omitempty" json:"revert_of,omitempty"` // Revision undone by this one
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// FieldChange is the old and new value of a single field. A nil value means the field was unset.
+type FieldChange struct {
+	Field string      `bson:"field" json:"field"`
+	Old   interface{} `bson:"old" json:"old"`
+	New   interface{} `bson:"new" json:"new"`
+}
+
+// applyTrackUpdate sets and unsets fields on a track and records the change as a new revision
+// Fields whose value does not change are left out; if nothing changes no revision is written
+func (s *MusicService) applyTrackUpdate(id string, set bson.M, unset []string, editorID string, revertOf *int) (*Track, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var current bson.M
+	if err := s.TrackCollection.FindOne(ctx, notDeleted(bson.M{"_id": objectID})).Decode(&current); err != nil {
+		return nil, err
+	}
+
+	changes := diffFields(current, set, unset)
+	if len(changes) == 0 {
+		return s.GetTrackByID(id)
+	}
+
+	currentRevision := revisionOf(current)
+	now := time.Now()
+
+	// Only apply the edit if nobody else changed the track since we read it
+	filter := revisionFilter(objectID, currentRevision)
+	update := revisionUpdate(current, changes, now)
+
+	// The track and its revision are written together, so no revision goes missing from the
+	// history if one of the writes fails
+	session, err := s.TrackCollection.Database().Client().StartSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		res, err := s.TrackCollection.UpdateOne(sc, filter, update)
+		if err != nil {
+			return nil, err
+		}
+		if res.MatchedCount == 0 {
+			return nil, ErrRevisionConflict
+		}
+
+		return s.RevisionCollection.InsertOne(sc, TrackRevision{
+			TrackID:   objectID,
+			Revision:  currentRevision + 1,
+			EditorID:  editorID,
+			Changes:   changes,
+			RevertOf:  revertOf,
+			CreatedAt: now,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetTrackByID(id)
+}
+
+// revisionFilter matches a live track at the given revision (legacy tracks have no revision field)
+func revisionFilter(id primitive.ObjectID, revision int) bson.M {
+	filter := notDeleted(bson.M{"_id": id})
+	if revision == 0 {
+		filter["revision"] = bson.M{"$in": bson.A{0, nil}}
+	} else {
+		filter["revision"] = revision
+	}
+	return filter
+}
+
+// revisionUpdate builds the Mongo update that applies the changes to doc and bumps the revision
+// The content hash is kept in step with the title, artist and duration
+func revisionUpdate(doc bson.M, changes []FieldChange, now time.Time) bson.M {
+	set := bson.M{"updated_at": now}
+	if hash, changed := contentHashAfter(doc, changes); changed {
+		set["content_hash"] = hash
+	}
+	unset := bson.M{}
+	for _, change := range changes {
+		if change.New == nil {
+			unset[change.Field] = ""
+		} else {
+			set[change.Field] = change.New
+		}
+	}
+
+	update := bson.M{
+		"$set": set,
+		"$inc": bson.M{"revision": 1},
+	}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	return update
+}
+
+// GetRevisions returns the revision history of a track, newest first
+func (s *MusicService) GetRevisions(trackID string) ([]TrackRevision, error) {
+	objectID, err := primitive.ObjectIDFromHex(trackID)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := s.RevisionCollection.Find(
+		ctx,
+		bson.M{"track_id": objectID},
+		options.Find().SetSort(bson.D{{Key: "revision", Value: -1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	revisions := []TrackRevision{}
+	if err := cursor.All(ctx, &revisions); err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
+// RevertRevision undoes the changes made in a revision by restoring their old values
+// The revert is itself recorded as a new revision
+func (s *MusicService) RevertRevision(trackID string, revision int, editorID string) (*Track, error) {
+	objectID, err := primitive.ObjectIDFromHex(trackID)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var rev TrackRevision
+	err = s.RevisionCollection.FindOne(ctx, bson.M{"track_id": objectID, "revision": revision}).Decode(&rev)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rev.Changes) == 0 {
+		return nil, ErrNothingToRevert
+	}
+
+	set := bson.M{}
+	var unset []string
+	for _, change := range rev.Changes {
+		if change.Old == nil {
+			unset = append(unset, change.Field)
+		} else {
+			set[change.Field] = change.Old
+		}
+	}
+
+	return s.applyTrackUpdate(trackID, set, unset, editorID, &revision)
+}
+
+// EnsureIndexes creates the (track_id, revision) index used by the revision history
+func (s *MusicService) EnsureIndexes() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := s.RevisionCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "track_id", Value: 1}, {Key: "revision", Value: -1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+// diffFields compares requested values against the current document
+func diffFields(current bson.M, set bson.M, unset []string) []FieldChange {
+	fields := make([]string, 0, len(set))
+	for field := range set {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	var changes []FieldChange
+	for _, field := range fields {
+		oldValue := current[field]
+		if !sameValue(oldValue, set[field]) {
+			changes = append(changes, FieldChange{Field: field, Old: oldValue, New: set[field]})
+		}
+	}
+
+	for _, field := range unset {
+		if oldValue, ok := current[field]; ok && oldValue != nil {
+			changes = append(changes, FieldChange{Field: field, Old: oldValue, New: nil})
+		}
+	}
+
+	return changes
+}
+
+// sameValue compares values by their JSON form so 2020, int32(2020) and 2020.0 are equal
+func sameValue(a, b interface{}) bool {
+	aJSON, errA := json.Marshal(a)
+	bJSON, errB := json.Marshal(b)
+	if errA != nil || errB != nil {
+		return false
+	}
+	return string(aJSON) == string(bJSON)
+}
+
+func revisionOf(doc bson.M) int {
+	return toInt(doc["revision"])
+}
@@ -2,6 +2,7 @@ package music
 
 import (
 	"context"
+	"log"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -11,19 +12,32 @@ import (
 )
 
 type MusicService struct {
-	TrackCollection *mongo.Collection
+	TrackCollection    *mongo.Collection
+	RevisionCollection *mongo.Collection
+
+	// Notified when tracks are trashed, restored or purged (see lifecycle.go)
+	listeners []TrackListener
 }
 
 func NewMusicService(db *mongo.Database) *MusicService {
 	return &MusicService{
-		TrackCollection: db.Collection("tracks"),
+		TrackCollection:    db.Collection("tracks"),
+		RevisionCollection: db.Collection("track_revisions"),
 	}
 }
 
+// notDeleted matches tracks that are not in the trash
+func notDeleted(filter bson.M) bson.M {
+	filter["deleted_at"] = bson.M{"$exists": false}
+	return filter
+}
+
 func (s *MusicService) AddTrack(t Track) (*Track, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	t.ContentHash = ContentHash(t.Title, t.Artist, t.Duration)
+
 	res, err := s.TrackCollection.InsertOne(ctx, t)
 	if err != nil {
 		return nil, err
@@ -36,7 +50,7 @@ func (s *MusicService) GetAllTracks() ([]Track, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	cursor, err := s.TrackCollection.Find(ctx, bson.M{})
+	cursor, err := s.TrackCollection.Find(ctx, notDeleted(bson.M{}))
 	if err != nil {
 		return nil, err
 	}
@@ -61,7 +75,7 @@ func (s *MusicService) GetTrackByID(id string) (*Track, error) {
 	defer cancel()
 
 	var track Track
-	err = s.TrackCollection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&track)
+	err = s.TrackCollection.FindOne(ctx, notDeleted(bson.M{"_id": objectID})).Decode(&track)
 	if err != nil {
 		return nil, err
 	}
@@ -69,8 +83,20 @@ func (s *MusicService) GetTrackByID(id string) (*Track, error) {
 	return &track, nil
 }
 
-// UpdateTrack updates track metadata
-func (s *MusicService) UpdateTrack(id string, updates bson.M) (*Track, error) {
+// UpdateTrack validates and applies a metadata update and records it as a revision
+func (s *MusicService) UpdateTrack(id string, update TrackUpdate, editorID string) (*Track, error) {
+	if errs := update.Validate(); len(errs) > 0 {
+		return nil, errs
+	}
+
+	set, unset := update.Fields()
+
+	// Note: GetTrackByID already populates AlbumArtURL
+	return s.applyTrackUpdate(id, set, unset, editorID, nil)
+}
+
+// DeleteTrack moves a track to the trash. Files are kept until the track is purged.
+func (s *MusicService) DeleteTrack(id string) (*Track, error) {
 	objectID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
 		return nil, err
@@ -79,29 +105,81 @@ func (s *MusicService) UpdateTrack(id string, updates bson.M) (*Track, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	updates["updated_at"] = time.Now()
+	var track Track
+	now := time.Now()
+	err = s.TrackCollection.FindOneAndUpdate(
+		ctx,
+		notDeleted(bson.M{"_id": objectID}),
+		bson.M{"$set": bson.M{"deleted_at": now}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&track)
+	if err != nil {
+		return nil, err
+	}
 
-	_, err = s.TrackCollection.UpdateOne(
+	s.notifyListeners("trashed", objectID, func(l TrackListener) error {
+		return l.TrackTrashed(objectID, now)
+	})
+
+	return &track, nil
+}
+
+// GetDeletedTracks returns the tracks in the trash, most recently deleted first
+func (s *MusicService) GetDeletedTracks() ([]Track, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := s.TrackCollection.Find(
 		ctx,
-		bson.M{"_id": objectID},
-		bson.M{"$set": updates},
+		bson.M{"deleted_at": bson.M{"$exists": true}},
+		options.Find().SetSort(bson.D{{Key: "deleted_at", Value: -1}}),
 	)
 	if err != nil {
 		return nil, err
 	}
+	defer cursor.Close(ctx)
 
-	// Note: GetTrackByID already populates AlbumArtURL
-	return s.GetTrackByID(id)
+	tracks := []Track{}
+	if err := cursor.All(ctx, &tracks); err != nil {
+		return nil, err
+	}
+
+	return tracks, nil
 }
 
-// DeleteTrack removes track from DB and returns the track for file cleanup
-func (s *MusicService) DeleteTrack(id string) (*Track, error) {
-	// First get the track to return file paths for cleanup
-	track, err := s.GetTrackByID(id)
+// RestoreTrack moves a track out of the trash
+func (s *MusicService) RestoreTrack(id string) (*Track, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var track Track
+	err = s.TrackCollection.FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": objectID, "deleted_at": bson.M{"$exists": true}},
+		bson.M{
+			"$unset": bson.M{"deleted_at": ""},
+			"$set":   bson.M{"updated_at": time.Now()},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&track)
 	if err != nil {
 		return nil, err
 	}
 
+	s.notifyListeners("restored", objectID, func(l TrackListener) error {
+		return l.TrackRestored(objectID)
+	})
+
+	return &track, nil
+}
+
+// PurgeTrack permanently removes a trashed track and returns it for file cleanup
+func (s *MusicService) PurgeTrack(id string) (*Track, error) {
 	objectID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
 		return nil, err
@@ -110,12 +188,44 @@ func (s *MusicService) DeleteTrack(id string) (*Track, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	_, err = s.TrackCollection.DeleteOne(ctx, bson.M{"_id": objectID})
+	var track Track
+	err = s.TrackCollection.FindOneAndDelete(
+		ctx,
+		bson.M{"_id": objectID, "deleted_at": bson.M{"$exists": true}},
+	).Decode(&track)
 	if err != nil {
 		return nil, err
 	}
 
-	return track, nil
+	// The history of a track that no longer exists can't be reverted to
+	if _, err := s.RevisionCollection.DeleteMany(ctx, bson.M{"track_id": objectID}); err != nil {
+		log.Printf("Failed to delete revisions of purged track %s: %v", objectID.Hex(), err)
+	}
+
+	s.notifyListeners("purged", objectID, func(l TrackListener) error {
+		return l.TrackPurged(objectID)
+	})
+
+	return &track, nil
+}
+
+// GetExpiredTracks returns trashed tracks deleted before the cutoff
+func (s *MusicService) GetExpiredTracks(cutoff time.Time) ([]Track, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := s.TrackCollection.Find(ctx, bson.M{"deleted_at": bson.M{"$lt": cutoff}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	tracks := []Track{}
+	if err := cursor.All(ctx, &tracks); err != nil {
+		return nil, err
+	}
+
+	return tracks, nil
 }
 
 // IncrementPlayCount increments play count and updates last played
@@ -131,7 +241,7 @@ func (s *MusicService) IncrementPlayCount(id string) error {
 	now := time.Now()
 	_, err = s.TrackCollection.UpdateOne(
 		ctx,
-		bson.M{"_id": objectID},
+		notDeleted(bson.M{"_id": objectID}),
 		bson.M{
 			"$inc": bson.M{"play_count": 1},
 			"$set": bson.M{"last_played": now},
@@ -147,7 +257,7 @@ func (s *MusicService) GetPopularTracks(limit int) ([]Track, error) {
 
 	cursor, err := s.TrackCollection.Find(
 		ctx,
-		bson.M{},
+		notDeleted(bson.M{}),
 		options.Find().SetSort(bson.D{{Key: "play_count", Value: -1}}).SetLimit(int64(limit)),
 	)
 	if err != nil {
@@ -163,6 +273,29 @@ func (s *MusicService) GetPopularTracks(limit int) ([]Track, error) {
 	return tracks, nil
 }
 
+// GetMostLikedTracks returns the tracks with the most likes
+func (s *MusicService) GetMostLikedTracks(limit int) ([]Track, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := s.TrackCollection.Find(
+		ctx,
+		notDeleted(bson.M{"like_count": bson.M{"$gt": 0}}),
+		options.Find().SetSort(bson.D{{Key: "like_count", Value: -1}}).SetLimit(int64(limit)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var tracks []Track
+	if err := cursor.All(ctx, &tracks); err != nil {
+		return nil, err
+	}
+
+	return tracks, nil
+}
+
 // GetRecentTracks returns recently added tracks
 func (s *MusicService) GetRecentTracks(limit int) ([]Track, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -170,7 +303,7 @@ func (s *MusicService) GetRecentTracks(limit int) ([]Track, error) {
 
 	cursor, err := s.TrackCollection.Find(
 		ctx,
-		bson.M{},
+		notDeleted(bson.M{}),
 		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(int64(limit)),
 	)
 	if err != nil {
@@ -191,7 +324,7 @@ func (s *MusicService) GetTotalTrackCount() (int64, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	count, err := s.TrackCollection.CountDocuments(ctx, bson.M{})
+	count, err := s.TrackCollection.CountDocuments(ctx, notDeleted(bson.M{}))
 	return count, err
 }
 
@@ -201,6 +334,9 @@ func (s *MusicService) GetTotalPlayCount() (int64, error) {
 	defer cancel()
 
 	pipeline := []bson.M{
+		{
+			"$match": notDeleted(bson.M{}),
+		},
 		{
 			"$group": bson.M{
 				"_id":   nil,
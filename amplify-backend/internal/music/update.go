@@ -0,0 +1,98 @@
+package music
+
+import (
+	"amplify-backend/internal/validation"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Validation limits for track metadata
+const (
+	MaxTitleLength  = 200
+	MaxArtistLength = 200
+	MaxAlbumLength  = 200
+	MaxGenreLength  = 50
+	MaxURLLength    = 2048
+	MinYear         = 1900
+	MaxDuration     = 24 * 60 * 60 // seconds
+)
+
+// TrackReadOnlyFields are returned by the API but cannot be updated.
+// Clients that send back a whole track object have them ignored instead of rejected.
+var TrackReadOnlyFields = []string{
+	"id", "file_name", "file_size", "mime_type", "url",
+	"created_at", "updated_at", "play_count", "last_played",
+	"like_count", "average_rating", "rating_count", "revision", "deleted_at", "content_hash",
+}
+
+// TrackUpdate is the allowlist of track metadata that can be edited. Nil fields are left unchanged.
+type TrackUpdate struct {
+	Title       *string `json:"title"`
+	Artist      *string `json:"artist"`
+	Album       *string `json:"album"`
+	Genre       *string `json:"genre"`
+	Year        *int    `json:"year"`
+	Duration    *int    `json:"duration"`      // seconds
+	AlbumArtURL *string `json:"album_art_url"` // Empty string removes the album art
+}
+
+// Validate checks every set field and returns all problems at once
+func (u TrackUpdate) Validate() validation.Errors {
+	var errs validation.Errors
+
+	errs.String("title", u.Title, 1, MaxTitleLength)
+	errs.String("artist", u.Artist, 1, MaxArtistLength)
+	errs.String("album", u.Album, 0, MaxAlbumLength)
+	errs.String("genre", u.Genre, 0, MaxGenreLength)
+	errs.IntRange("year", u.Year, MinYear, time.Now().Year()+1)
+	errs.IntRange("duration", u.Duration, 1, MaxDuration)
+	errs.URL("album_art_url", u.AlbumArtURL, MaxURLLength)
+
+	if u.IsEmpty() {
+		errs.Add("", validation.CodeEmpty, "no fields to update")
+	}
+
+	return errs
+}
+
+// IsEmpty reports whether the update sets no fields
+func (u TrackUpdate) IsEmpty() bool {
+	return u.Title == nil && u.Artist == nil && u.Album == nil && u.Genre == nil &&
+		u.Year == nil && u.Duration == nil && u.AlbumArtURL == nil
+}
+
+// Fields converts the update to the Mongo fields to set and to unset
+func (u TrackUpdate) Fields() (bson.M, []string) {
+	set := bson.M{}
+	var unset []string
+
+	if u.Title != nil {
+		set["title"] = strings.TrimSpace(*u.Title)
+	}
+	if u.Artist != nil {
+		set["artist"] = strings.TrimSpace(*u.Artist)
+	}
+	if u.Album != nil {
+		set["album"] = strings.TrimSpace(*u.Album)
+	}
+	if u.Genre != nil {
+		set["genre"] = strings.TrimSpace(*u.Genre)
+	}
+	if u.Year != nil {
+		set["year"] = *u.Year
+	}
+	if u.Duration != nil {
+		set["duration"] = *u.Duration
+	}
+	if u.AlbumArtURL != nil {
+		if albumArt := strings.TrimSpace(*u.AlbumArtURL); albumArt != "" {
+			set["album_art_url"] = albumArt
+		} else {
+			unset = append(unset, "album_art_url")
+		}
+	}
+
+	return set, unset
+}
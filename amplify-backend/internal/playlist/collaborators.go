@@ -0,0 +1,336 @@
+package playlist
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Invite lifetimes
+const (
+	DefaultInviteTTL = 7 * 24 * time.Hour
+	MaxInviteTTL     = 30 * 24 * time.Hour
+)
+
+var (
+	ErrInvalidRole   = errors.New("role must be editor or viewer")
+	ErrInviteInvalid = errors.New("invite is invalid or has expired")
+)
+
+// Notifier delivers real-time playlist events to users (implemented by the WebSocket hub)
+type Notifier interface {
+	NotifyUsers(userIDs []string, messageType string, data interface{})
+}
+
+// PlaylistEvent is sent to the owner and collaborators as "playlist:updated" when a playlist changes
+type PlaylistEvent struct {
+	PlaylistID string    `json:"playlist_id"`
+	Action     string    `json:"action"` // updated, deleted, track_added, track_removed, track_moved, restored, collaborator_added, collaborator_updated, collaborator_removed
+	ActorID    string    `json:"actor_id,omitempty"`
+	TrackID    string    `json:"track_id,omitempty"`
+	EntryIDs   []string  `json:"entry_ids,omitempty"` // Entries affected by a track_* action
+	UserID     string    `json:"user_id,omitempty"`   // Collaborator affected by a collaborator_* action
+	Version    int       `json:"version,omitempty"`
+	Following  bool      `json:"following,omitempty"` // Sent to a follower rather than a member
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// EnsureIndexes creates the collaborator lookup index, the follow and change log indexes and the
+// invite token and expiry indexes
+func (s *PlaylistService) EnsureIndexes() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := s.PlaylistCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "collaborators.user_id", Value: 1}}},
+		{Keys: bson.D{{Key: "created_by", Value: 1}}},
+	}); err != nil {
+		return err
+	}
+
+	if err := s.ensureFollowIndexes(ctx); err != nil {
+		return err
+	}
+	if err := s.ensureHistoryIndexes(ctx); err != nil {
+		return err
+	}
+
+	_, err := s.InviteCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "token_hash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			// Expired invites are removed by MongoDB
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+		{Keys: bson.D{{Key: "playlist_id", Value: 1}}},
+	})
+	return err
+}
+
+// notify sends a playlist event to every member of the playlist, and in the background to its followers
+func (s *PlaylistService) notify(p *Playlist, event PlaylistEvent, extra ...string) {
+	if s.Notifier == nil || p == nil {
+		return
+	}
+
+	event.PlaylistID = p.ID.Hex()
+	if event.UpdatedAt.IsZero() {
+		event.UpdatedAt = p.UpdatedAt
+	}
+
+	s.Notifier.NotifyUsers(append(p.Members(), extra...), "playlist:updated", event)
+	snapshot := *p
+	go s.notifyFollowers(&snapshot, event)
+}
+
+func hashInviteToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func validCollaboratorRole(role string) bool {
+	return role == RoleEditor || role == RoleViewer
+}
+
+// CreateInvite creates an invite link for the playlist. A ttl of 0 uses DefaultInviteTTL.
+func (s *PlaylistService) CreateInvite(playlistID, role, createdBy string, ttl time.Duration) (*Invite, error) {
+	objectID, err := primitive.ObjectIDFromHex(playlistID)
+	if err != nil {
+		return nil, err
+	}
+	if !validCollaboratorRole(role) {
+		return nil, ErrInvalidRole
+	}
+	if ttl <= 0 {
+		ttl = DefaultInviteTTL
+	}
+	if ttl > MaxInviteTTL {
+		ttl = MaxInviteTTL
+	}
+
+	raw := make([]byte, 24)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, err
+	}
+	token := hex.EncodeToString(raw)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	invite := Invite{
+		PlaylistID: objectID,
+		Token:      token,
+		TokenHash:  hashInviteToken(token),
+		Role:       role,
+		CreatedBy:  createdBy,
+		ExpiresAt:  now.Add(ttl),
+		CreatedAt:  now,
+	}
+
+	res, err := s.InviteCollection.InsertOne(ctx, invite)
+	if err != nil {
+		return nil, err
+	}
+
+	invite.ID = res.InsertedID.(primitive.ObjectID)
+	return &invite, nil
+}
+
+// GetInvites returns the playlist's unexpired invites (without tokens)
+func (s *PlaylistService) GetInvites(playlistID string) ([]Invite, error) {
+	objectID, err := primitive.ObjectIDFromHex(playlistID)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := s.InviteCollection.Find(
+		ctx,
+		bson.M{"playlist_id": objectID, "expires_at": bson.M{"$gt": time.Now()}},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	invites := []Invite{}
+	if err := cursor.All(ctx, &invites); err != nil {
+		return nil, err
+	}
+
+	return invites, nil
+}
+
+// RevokeInvite deletes an invite so its link stops working
+func (s *PlaylistService) RevokeInvite(playlistID, inviteID string) error {
+	playlistObjID, err := primitive.ObjectIDFromHex(playlistID)
+	if err != nil {
+		return err
+	}
+	inviteObjID, err := primitive.ObjectIDFromHex(inviteID)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := s.InviteCollection.DeleteOne(ctx, bson.M{"_id": inviteObjID, "playlist_id": playlistObjID})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+// GetInvite looks up an unexpired invite by its token
+func (s *PlaylistService) GetInvite(token string) (*Invite, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var invite Invite
+	err := s.InviteCollection.FindOne(ctx, bson.M{
+		"token_hash": hashInviteToken(token),
+		"expires_at": bson.M{"$gt": time.Now()},
+	}).Decode(&invite)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrInviteInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &invite, nil
+}
+
+// AcceptInvite adds the user as a collaborator with the invite's role. Existing collaborators
+// are only ever upgraded (viewer to editor), and the owner is left unchanged.
+func (s *PlaylistService) AcceptInvite(token, userID string) (*Playlist, error) {
+	invite, err := s.GetInvite(token)
+	if err != nil {
+		return nil, err
+	}
+
+	playlist, err := s.GetPlaylistByID(invite.PlaylistID.Hex())
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrInviteInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	current := playlist.RoleOf(userID)
+	if roleRank[current] >= roleRank[invite.Role] {
+		return playlist, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	filter := notDeleted(bson.M{"_id": playlist.ID})
+	var update bson.M
+	if current == "" {
+		filter["collaborators.user_id"] = bson.M{"$ne": userID}
+		update = bson.M{
+			"$push": bson.M{"collaborators": Collaborator{UserID: userID, Role: invite.Role, AddedAt: now}},
+			"$set":  bson.M{"updated_at": now},
+		}
+	} else {
+		filter["collaborators.user_id"] = userID
+		update = bson.M{"$set": bson.M{"collaborators.$.role": invite.Role, "updated_at": now}}
+	}
+
+	var updated Playlist
+	err = s.PlaylistCollection.FindOneAndUpdate(ctx, filter, update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	if err == mongo.ErrNoDocuments {
+		// Accepted concurrently (e.g. a double click); return the current state
+		return s.GetPlaylistByID(playlist.ID.Hex())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	updated.Entries = normalizeEntries(&updated)
+	s.notify(&updated, PlaylistEvent{Action: "collaborator_added", ActorID: userID, UserID: userID})
+	return &updated, nil
+}
+
+// SetCollaboratorRole changes an existing collaborator's role
+func (s *PlaylistService) SetCollaboratorRole(playlistID, userID, role, actorID string) (*Playlist, error) {
+	objectID, err := primitive.ObjectIDFromHex(playlistID)
+	if err != nil {
+		return nil, err
+	}
+	if !validCollaboratorRole(role) {
+		return nil, ErrInvalidRole
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var updated Playlist
+	err = s.PlaylistCollection.FindOneAndUpdate(
+		ctx,
+		notDeleted(bson.M{"_id": objectID, "collaborators.user_id": userID}),
+		bson.M{"$set": bson.M{"collaborators.$.role": role, "updated_at": time.Now()}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	if err != nil {
+		return nil, err
+	}
+
+	updated.Entries = normalizeEntries(&updated)
+	s.notify(&updated, PlaylistEvent{Action: "collaborator_updated", ActorID: actorID, UserID: userID})
+	return &updated, nil
+}
+
+// RemoveCollaborator removes a collaborator (or lets a collaborator leave)
+func (s *PlaylistService) RemoveCollaborator(playlistID, userID, actorID string) (*Playlist, error) {
+	objectID, err := primitive.ObjectIDFromHex(playlistID)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var updated Playlist
+	err = s.PlaylistCollection.FindOneAndUpdate(
+		ctx,
+		notDeleted(bson.M{"_id": objectID, "collaborators.user_id": userID}),
+		bson.M{
+			"$pull": bson.M{"collaborators": bson.M{"user_id": userID}},
+			"$set":  bson.M{"updated_at": time.Now()},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	if err != nil {
+		return nil, err
+	}
+
+	updated.Entries = normalizeEntries(&updated)
+	// The removed user is no longer a member but should still hear about it
+	s.notify(&updated, PlaylistEvent{Action: "collaborator_removed", ActorID: actorID, UserID: userID}, userID)
+	return &updated, nil
+}
@@ -0,0 +1,538 @@
+package playlist
+
+import (
+	"amplify-backend/internal/music"
+	"amplify-backend/internal/storage"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	_ "image/png" // Album art may be PNG
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Generated cover settings
+const (
+	coverSize         = 640
+	coverTiles        = 4
+	coverScanEntries  = 100 // Entries looked at when picking albums
+	maxArtworkBytes   = 10 * 1024 * 1024
+	maxArtworkPixels  = 4096 * 4096 // Decoded size limit, checked before decoding
+	coverFetchTimeout = 10 * time.Second
+)
+
+// MaxCoverImageSize limits uploaded cover images
+const MaxCoverImageSize = 10 * 1024 * 1024
+
+var ErrStorageUnavailable = errors.New("image storage is not configured")
+
+var errArtworkHost = errors.New("album art is not served by the image storage")
+
+var artworkClient = &http.Client{
+	Timeout: coverFetchTimeout,
+	// A redirect could leave the storage host
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// hasCustomCover reports whether the cover was set by a user rather than generated
+func (p *Playlist) hasCustomCover() bool {
+	return p.CoverArt != "" && !p.CoverGenerated
+}
+
+// scheduleCover regenerates a playlist's mosaic in the background. Requests for a playlist whose
+// mosaic is already being built are folded into one more run once it finishes.
+func (s *PlaylistService) scheduleCover(id primitive.ObjectID) {
+	if s.Storage == nil {
+		return
+	}
+
+	s.coverMu.Lock()
+	if s.coverPending == nil {
+		s.coverPending = make(map[primitive.ObjectID]bool)
+	}
+	_, running := s.coverPending[id]
+	s.coverPending[id] = true
+	s.coverMu.Unlock()
+	if running {
+		return
+	}
+
+	go func() {
+		for {
+			s.coverMu.Lock()
+			if !s.coverPending[id] {
+				delete(s.coverPending, id)
+				s.coverMu.Unlock()
+				return
+			}
+			s.coverPending[id] = false
+			s.coverMu.Unlock()
+
+			if err := s.refreshCover(id); err != nil {
+				log.Printf("Failed to generate cover for playlist %s: %v", id.Hex(), err)
+			}
+		}
+	}()
+}
+
+// scheduleCovers regenerates the mosaic of every playlist matching the filter
+func (s *PlaylistService) scheduleCovers(filter bson.M) {
+	if s.Storage == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := s.PlaylistCollection.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		log.Printf("Failed to find playlists for cover refresh: %v", err)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var doc struct {
+			ID primitive.ObjectID `bson:"_id"`
+		}
+		if err := cursor.Decode(&doc); err == nil {
+			s.scheduleCover(doc.ID)
+		}
+	}
+}
+
+// refreshCover rebuilds the mosaic if the playlist has no custom cover and its first albums
+// changed since the mosaic was made. The old generated image is deleted once replaced.
+func (s *PlaylistService) refreshCover(id primitive.ObjectID) error {
+	playlist, err := s.GetPlaylistByID(id.Hex())
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if playlist.hasCustomCover() {
+		return nil
+	}
+
+	if err := s.ResolveSmart(playlist); err != nil {
+		return err
+	}
+	artwork, err := s.coverArtwork(playlist)
+	if err != nil {
+		return err
+	}
+
+	source := strings.Join(artwork, "\n")
+	if source == playlist.CoverSource && (source == "" || playlist.CoverArt != "") {
+		return nil
+	}
+
+	var (
+		set   = bson.M{"updated_at": time.Now()}
+		unset = bson.M{}
+		saved string
+	)
+	if len(artwork) > 0 {
+		data, used, err := s.buildMosaic(artwork)
+		if err != nil {
+			return err
+		}
+		if used > 0 {
+			info, err := s.saveCoverImage(data, fmt.Sprintf("playlist-%s.jpg", id.Hex()), "image/jpeg")
+			if err != nil {
+				return err
+			}
+			saved = info.Path
+			set["cover_art"] = s.Storage.GetFileURL(info.Path)
+			set["cover_path"] = info.Path
+			set["cover_generated"] = true
+			set["cover_source"] = source
+		}
+	}
+	if saved == "" {
+		// No usable artwork: drop the old mosaic
+		unset = bson.M{"cover_art": "", "cover_path": "", "cover_generated": "", "cover_source": ""}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Only replace the cover this run started from; a custom cover set in the meantime wins
+	filter := bson.M{"_id": id, "cover_art": bson.M{"$in": bson.A{"", nil}}}
+	if playlist.CoverGenerated {
+		filter = bson.M{"_id": id, "cover_generated": true, "cover_path": playlist.CoverPath}
+	}
+
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	res, err := s.PlaylistCollection.UpdateOne(ctx, filter, update)
+	if err != nil || res.MatchedCount == 0 {
+		s.deleteCoverImage(saved)
+		return err
+	}
+
+	s.deleteCoverImage(playlist.CoverPath)
+	return nil
+}
+
+// coverArtwork returns the album art URLs of the first distinct albums in the playlist
+func (s *PlaylistService) coverArtwork(p *Playlist) ([]string, error) {
+	var ids []primitive.ObjectID
+	for _, entry := range p.Entries {
+		if entry.TrackDeletedAt == nil {
+			ids = append(ids, entry.TrackID)
+		}
+		if len(ids) == coverScanEntries {
+			break
+		}
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := s.TrackCollection.Find(ctx, bson.M{
+		"_id":           bson.M{"$in": ids},
+		"deleted_at":    bson.M{"$exists": false},
+		"album_art_url": bson.M{"$nin": bson.A{"", nil}},
+	}, options.Find().SetProjection(bson.M{"album": 1, "artist": 1, "album_art_url": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var tracks []music.Track
+	if err := cursor.All(ctx, &tracks); err != nil {
+		return nil, err
+	}
+	byID := make(map[primitive.ObjectID]*music.Track, len(tracks))
+	for i := range tracks {
+		byID[tracks[i].ID] = &tracks[i]
+	}
+
+	// Albums are told apart by name and artist; tracks without an album by their artwork
+	var artwork []string
+	seen := make(map[string]bool)
+	for _, id := range ids {
+		track, ok := byID[id]
+		if !ok {
+			continue
+		}
+		key := "url:" + track.AlbumArtURL
+		if track.Album != "" {
+			key = "album:" + matchKey(track.Album) + "\x1f" + matchKey(track.Artist)
+		}
+		if seen[key] || seen["url:"+track.AlbumArtURL] {
+			continue
+		}
+		seen[key] = true
+		seen["url:"+track.AlbumArtURL] = true
+		artwork = append(artwork, track.AlbumArtURL)
+		if len(artwork) == coverTiles {
+			break
+		}
+	}
+
+	return artwork, nil
+}
+
+// buildMosaic renders a 2x2 mosaic as JPEG, or a single cover when fewer than four images
+// load. Artwork that cannot be fetched or decoded is skipped. It returns how many images were used.
+func (s *PlaylistService) buildMosaic(urls []string) ([]byte, int, error) {
+	var images []image.Image
+	for _, url := range urls {
+		img, err := s.fetchArtwork(url)
+		if err != nil {
+			log.Printf("Skipping album art %s: %v", url, err)
+			continue
+		}
+		images = append(images, img)
+	}
+	if len(images) == 0 {
+		return nil, 0, nil
+	}
+
+	canvas := image.NewRGBA(image.Rect(0, 0, coverSize, coverSize))
+	draw.Draw(canvas, canvas.Bounds(), &image.Uniform{C: color.Black}, image.Point{}, draw.Src)
+
+	if len(images) < coverTiles {
+		images = images[:1]
+		drawScaled(canvas, canvas.Bounds(), images[0])
+	} else {
+		half := coverSize / 2
+		for i, img := range images[:coverTiles] {
+			x, y := (i%2)*half, (i/2)*half
+			drawScaled(canvas, image.Rect(x, y, x+half, y+half), img)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, canvas, &jpeg.Options{Quality: 85}); err != nil {
+		return nil, 0, err
+	}
+	return buf.Bytes(), len(images), nil
+}
+
+// fetchArtwork downloads and decodes album art. Track metadata is user-editable, so only URLs
+// on the image storage's host are fetched, and images too large to decode safely are rejected.
+func (s *PlaylistService) fetchArtwork(rawURL string) (image.Image, error) {
+	if !s.isStorageURL(rawURL) {
+		return nil, errArtworkHost
+	}
+
+	resp, err := artworkClient.Get(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxArtworkBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxArtworkBytes {
+		return nil, fmt.Errorf("image is larger than %d bytes", maxArtworkBytes)
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > maxArtworkPixels {
+		return nil, fmt.Errorf("image is %dx%d pixels", config.Width, config.Height)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	return img, err
+}
+
+// isStorageURL reports whether a URL points at the image storage: https on the same host as
+// the URLs the storage hands out
+func (s *PlaylistService) isStorageURL(rawURL string) bool {
+	if s.Storage == nil {
+		return false
+	}
+	storageURL, err := url.Parse(s.Storage.GetFileURL("amplify/album-art/cover"))
+	if err != nil || storageURL.Host == "" {
+		return false
+	}
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	return target.Scheme == "https" && target.User == nil && strings.EqualFold(target.Host, storageURL.Host)
+}
+
+// drawScaled center-crops src to a square and scales it into dst's rect, averaging the source
+// pixels behind each destination pixel
+func drawScaled(dst *image.RGBA, rect image.Rectangle, src image.Image) {
+	bounds := src.Bounds()
+	side := bounds.Dx()
+	if bounds.Dy() < side {
+		side = bounds.Dy()
+	}
+	if side <= 0 {
+		return
+	}
+	origin := image.Pt(bounds.Min.X+(bounds.Dx()-side)/2, bounds.Min.Y+(bounds.Dy()-side)/2)
+
+	w, h := rect.Dx(), rect.Dy()
+	for y := 0; y < h; y++ {
+		y0 := origin.Y + y*side/h
+		y1 := origin.Y + (y+1)*side/h
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < w; x++ {
+			x0 := origin.X + x*side/w
+			x1 := origin.X + (x+1)*side/w
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+
+			var r, g, b, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, _ := src.At(sx, sy).RGBA()
+					r, g, b = r+uint64(cr), g+uint64(cg), b+uint64(cb)
+					n++
+				}
+			}
+			dst.SetRGBA(rect.Min.X+x, rect.Min.Y+y, color.RGBA{
+				R: uint8(r / n >> 8),
+				G: uint8(g / n >> 8),
+				B: uint8(b / n >> 8),
+				A: 0xff,
+			})
+		}
+	}
+}
+
+// saveCoverImage stores an in-memory image through the storage provider's album art upload
+func (s *PlaylistService) saveCoverImage(data []byte, filename, contentType string) (*storage.FileInfo, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename="%s"`, filename))
+	header.Set("Content-Type", contentType)
+	part, err := writer.CreatePart(header)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := part.Write(data); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	// Large enough to keep the file in memory
+	form, err := multipart.NewReader(&body, writer.Boundary()).ReadForm(int64(len(data)) + 1<<20)
+	if err != nil {
+		return nil, err
+	}
+	defer form.RemoveAll()
+
+	return s.saveCoverUpload(form.File["file"][0])
+}
+
+// saveCoverUpload stores an uploaded cover image
+func (s *PlaylistService) saveCoverUpload(fileHeader *multipart.FileHeader) (*storage.FileInfo, error) {
+	if s.Storage == nil {
+		return nil, ErrStorageUnavailable
+	}
+	return s.Storage.SaveAlbumArt(fileHeader)
+}
+
+// deleteCoverImage removes a stored cover image, logging failures
+func (s *PlaylistService) deleteCoverImage(path string) {
+	if path == "" || s.Storage == nil {
+		return
+	}
+	if err := s.Storage.DeleteFile(path); err != nil {
+		log.Printf("Failed to delete cover image %s: %v", path, err)
+	}
+}
+
+// SetCustomCover stores an uploaded image as the playlist's cover, replacing the mosaic or a
+// previous upload, whose image is deleted
+func (s *PlaylistService) SetCustomCover(id string, fileHeader *multipart.FileHeader, editorID string) (*Playlist, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+
+	saved, err := s.saveCoverUpload(fileHeader)
+	if err != nil {
+		return nil, err
+	}
+
+	updated, previous, err := s.replaceCover(objectID, bson.M{
+		"$set": bson.M{
+			"cover_art":  s.Storage.GetFileURL(saved.Path),
+			"cover_path": saved.Path,
+			"updated_at": time.Now(),
+		},
+		"$unset": bson.M{"cover_generated": "", "cover_source": ""},
+		"$inc":   bson.M{"version": 1},
+	})
+	if err != nil {
+		s.deleteCoverImage(saved.Path)
+		return nil, err
+	}
+
+	s.deleteCoverImage(previous)
+	s.recordChange(updated, PlaylistChange{Action: ChangeUpdated, ActorID: editorID, Fields: []string{"cover_art"}}, false)
+	s.notify(updated, PlaylistEvent{Action: "updated", ActorID: editorID, Version: updated.Version})
+	return updated, nil
+}
+
+// RemoveCustomCover drops a custom cover and goes back to a generated mosaic
+func (s *PlaylistService) RemoveCustomCover(id string, editorID string) (*Playlist, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+
+	updated, previous, err := s.replaceCover(objectID, bson.M{
+		"$set":   bson.M{"updated_at": time.Now()},
+		"$unset": bson.M{"cover_art": "", "cover_path": "", "cover_generated": "", "cover_source": ""},
+		"$inc":   bson.M{"version": 1},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.deleteCoverImage(previous)
+	s.recordChange(updated, PlaylistChange{Action: ChangeUpdated, ActorID: editorID, Fields: []string{"cover_art"}}, false)
+	s.scheduleCover(objectID)
+	s.notify(updated, PlaylistEvent{Action: "updated", ActorID: editorID, Version: updated.Version})
+	return updated, nil
+}
+
+// replaceCover applies a cover change and returns the updated playlist and the stored image it
+// replaced. The update only applies if the stored image is still the one read first, so the
+// replaced image is never one another request has just set; ErrVersionConflict otherwise.
+func (s *PlaylistService) replaceCover(id primitive.ObjectID, update bson.M) (*Playlist, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var before Playlist
+	err := s.PlaylistCollection.FindOne(
+		ctx,
+		notDeleted(bson.M{"_id": id}),
+		options.FindOne().SetProjection(bson.M{"cover_path": 1}),
+	).Decode(&before)
+	if err != nil {
+		return nil, "", err
+	}
+
+	filter := bson.M{"_id": id, "cover_path": nil}
+	if before.CoverPath != "" {
+		filter["cover_path"] = before.CoverPath
+	}
+
+	var updated Playlist
+	err = s.PlaylistCollection.FindOneAndUpdate(
+		ctx,
+		notDeleted(filter),
+		update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	if err == mongo.ErrNoDocuments {
+		return nil, "", ErrVersionConflict
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	updated.Entries = normalizeEntries(&updated)
+	return &updated, before.CoverPath, nil
+}
@@ -0,0 +1,330 @@
+package playlist
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Limits on playlist size and batch edits
+const (
+	MaxPlaylistEntries = 10000
+	MaxBatchSize       = 100
+)
+
+// conflictRetries is how often an edit without an expected version is retried after losing a race
+const conflictRetries = 3
+
+var (
+	ErrVersionConflict = errors.New("playlist was modified concurrently, reload and try again")
+	ErrEntryNotFound   = errors.New("playlist entry not found")
+	ErrTrackNotFound   = errors.New("track not found")
+	ErrInvalidPosition = errors.New("position is out of range")
+	ErrPlaylistFull    = errors.New("playlist has too many tracks")
+	ErrBatchTooLarge   = errors.New("too many items in one request")
+)
+
+// versionFilter matches the playlist only if it is still at the given version.
+// Playlists created before versioning have no version field and count as version 0.
+func versionFilter(id primitive.ObjectID, version int) bson.M {
+	filter := notDeleted(bson.M{"_id": id})
+	if version == 0 {
+		filter["version"] = bson.M{"$in": bson.A{0, nil}}
+	} else {
+		filter["version"] = version
+	}
+	return filter
+}
+
+// normalizeEntries returns the playlist's entries in order, one per track_ids element.
+// Playlists written before entries had IDs get them derived from track_ids: the first
+// occurrence of a track uses the track ID as its entry ID so the ID stays stable across reads.
+func normalizeEntries(p *Playlist) []Entry {
+	if entriesInSync(p) {
+		return append([]Entry{}, p.Entries...)
+	}
+
+	attribution := make(map[primitive.ObjectID]Entry, len(p.Entries))
+	for _, entry := range p.Entries {
+		if _, ok := attribution[entry.TrackID]; !ok {
+			attribution[entry.TrackID] = entry
+		}
+	}
+
+	entries := make([]Entry, 0, len(p.TrackIDs))
+	used := make(map[string]bool, len(p.TrackIDs))
+	for _, trackID := range p.TrackIDs {
+		entry := attribution[trackID]
+		entry.TrackID = trackID
+		if entry.ID == "" || used[entry.ID] {
+			entry.ID = trackID.Hex()
+		}
+		if used[entry.ID] {
+			entry.ID = primitive.NewObjectID().Hex()
+		}
+		used[entry.ID] = true
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
+
+// entriesInSync reports whether the stored entries have IDs and match track_ids one to one
+func entriesInSync(p *Playlist) bool {
+	if len(p.Entries) != len(p.TrackIDs) {
+		return false
+	}
+	for i, entry := range p.Entries {
+		if entry.ID == "" || entry.TrackID != p.TrackIDs[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func trackIDsOf(entries []Entry) []primitive.ObjectID {
+	ids := make([]primitive.ObjectID, len(entries))
+	for i, entry := range entries {
+		ids[i] = entry.TrackID
+	}
+	return ids
+}
+
+func indexOfEntry(entries []Entry, entryID string) int {
+	for i, entry := range entries {
+		if entry.ID == entryID {
+			return i
+		}
+	}
+	return -1
+}
+
+// mutateEntries applies fn to the playlist's entries and writes them back, guarded by the
+// playlist version. With an expected version the edit fails on any mismatch; without one it
+// is retried against the latest state, since positions and entry IDs still make sense there.
+func (s *PlaylistService) mutateEntries(playlistID string, expectedVersion *int, fn func(entries []Entry) ([]Entry, error)) (*Playlist, error) {
+	attempts := conflictRetries
+	if expectedVersion != nil {
+		attempts = 1
+	}
+
+	for attempt := 0; attempt < attempts; attempt++ {
+		playlist, err := s.GetPlaylistByID(playlistID)
+		if err != nil {
+			return nil, err
+		}
+		if playlist.Rules != nil {
+			return nil, ErrSmartPlaylist
+		}
+		if expectedVersion != nil && *expectedVersion != playlist.Version {
+			return nil, ErrVersionConflict
+		}
+
+		entries, err := fn(playlist.Entries)
+		if err != nil {
+			return nil, err
+		}
+		if len(entries) > MaxPlaylistEntries {
+			return nil, ErrPlaylistFull
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		now := time.Now()
+		res, err := s.PlaylistCollection.UpdateOne(
+			ctx,
+			versionFilter(playlist.ID, playlist.Version),
+			bson.M{"$set": bson.M{
+				"entries":    entries,
+				"track_ids":  trackIDsOf(entries),
+				"version":    playlist.Version + 1,
+				"updated_at": now,
+			}},
+		)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+		if res.MatchedCount == 0 {
+			continue
+		}
+
+		playlist.Entries = entries
+		playlist.TrackIDs = trackIDsOf(entries)
+		playlist.Version++
+		playlist.UpdatedAt = now
+		s.scheduleCover(playlist.ID)
+		return playlist, nil
+	}
+
+	return nil, ErrVersionConflict
+}
+
+// checkTracksExist verifies every track exists and is not in the trash
+func (s *PlaylistService) checkTracksExist(trackIDs []primitive.ObjectID) error {
+	unique := make(map[primitive.ObjectID]bool, len(trackIDs))
+	ids := bson.A{}
+	for _, id := range trackIDs {
+		if !unique[id] {
+			unique[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	count, err := s.TrackCollection.CountDocuments(ctx, bson.M{
+		"_id":        bson.M{"$in": ids},
+		"deleted_at": bson.M{"$exists": false},
+	})
+	if err != nil {
+		return err
+	}
+	if int(count) != len(ids) {
+		return ErrTrackNotFound
+	}
+
+	return nil
+}
+
+// AddTracks inserts tracks at position (nil appends). The same track may appear more than once;
+// each insertion gets its own entry ID.
+func (s *PlaylistService) AddTracks(playlistID string, trackIDs []string, position *int, userID string, expectedVersion *int) (*Playlist, error) {
+	if len(trackIDs) == 0 || len(trackIDs) > MaxBatchSize {
+		return nil, ErrBatchTooLarge
+	}
+
+	objectIDs := make([]primitive.ObjectID, len(trackIDs))
+	for i, trackID := range trackIDs {
+		objectID, err := primitive.ObjectIDFromHex(trackID)
+		if err != nil {
+			return nil, err
+		}
+		objectIDs[i] = objectID
+	}
+	if err := s.checkTracksExist(objectIDs); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	added := make([]Entry, len(objectIDs))
+	for i, trackID := range objectIDs {
+		added[i] = Entry{
+			ID:      primitive.NewObjectID().Hex(),
+			TrackID: trackID,
+			AddedBy: userID,
+			AddedAt: now,
+		}
+	}
+
+	updated, err := s.mutateEntries(playlistID, expectedVersion, func(entries []Entry) ([]Entry, error) {
+		at := len(entries)
+		if position != nil {
+			at = *position
+		}
+		if at < 0 || at > len(entries) {
+			return nil, ErrInvalidPosition
+		}
+
+		result := make([]Entry, 0, len(entries)+len(added))
+		result = append(result, entries[:at]...)
+		result = append(result, added...)
+		return append(result, entries[at:]...), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	entryIDs := make([]string, len(added))
+	for i, entry := range added {
+		entryIDs[i] = entry.ID
+	}
+	s.recordChange(updated, PlaylistChange{Action: ChangeTrackAdded, ActorID: userID, EntryIDs: entryIDs}, true)
+	event := PlaylistEvent{Action: "track_added", ActorID: userID, EntryIDs: entryIDs, Version: updated.Version}
+	if len(trackIDs) == 1 {
+		event.TrackID = trackIDs[0]
+	}
+	s.notify(updated, event)
+
+	return updated, nil
+}
+
+// RemoveEntries removes entries by entry ID. For compatibility with clients that address
+// tracks directly, an ID that is not an entry ID but a track ID removes every entry of that track.
+func (s *PlaylistService) RemoveEntries(playlistID string, entryIDs []string, userID string, expectedVersion *int) (*Playlist, error) {
+	if len(entryIDs) == 0 || len(entryIDs) > MaxBatchSize {
+		return nil, ErrBatchTooLarge
+	}
+
+	var removedIDs []string
+	updated, err := s.mutateEntries(playlistID, expectedVersion, func(entries []Entry) ([]Entry, error) {
+		remove := make(map[string]bool, len(entryIDs))
+		for _, id := range entryIDs {
+			if indexOfEntry(entries, id) >= 0 {
+				remove[id] = true
+				continue
+			}
+
+			trackID, err := primitive.ObjectIDFromHex(id)
+			found := false
+			for _, entry := range entries {
+				if err == nil && entry.TrackID == trackID {
+					remove[entry.ID] = true
+					found = true
+				}
+			}
+			if !found {
+				return nil, ErrEntryNotFound
+			}
+		}
+
+		removedIDs = removedIDs[:0]
+		result := make([]Entry, 0, len(entries))
+		for _, entry := range entries {
+			if remove[entry.ID] {
+				removedIDs = append(removedIDs, entry.ID)
+				continue
+			}
+			result = append(result, entry)
+		}
+		return result, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.recordChange(updated, PlaylistChange{Action: ChangeTrackRemoved, ActorID: userID, EntryIDs: removedIDs}, true)
+	s.notify(updated, PlaylistEvent{Action: "track_removed", ActorID: userID, EntryIDs: removedIDs, Version: updated.Version})
+	return updated, nil
+}
+
+// MoveEntry moves an entry to position, counted in the list without the moved entry
+func (s *PlaylistService) MoveEntry(playlistID, entryID string, position int, userID string, expectedVersion *int) (*Playlist, error) {
+	updated, err := s.mutateEntries(playlistID, expectedVersion, func(entries []Entry) ([]Entry, error) {
+		from := indexOfEntry(entries, entryID)
+		if from < 0 {
+			return nil, ErrEntryNotFound
+		}
+		if position < 0 || position >= len(entries) {
+			return nil, ErrInvalidPosition
+		}
+
+		moved := entries[from]
+		result := make([]Entry, 0, len(entries))
+		result = append(result, entries[:from]...)
+		result = append(result, entries[from+1:]...)
+
+		result = append(result[:position], append([]Entry{moved}, result[position:]...)...)
+		return result, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.recordChange(updated, PlaylistChange{Action: ChangeTrackMoved, ActorID: userID, EntryIDs: []string{entryID}}, true)
+	s.notify(updated, PlaylistEvent{Action: "track_moved", ActorID: userID, EntryIDs: []string{entryID}, Version: updated.Version})
+	return updated, nil
+}
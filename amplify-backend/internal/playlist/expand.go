@@ -0,0 +1,179 @@
+package playlist
+
+import (
+	"amplify-backend/internal/music"
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Page sizes for expanded playlists
+const (
+	defaultExpandPageSize = 100
+	maxExpandPageSize     = 500
+)
+
+// ExpandedEntry is a playlist entry with its track joined in
+type ExpandedEntry struct {
+	Entry
+	Position int          `json:"position"`
+	Track    *music.Track `json:"track,omitempty"`
+	Missing  bool         `json:"missing,omitempty"` // The track no longer exists
+	Deleted  bool         `json:"deleted,omitempty"` // The track is in the trash
+}
+
+// ExpandedPlaylist is a playlist with one page of entries expanded to full tracks.
+// Totals cover the whole playlist, not just the page.
+type ExpandedPlaylist struct {
+	*Playlist
+	Entries          []ExpandedEntry `json:"entries"`
+	TrackCount       int             `json:"track_count"`
+	TotalDuration    int             `json:"total_duration"`    // seconds, playable tracks only
+	UnavailableCount int             `json:"unavailable_count"` // entries whose track is missing or trashed
+	Page             int             `json:"page"`
+	Limit            int             `json:"limit"`
+	HasMore          bool            `json:"has_more"`
+}
+
+// GetExpandedPlaylist returns a playlist with the tracks of one page of entries, joined in a
+// single aggregation. Durations are summed over every entry, so duplicates count each time.
+func (s *PlaylistService) GetExpandedPlaylist(id string, page, limit int) (*ExpandedPlaylist, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = defaultExpandPageSize
+	}
+	if limit > maxExpandPageSize {
+		limit = maxExpandPageSize
+	}
+	offset := (page - 1) * limit
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	trackIDs := bson.M{"$ifNull": bson.A{"$track_ids", bson.A{}}}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: notDeleted(bson.M{"_id": objectID})}},
+		{{Key: "$addFields", Value: bson.M{
+			"page_track_ids": bson.M{"$slice": bson.A{trackIDs, offset, limit}},
+		}}},
+		// Only what the totals need, for every track in the playlist. Joined on the fields, not
+		// an $expr match, so each ID is an _id index lookup rather than a collection scan.
+		{{Key: "$lookup", Value: bson.M{
+			"from":         "tracks",
+			"localField":   "track_ids",
+			"foreignField": "_id",
+			"pipeline": bson.A{
+				bson.M{"$project": bson.M{"duration": 1, "deleted_at": 1}},
+			},
+			"as": "track_summaries",
+		}}},
+		// Full documents for the requested page only
+		{{Key: "$lookup", Value: bson.M{
+			"from":         "tracks",
+			"localField":   "page_track_ids",
+			"foreignField": "_id",
+			"as":           "page_tracks",
+		}}},
+	}
+
+	cursor, err := s.PlaylistCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	if !cursor.Next(ctx) {
+		if err := cursor.Err(); err != nil {
+			return nil, err
+		}
+		return nil, mongo.ErrNoDocuments
+	}
+
+	var result struct {
+		Playlist       `bson:",inline"`
+		TrackSummaries []struct {
+			ID        primitive.ObjectID `bson:"_id"`
+			Duration  int                `bson:"duration"`
+			DeletedAt *time.Time         `bson:"deleted_at"`
+		} `bson:"track_summaries"`
+		PageTracks []music.Track `bson:"page_tracks"`
+	}
+	if err := cursor.Decode(&result); err != nil {
+		return nil, err
+	}
+
+	playlist := result.Playlist
+
+	// Track ID -> duration of playable tracks, and the full tracks available for the page
+	available := make(map[primitive.ObjectID]int, len(result.TrackSummaries))
+	tracks := make(map[primitive.ObjectID]*music.Track, len(result.PageTracks))
+
+	var entries []Entry
+	if playlist.Rules != nil {
+		// Smart playlists are evaluated here; the query already returned full tracks
+		smart, err := s.evaluateRules(&playlist)
+		if err != nil {
+			return nil, err
+		}
+		entries = smartEntries(smart)
+		playlist.TrackIDs = trackIDsOf(entries)
+		playlist.RulesText = playlist.Rules.String()
+		for i := range smart {
+			available[smart[i].ID] = smart[i].Duration
+			tracks[smart[i].ID] = &smart[i]
+		}
+	} else {
+		entries = normalizeEntries(&playlist)
+		for _, summary := range result.TrackSummaries {
+			if summary.DeletedAt == nil {
+				available[summary.ID] = summary.Duration
+			}
+		}
+		for i := range result.PageTracks {
+			tracks[result.PageTracks[i].ID] = &result.PageTracks[i]
+		}
+	}
+	playlist.Entries = entries
+
+	expanded := &ExpandedPlaylist{
+		Playlist:   &playlist,
+		Entries:    []ExpandedEntry{},
+		TrackCount: len(entries),
+		Page:       page,
+		Limit:      limit,
+		HasMore:    offset+limit < len(entries),
+	}
+
+	for _, entry := range entries {
+		if duration, ok := available[entry.TrackID]; ok {
+			expanded.TotalDuration += duration
+		} else {
+			expanded.UnavailableCount++
+		}
+	}
+
+	for i := offset; i < len(entries) && i < offset+limit; i++ {
+		item := ExpandedEntry{Entry: entries[i], Position: i}
+		track, ok := tracks[entries[i].TrackID]
+		switch {
+		case !ok:
+			item.Missing = true
+		case track.DeletedAt != nil:
+			item.Deleted = true
+		default:
+			item.Track = track
+		}
+		expanded.Entries = append(expanded.Entries, item)
+	}
+
+	return expanded, nil
+}
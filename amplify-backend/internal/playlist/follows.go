@@ -0,0 +1,287 @@
+package playlist
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ErrFollowOwn = errors.New("you cannot follow your own playlist")
+
+// followerActions are the events followers hear about; sharing changes stay between members
+var followerActions = map[string]bool{
+	"updated":       true,
+	"deleted":       true,
+	"track_added":   true,
+	"track_removed": true,
+	"track_moved":   true,
+	"restored":      true,
+}
+
+// FollowedPlaylist is a playlist in a user's library of followed playlists
+type FollowedPlaylist struct {
+	Playlist
+	FollowedAt time.Time `json:"followed_at"`
+}
+
+// ensureFollowIndexes creates the unique (user_id, playlist_id) index so a playlist can only be
+// followed once per user, and the playlist_id index used to find followers
+func (s *PlaylistService) ensureFollowIndexes(ctx context.Context) error {
+	_, err := s.FollowCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "playlist_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "playlist_id", Value: 1}}},
+	})
+	return err
+}
+
+// FollowPlaylist adds a playlist to the user's library. Following an already followed playlist is a no-op.
+// Callers check that the user can see the playlist.
+func (s *PlaylistService) FollowPlaylist(p *Playlist, userID string) (*Follow, error) {
+	if p.CreatedBy == userID {
+		return nil, ErrFollowOwn
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"user_id": userID, "playlist_id": p.ID}
+	res, err := s.FollowCollection.UpdateOne(
+		ctx,
+		filter,
+		bson.M{"$setOnInsert": bson.M{"created_at": time.Now()}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only count the follow once, when it was actually created
+	if res.UpsertedCount > 0 {
+		_, err = s.PlaylistCollection.UpdateOne(
+			ctx,
+			bson.M{"_id": p.ID},
+			bson.M{"$inc": bson.M{"follower_count": 1}},
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var follow Follow
+	if err := s.FollowCollection.FindOne(ctx, filter).Decode(&follow); err != nil {
+		return nil, err
+	}
+
+	return &follow, nil
+}
+
+// UnfollowPlaylist removes a playlist from the user's library. Unfollowing a playlist that is not followed is a no-op.
+func (s *PlaylistService) UnfollowPlaylist(playlistID, userID string) error {
+	objectID, err := primitive.ObjectIDFromHex(playlistID)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := s.FollowCollection.DeleteOne(ctx, bson.M{"user_id": userID, "playlist_id": objectID})
+	if err != nil {
+		return err
+	}
+
+	if res.DeletedCount > 0 {
+		_, err = s.PlaylistCollection.UpdateOne(
+			ctx,
+			bson.M{"_id": objectID, "follower_count": bson.M{"$gt": 0}},
+			bson.M{"$inc": bson.M{"follower_count": -1}},
+		)
+	}
+
+	return err
+}
+
+// IsFollowing reports whether the user follows the playlist
+func (s *PlaylistService) IsFollowing(playlistID, userID string) (bool, error) {
+	objectID, err := primitive.ObjectIDFromHex(playlistID)
+	if err != nil {
+		return false, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	count, err := s.FollowCollection.CountDocuments(ctx, bson.M{"user_id": userID, "playlist_id": objectID})
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// GetFollowedPlaylists returns the playlists the user follows, most recently followed first.
+// Playlists in the trash, and ones made private since, are left out but stay followed.
+func (s *PlaylistService) GetFollowedPlaylists(userID string) ([]FollowedPlaylist, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := s.FollowCollection.Find(
+		ctx,
+		bson.M{"user_id": userID},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var follows []Follow
+	if err := cursor.All(ctx, &follows); err != nil {
+		return nil, err
+	}
+
+	followed := []FollowedPlaylist{}
+	if len(follows) == 0 {
+		return followed, nil
+	}
+
+	ids := make([]primitive.ObjectID, len(follows))
+	for i, follow := range follows {
+		ids[i] = follow.PlaylistID
+	}
+
+	playlistCursor, err := s.PlaylistCollection.Find(ctx, notDeleted(visibleTo(userID, bson.M{"_id": bson.M{"$in": ids}})))
+	if err != nil {
+		return nil, err
+	}
+	defer playlistCursor.Close(ctx)
+
+	var playlists []Playlist
+	if err := playlistCursor.All(ctx, &playlists); err != nil {
+		return nil, err
+	}
+	byID := make(map[primitive.ObjectID]*Playlist, len(playlists))
+	for i := range playlists {
+		playlists[i].Entries = normalizeEntries(&playlists[i])
+		if playlists[i].Rules != nil {
+			playlists[i].RulesText = playlists[i].Rules.String()
+		}
+		byID[playlists[i].ID] = &playlists[i]
+	}
+
+	// Preserve the follow order
+	for _, follow := range follows {
+		if playlist, ok := byID[follow.PlaylistID]; ok {
+			followed = append(followed, FollowedPlaylist{Playlist: *playlist, FollowedAt: follow.CreatedAt})
+		}
+	}
+
+	return followed, nil
+}
+
+// notifyFollowers sends a playlist event to followers who are not members. Private playlists
+// are only seen by members, so their followers are skipped.
+func (s *PlaylistService) notifyFollowers(p *Playlist, event PlaylistEvent) {
+	if !p.IsPublic || !followerActions[event.Action] {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := s.FollowCollection.Find(
+		ctx,
+		bson.M{"playlist_id": p.ID},
+		options.Find().SetProjection(bson.M{"user_id": 1}),
+	)
+	if err != nil {
+		log.Printf("Failed to load followers of playlist %s: %v", p.ID.Hex(), err)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	members := make(map[string]bool)
+	for _, member := range p.Members() {
+		members[member] = true
+	}
+
+	var followerIDs []string
+	for cursor.Next(ctx) {
+		var follow Follow
+		if err := cursor.Decode(&follow); err != nil {
+			continue
+		}
+		if !members[follow.UserID] {
+			followerIDs = append(followerIDs, follow.UserID)
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		log.Printf("Failed to load followers of playlist %s: %v", p.ID.Hex(), err)
+	}
+
+	if len(followerIDs) > 0 {
+		event.Following = true
+		s.Notifier.NotifyUsers(followerIDs, "playlist:updated", event)
+	}
+}
+
+// ForkPlaylist copies a playlist into the user's account, linked back to the source. The copy
+// keeps the source's tracks (or rules, for a smart playlist), is private unless isPublic is
+// set, and gets the source's name unless a name is given. Callers check that the user can see
+// the source. A custom cover is not copied, since it may be deleted with the source; the copy
+// gets a mosaic of its own tracks.
+func (s *PlaylistService) ForkPlaylist(source *Playlist, userID, name string, isPublic bool) (*Playlist, error) {
+	if name == "" {
+		name = source.Name
+	}
+
+	now := time.Now()
+	fork := Playlist{
+		Name:        name,
+		Description: source.Description,
+		IsPublic:    isPublic,
+		CreatedBy:   userID,
+		ForkedFrom: &ForkSource{
+			PlaylistID: source.ID,
+			Name:       source.Name,
+			CreatedBy:  source.CreatedBy,
+			ForkedAt:   now,
+		},
+	}
+
+	if source.Rules != nil {
+		rules := *source.Rules
+		fork.Rules = &rules
+	} else {
+		// Tracks in the trash are left behind
+		for _, entry := range normalizeEntries(source) {
+			if entry.TrackDeletedAt == nil {
+				fork.TrackIDs = append(fork.TrackIDs, entry.TrackID)
+			}
+		}
+	}
+
+	created, err := s.CreatePlaylist(fork)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := s.PlaylistCollection.UpdateOne(ctx, bson.M{"_id": source.ID}, bson.M{"$inc": bson.M{"fork_count": 1}}); err != nil {
+		log.Printf("Failed to count fork of playlist %s: %v", source.ID.Hex(), err)
+	}
+
+	return created, nil
+}
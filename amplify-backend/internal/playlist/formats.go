@@ -0,0 +1,382 @@
+package playlist
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Playlist file formats for export and import
+const (
+	FormatM3U8 = "m3u8"
+	FormatPLS  = "pls"
+	FormatXSPF = "xspf"
+)
+
+// contentHashURN prefixes content hashes in XSPF <identifier> elements
+const contentHashURN = "urn:content-hash:"
+
+var (
+	ErrUnknownFormat = errors.New("unknown playlist format, use m3u8, pls or xspf")
+	ErrEmptyImport   = errors.New("playlist file has no entries")
+)
+
+// FileItem is one entry of a playlist file
+type FileItem struct {
+	Location    string `json:"location,omitempty"`
+	Title       string `json:"title,omitempty"`
+	Artist      string `json:"artist,omitempty"`
+	Album       string `json:"album,omitempty"`
+	Duration    int    `json:"duration,omitempty"` // seconds, 0 if unknown
+	ContentHash string `json:"content_hash,omitempty"`
+}
+
+// ContentType returns the MIME type of a playlist format
+func ContentType(format string) string {
+	switch format {
+	case FormatPLS:
+		return "audio/x-scpls"
+	case FormatXSPF:
+		return "application/xspf+xml"
+	default:
+		return "application/vnd.apple.mpegurl"
+	}
+}
+
+// DetectFormat guesses the format of a playlist file from a file name, then from its content
+func DetectFormat(filename string, data []byte) (string, error) {
+	switch strings.ToLower(strings.TrimPrefix(path.Ext(filename), ".")) {
+	case "m3u8", "m3u":
+		return FormatM3U8, nil
+	case FormatPLS:
+		return FormatPLS, nil
+	case FormatXSPF:
+		return FormatXSPF, nil
+	}
+
+	head := strings.ToLower(strings.TrimSpace(strings.TrimPrefix(string(firstBytes(data, 512)), "\ufeff")))
+	switch {
+	case strings.HasPrefix(head, "#extm3u"):
+		return FormatM3U8, nil
+	case strings.HasPrefix(head, "[playlist]"):
+		return FormatPLS, nil
+	case strings.HasPrefix(head, "<?xml"), strings.HasPrefix(head, "<playlist"):
+		return FormatXSPF, nil
+	}
+	return "", ErrUnknownFormat
+}
+
+func firstBytes(data []byte, n int) []byte {
+	if len(data) > n {
+		return data[:n]
+	}
+	return data
+}
+
+// WriteFile writes a playlist file in the given format
+func WriteFile(w io.Writer, format, name string, items []FileItem) error {
+	switch format {
+	case FormatM3U8:
+		return writeM3U8(w, name, items)
+	case FormatPLS:
+		return writePLS(w, items)
+	case FormatXSPF:
+		return writeXSPF(w, name, items)
+	default:
+		return ErrUnknownFormat
+	}
+}
+
+// ParseFile reads a playlist file and returns its title (if the format has one) and entries
+func ParseFile(format string, data []byte) (string, []FileItem, error) {
+	data = bytes.TrimPrefix(data, []byte("\ufeff"))
+
+	var (
+		name  string
+		items []FileItem
+		err   error
+	)
+	switch format {
+	case FormatM3U8:
+		name, items, err = parseM3U8(data)
+	case FormatPLS:
+		items, err = parsePLS(data)
+	case FormatXSPF:
+		name, items, err = parseXSPF(data)
+	default:
+		return "", nil, ErrUnknownFormat
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	if len(items) == 0 {
+		return "", nil, ErrEmptyImport
+	}
+	return name, items, nil
+}
+
+// displayTitle joins artist and title the way M3U and PLS players show them
+func displayTitle(item FileItem) string {
+	if item.Artist == "" {
+		return item.Title
+	}
+	return item.Artist + " - " + item.Title
+}
+
+// splitDisplayTitle reverses displayTitle
+func splitDisplayTitle(value string) (artist, title string) {
+	value = strings.TrimSpace(value)
+	if artist, title, ok := strings.Cut(value, " - "); ok {
+		return strings.TrimSpace(artist), strings.TrimSpace(title)
+	}
+	return "", value
+}
+
+// lengthOrUnknown formats a duration for #EXTINF and PLS, where -1 means unknown
+func lengthOrUnknown(duration int) int {
+	if duration <= 0 {
+		return -1
+	}
+	return duration
+}
+
+// oneLine keeps metadata from breaking line-based formats
+func oneLine(value string) string {
+	return strings.Join(strings.Fields(value), " ")
+}
+
+func writeM3U8(w io.Writer, name string, items []FileItem) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("#EXTM3U\n")
+	if name != "" {
+		fmt.Fprintf(bw, "#PLAYLIST:%s\n", oneLine(name))
+	}
+	for _, item := range items {
+		fmt.Fprintf(bw, "#EXTINF:%d,%s\n", lengthOrUnknown(item.Duration), oneLine(displayTitle(item)))
+		if item.Album != "" {
+			fmt.Fprintf(bw, "#EXTALB:%s\n", oneLine(item.Album))
+		}
+		fmt.Fprintf(bw, "%s\n", item.Location)
+	}
+	return bw.Flush()
+}
+
+func parseM3U8(data []byte) (string, []FileItem, error) {
+	var (
+		name    string
+		items   []FileItem
+		pending FileItem
+	)
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "#EXTINF:"):
+			// #EXTINF:<seconds>[ key="value" ...],<artist> - <title>
+			info, display, _ := strings.Cut(strings.TrimPrefix(line, "#EXTINF:"), ",")
+			if fields := strings.Fields(info); len(fields) > 0 {
+				if seconds, err := strconv.ParseFloat(fields[0], 64); err == nil && seconds > 0 {
+					pending.Duration = int(seconds + 0.5)
+				}
+			}
+			pending.Artist, pending.Title = splitDisplayTitle(display)
+		case strings.HasPrefix(line, "#EXTALB:"):
+			pending.Album = strings.TrimSpace(strings.TrimPrefix(line, "#EXTALB:"))
+		case strings.HasPrefix(line, "#PLAYLIST:"):
+			name = strings.TrimSpace(strings.TrimPrefix(line, "#PLAYLIST:"))
+		case strings.HasPrefix(line, "#"):
+			// Other directives and comments
+		default:
+			pending.Location = line
+			items = append(items, pending)
+			pending = FileItem{}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", nil, err
+	}
+
+	return name, items, nil
+}
+
+func writePLS(w io.Writer, items []FileItem) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("[playlist]\n")
+	for i, item := range items {
+		n := i + 1
+		fmt.Fprintf(bw, "File%d=%s\n", n, item.Location)
+		fmt.Fprintf(bw, "Title%d=%s\n", n, oneLine(displayTitle(item)))
+		fmt.Fprintf(bw, "Length%d=%d\n", n, lengthOrUnknown(item.Duration))
+	}
+	fmt.Fprintf(bw, "NumberOfEntries=%d\n", len(items))
+	bw.WriteString("Version=2\n")
+	return bw.Flush()
+}
+
+func parsePLS(data []byte) ([]FileItem, error) {
+	// Entries are numbered and their keys may come in any order
+	entries := make(map[int]*FileItem)
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		var field string
+		for _, prefix := range []string{"file", "title", "length"} {
+			if strings.HasPrefix(key, prefix) {
+				field = prefix
+				break
+			}
+		}
+		if field == "" {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimPrefix(key, field))
+		if err != nil || n < 1 {
+			continue
+		}
+
+		entry := entries[n]
+		if entry == nil {
+			entry = &FileItem{}
+			entries[n] = entry
+		}
+		switch field {
+		case "file":
+			entry.Location = value
+		case "title":
+			entry.Artist, entry.Title = splitDisplayTitle(value)
+		case "length":
+			if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+				entry.Duration = seconds
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	numbers := make([]int, 0, len(entries))
+	for n := range entries {
+		numbers = append(numbers, n)
+	}
+	sort.Ints(numbers)
+
+	items := make([]FileItem, 0, len(numbers))
+	for _, n := range numbers {
+		if entries[n].Location != "" || entries[n].Title != "" {
+			items = append(items, *entries[n])
+		}
+	}
+	return items, nil
+}
+
+type xspfPlaylist struct {
+	XMLName xml.Name    `xml:"playlist"`
+	Xmlns   string      `xml:"xmlns,attr,omitempty"`
+	Version string      `xml:"version,attr"`
+	Title   string      `xml:"title,omitempty"`
+	Tracks  []xspfTrack `xml:"trackList>track"`
+}
+
+type xspfTrack struct {
+	Locations   []string `xml:"location"`
+	Identifiers []string `xml:"identifier"`
+	Title       string   `xml:"title,omitempty"`
+	Creator     string   `xml:"creator,omitempty"`
+	Album       string   `xml:"album,omitempty"`
+	Duration    int      `xml:"duration,omitempty"` // milliseconds
+}
+
+func writeXSPF(w io.Writer, name string, items []FileItem) error {
+	doc := xspfPlaylist{
+		Xmlns:   "http://xspf.org/ns/0/",
+		Version: "1",
+		Title:   name,
+		Tracks:  make([]xspfTrack, len(items)),
+	}
+	for i, item := range items {
+		track := xspfTrack{
+			Title:    item.Title,
+			Creator:  item.Artist,
+			Album:    item.Album,
+			Duration: item.Duration * 1000,
+		}
+		if item.Location != "" {
+			track.Locations = []string{item.Location}
+		}
+		if item.ContentHash != "" {
+			track.Identifiers = []string{contentHashURN + item.ContentHash}
+		}
+		doc.Tracks[i] = track
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func parseXSPF(data []byte) (string, []FileItem, error) {
+	var doc xspfPlaylist
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return "", nil, fmt.Errorf("invalid XSPF: %w", err)
+	}
+
+	items := make([]FileItem, 0, len(doc.Tracks))
+	for _, track := range doc.Tracks {
+		item := FileItem{
+			Title:    strings.TrimSpace(track.Title),
+			Artist:   strings.TrimSpace(track.Creator),
+			Album:    strings.TrimSpace(track.Album),
+			Duration: (track.Duration + 500) / 1000,
+		}
+		if len(track.Locations) > 0 {
+			item.Location = strings.TrimSpace(track.Locations[0])
+		}
+		for _, identifier := range track.Identifiers {
+			if hash, ok := strings.CutPrefix(strings.TrimSpace(identifier), contentHashURN); ok {
+				item.ContentHash = hash
+			}
+		}
+		if item.Location != "" || item.Title != "" || item.ContentHash != "" {
+			items = append(items, item)
+		}
+	}
+	return strings.TrimSpace(doc.Title), items, nil
+}
+
+// locationFileName returns the decoded last path segment of a file path or URL
+func locationFileName(location string) string {
+	location = strings.ReplaceAll(location, "\\", "/")
+	if parsed, err := url.Parse(location); err == nil && parsed.Scheme != "" && len(parsed.Scheme) > 1 {
+		location = parsed.Path
+	} else if unescaped, err := url.PathUnescape(location); err == nil {
+		location = unescaped
+	}
+	return path.Base(location)
+}
@@ -1,16 +1,79 @@
 package playlist
 
 import (
+	"amplify-backend/internal/middleware"
+	"amplify-backend/internal/music"
+	"amplify-backend/internal/validation"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/gofiber/fiber/v2"
-	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
+// LikedTracksProvider supplies the track IDs behind the virtual "Liked Songs" playlist
+type LikedTracksProvider interface {
+	GetLikedTrackIDs(userID string) ([]primitive.ObjectID, error)
+}
+
+// LikedSongsPlaylistName is the name of the virtual playlist built from a user's likes
+const LikedSongsPlaylistName = "Liked Songs"
+
+// RegisterLikedSongsRoute serves the current user's likes as a virtual playlist at /playlists/liked
+// Must be registered before RegisterRoutes so it is not shadowed by /playlists/:id
+func RegisterLikedSongsRoute(app *fiber.App, likes LikedTracksProvider, requireAuth fiber.Handler) {
+	app.Get("/playlists/liked", requireAuth, func(c *fiber.Ctx) error {
+		userID, err := middleware.GetUserID(c)
+		if err != nil {
+			return c.Status(401).JSON(fiber.Map{
+				"error": "Unauthorized",
+			})
+		}
+
+		trackIDs, err := likes.GetLikedTrackIDs(userID)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error": "Failed to get liked songs",
+			})
+		}
+
+		now := time.Now()
+		return c.JSON(Playlist{
+			Name:      LikedSongsPlaylistName,
+			TrackIDs:  trackIDs,
+			IsPublic:  false,
+			CreatedBy: userID,
+			Virtual:   true,
+			CreatedAt: now,
+			UpdatedAt: now,
+		})
+	})
+}
+
 // RegisterRoutes registers playlist-related routes
-// Routes are PUBLIC for guest mode (users can view playlists without auth)
-// TODO: Add auth checks for mutations (create/update/delete) to restrict to authenticated users
-func RegisterRoutes(app *fiber.App, service *PlaylistService) {
-	// Create playlist
-	app.Post("/playlists", func(c *fiber.Ctx) error {
+// Reads are PUBLIC for guest mode (guests see public playlists only); mutations require
+// authentication. Metadata and sharing are limited to the owner (or an admin), tracks can
+// also be changed by editors.
+func RegisterRoutes(app *fiber.App, service *PlaylistService, config *middleware.SupabaseConfig) {
+	requireAuth := middleware.SupabaseAuth(config)
+	optionalAuth := middleware.SupabaseOptionalAuth(config)
+
+	// Create playlist (owned by the authenticated user)
+	app.Post("/playlists", requireAuth, func(c *fiber.Ctx) error {
+		userID, err := middleware.GetUserID(c)
+		if err != nil {
+			return c.Status(401).JSON(fiber.Map{
+				"error": "Unauthorized",
+			})
+		}
+
 		var playlist Playlist
 		if err := c.BodyParser(&playlist); err != nil {
 			return c.Status(400).JSON(fiber.Map{
@@ -25,6 +88,30 @@ func RegisterRoutes(app *fiber.App, service *PlaylistService) {
 			})
 		}
 
+		// Never trust ownership or identity fields from the body
+		playlist.ID = primitive.NilObjectID
+		playlist.CreatedBy = userID
+		playlist.DeletedAt = nil
+		playlist.Collaborators = nil // Added through invites only
+		playlist.FollowerCount = 0
+		playlist.ForkCount = 0
+		playlist.ForkedFrom = nil
+		playlist.CoverGenerated = false
+		playlist.CoverPath = ""
+		playlist.CoverSource = ""
+
+		// Smart playlists: rules as query text ("query") or as a rule tree ("rules")
+		query, err := parseRulesBody(c)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		if query != nil {
+			playlist.Rules = query
+			playlist.TrackIDs = nil
+		}
+
 		created, err := service.CreatePlaylist(playlist)
 		if err != nil {
 			return c.Status(500).JSON(fiber.Map{
@@ -35,9 +122,80 @@ func RegisterRoutes(app *fiber.App, service *PlaylistService) {
 		return c.Status(201).JSON(created)
 	})
 
-	// Get all playlists
-	app.Get("/playlists", func(c *fiber.Ctx) error {
-		playlists, err := service.GetAllPlaylists()
+	// Import an M3U8, PLS or XSPF file from the request body or a multipart "file" field.
+	// Entries are matched to catalog tracks; unmatched ones are reported. ?format= overrides
+	// detection, ?name= and ?is_public= set up the new playlist, ?dry_run=true only reports.
+	app.Post("/playlists/import", requireAuth, func(c *fiber.Ctx) error {
+		userID, err := middleware.GetUserID(c)
+		if err != nil {
+			return c.Status(401).JSON(fiber.Map{
+				"error": "Unauthorized",
+			})
+		}
+
+		data := c.Body()
+		var filename string
+		if fileHeader, err := c.FormFile("file"); err == nil {
+			file, err := fileHeader.Open()
+			if err != nil {
+				return c.Status(400).JSON(fiber.Map{
+					"error": "Failed to read uploaded file",
+				})
+			}
+			defer file.Close()
+
+			if data, err = io.ReadAll(file); err != nil {
+				return c.Status(400).JSON(fiber.Map{
+					"error": "Failed to read uploaded file",
+				})
+			}
+			filename = fileHeader.Filename
+		}
+		if len(data) == 0 {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "No playlist file provided",
+			})
+		}
+
+		format := c.Query("format")
+		if format == "" {
+			if format, err = DetectFormat(filename, data); err != nil {
+				return errorResponse(c, err, "Failed to import playlist")
+			}
+		}
+
+		name, items, err := ParseFile(format, data)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		if override := strings.TrimSpace(c.Query("name")); override != "" {
+			name = override
+		}
+		if name == "" {
+			name = strings.TrimSuffix(filename, path.Ext(filename))
+		}
+		if name == "" {
+			name = "Imported playlist"
+		}
+
+		result, err := service.ImportPlaylist(name, format, items, userID, c.QueryBool("is_public"), c.QueryBool("dry_run"))
+		if err != nil {
+			return errorResponse(c, err, "Failed to import playlist")
+		}
+
+		if result.DryRun {
+			return c.JSON(result)
+		}
+		return c.Status(201).JSON(result)
+	})
+
+	// Get all playlists (public ones, plus the caller's private ones)
+	app.Get("/playlists", optionalAuth, func(c *fiber.Ctx) error {
+		viewerID, _ := middleware.GetUserID(c)
+
+		playlists, err := service.GetAllPlaylists(viewerID)
 		if err != nil {
 			return c.Status(500).JSON(fiber.Map{
 				"error": "Failed to get playlists",
@@ -47,40 +205,327 @@ func RegisterRoutes(app *fiber.App, service *PlaylistService) {
 		return c.JSON(playlists)
 	})
 
-	// Get single playlist
-	app.Get("/playlists/:id", func(c *fiber.Ctx) error {
+	// Get single playlist (private playlists only for members or an admin)
+	// ?expand=tracks joins track details for one page of entries (?page=&limit=)
+	app.Get("/playlists/:id", optionalAuth, func(c *fiber.Ctx) error {
 		id := c.Params("id")
 
+		if c.Query("expand") == "tracks" {
+			page := c.QueryInt("page", 1)
+			limit := c.QueryInt("limit", defaultExpandPageSize)
+
+			expanded, err := service.GetExpandedPlaylist(id, page, limit)
+			if err != nil || !canView(c, config, expanded.Playlist) {
+				return c.Status(404).JSON(fiber.Map{
+					"error": "Playlist not found",
+				})
+			}
+
+			return c.JSON(expanded)
+		}
+
 		playlist, err := service.GetPlaylistByID(id)
-		if err != nil {
+		if err != nil || !canView(c, config, playlist) {
 			return c.Status(404).JSON(fiber.Map{
 				"error": "Playlist not found",
 			})
 		}
 
+		if err := service.ResolveSmart(playlist); err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error": "Failed to evaluate playlist rules",
+			})
+		}
+
 		return c.JSON(playlist)
 	})
 
-	// Update playlist
-	app.Put("/playlists/:id", func(c *fiber.Ctx) error {
+	// Download a playlist as ?format=m3u8 (default), pls or xspf, with stream URLs for its playable tracks
+	app.Get("/playlists/:id/export", optionalAuth, func(c *fiber.Ctx) error {
+		format := c.Query("format", FormatM3U8)
+		if format != FormatM3U8 && format != FormatPLS && format != FormatXSPF {
+			return errorResponse(c, ErrUnknownFormat, "Failed to export playlist")
+		}
+
+		playlist, err := service.GetPlaylistByID(c.Params("id"))
+		if err != nil || !canView(c, config, playlist) {
+			return c.Status(404).JSON(fiber.Map{
+				"error": "Playlist not found",
+			})
+		}
+
+		if err := service.ResolveSmart(playlist); err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error": "Failed to evaluate playlist rules",
+			})
+		}
+
+		items, err := service.ExportItems(playlist, c.BaseURL()+"/stream")
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error": "Failed to export playlist",
+			})
+		}
+
+		var buf bytes.Buffer
+		if err := WriteFile(&buf, format, playlist.Name, items); err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error": "Failed to export playlist",
+			})
+		}
+
+		c.Set("Content-Type", ContentType(format)+"; charset=utf-8")
+		c.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, exportFileName(playlist.Name), format))
+		return c.Send(buf.Bytes())
+	})
+
+	// Set the rules of a smart playlist: {"query": "genre = Lo-fi ORDER BY play_count DESC LIMIT 50"} or {"rules": {...}}
+	app.Put("/playlists/:id/rules", requireAuth, func(c *fiber.Ctx) error {
 		id := c.Params("id")
 
-		var updates bson.M
-		if err := c.BodyParser(&updates); err != nil {
+		if _, err := authorize(c, service, config, id, RoleOwner); err != nil {
+			return errorResponse(c, err, "Failed to get playlist")
+		}
+
+		query, err := parseRulesBody(c)
+		if err != nil {
 			return c.Status(400).JSON(fiber.Map{
-				"error": "Invalid request",
+				"error": err.Error(),
+			})
+		}
+		if query == nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "query or rules is required",
 			})
 		}
 
-		// Don't allow updating system fields
-		delete(updates, "_id")
-		delete(updates, "id")
-		delete(updates, "track_ids") // Use dedicated endpoints for managing tracks
-		delete(updates, "created_at")
-		delete(updates, "created_by") // Creator cannot be changed
+		userID, _ := middleware.GetUserID(c)
+		playlist, err := service.SetRules(id, query, userID)
+		if err != nil {
+			return errorResponse(c, err, "Failed to update playlist rules")
+		}
+
+		return c.JSON(playlist)
+	})
+
+	// Turn a smart playlist back into a regular one with its current tracks
+	app.Delete("/playlists/:id/rules", requireAuth, func(c *fiber.Ctx) error {
+		id := c.Params("id")
+
+		if _, err := authorize(c, service, config, id, RoleOwner); err != nil {
+			return errorResponse(c, err, "Failed to get playlist")
+		}
 
-		updated, err := service.UpdatePlaylist(id, updates)
+		userID, _ := middleware.GetUserID(c)
+		playlist, err := service.ClearRules(id, userID)
 		if err != nil {
+			return errorResponse(c, err, "Failed to remove playlist rules")
+		}
+
+		return c.JSON(playlist)
+	})
+
+	// Save the current tracks of a smart playlist as a new regular playlist: {"name", "is_public"}
+	app.Post("/playlists/:id/snapshot", requireAuth, func(c *fiber.Ctx) error {
+		id := c.Params("id")
+
+		source, err := service.GetPlaylistByID(id)
+		if err != nil || !canView(c, config, source) {
+			return c.Status(404).JSON(fiber.Map{
+				"error": "Playlist not found",
+			})
+		}
+
+		var body struct {
+			Name     string `json:"name"`
+			IsPublic bool   `json:"is_public"`
+		}
+		if len(c.Body()) > 0 {
+			if err := c.BodyParser(&body); err != nil {
+				return c.Status(400).JSON(fiber.Map{
+					"error": "Invalid request",
+				})
+			}
+		}
+
+		userID, _ := middleware.GetUserID(c)
+		snapshot, err := service.SnapshotRules(id, body.Name, userID, body.IsPublic)
+		if err != nil {
+			return errorResponse(c, err, "Failed to snapshot playlist")
+		}
+
+		return c.Status(201).JSON(snapshot)
+	})
+
+	// Check whether the current user follows a playlist
+	app.Get("/playlists/:id/follow", requireAuth, func(c *fiber.Ctx) error {
+		playlist, err := service.GetPlaylistByID(c.Params("id"))
+		if err != nil || !canView(c, config, playlist) {
+			return c.Status(404).JSON(fiber.Map{
+				"error": "Playlist not found",
+			})
+		}
+
+		userID, _ := middleware.GetUserID(c)
+		following, err := service.IsFollowing(playlist.ID.Hex(), userID)
+		if err != nil {
+			return errorResponse(c, err, "Failed to get follow")
+		}
+
+		return c.JSON(fiber.Map{
+			"following":      following,
+			"follower_count": playlist.FollowerCount,
+		})
+	})
+
+	// Follow a playlist
+	app.Put("/playlists/:id/follow", requireAuth, func(c *fiber.Ctx) error {
+		playlist, err := service.GetPlaylistByID(c.Params("id"))
+		if err != nil || !canView(c, config, playlist) {
+			return c.Status(404).JSON(fiber.Map{
+				"error": "Playlist not found",
+			})
+		}
+
+		userID, _ := middleware.GetUserID(c)
+		follow, err := service.FollowPlaylist(playlist, userID)
+		if err != nil {
+			return errorResponse(c, err, "Failed to follow playlist")
+		}
+
+		return c.JSON(follow)
+	})
+
+	// Unfollow a playlist
+	app.Delete("/playlists/:id/follow", requireAuth, func(c *fiber.Ctx) error {
+		userID, _ := middleware.GetUserID(c)
+		if err := service.UnfollowPlaylist(c.Params("id"), userID); err != nil {
+			return errorResponse(c, err, "Failed to unfollow playlist")
+		}
+
+		return c.SendStatus(204)
+	})
+
+	// Copy a playlist into the caller's account: {"name", "is_public"}
+	app.Post("/playlists/:id/fork", requireAuth, func(c *fiber.Ctx) error {
+		source, err := service.GetPlaylistByID(c.Params("id"))
+		if err != nil || !canView(c, config, source) {
+			return c.Status(404).JSON(fiber.Map{
+				"error": "Playlist not found",
+			})
+		}
+
+		var body struct {
+			Name     string `json:"name"`
+			IsPublic bool   `json:"is_public"`
+		}
+		if len(c.Body()) > 0 {
+			if err := c.BodyParser(&body); err != nil {
+				return c.Status(400).JSON(fiber.Map{
+					"error": "Invalid request",
+				})
+			}
+		}
+
+		name := strings.TrimSpace(body.Name)
+		if len(name) > MaxNameLength {
+			return c.Status(400).JSON(fiber.Map{
+				"error": fmt.Sprintf("name must be at most %d characters", MaxNameLength),
+			})
+		}
+
+		userID, _ := middleware.GetUserID(c)
+		fork, err := service.ForkPlaylist(source, userID, name, body.IsPublic)
+		if err != nil {
+			return errorResponse(c, err, "Failed to fork playlist")
+		}
+
+		return c.Status(201).JSON(fork)
+	})
+
+	// Upload a custom cover image (multipart "cover"), replacing the generated mosaic
+	app.Put("/playlists/:id/cover", requireAuth, func(c *fiber.Ctx) error {
+		id := c.Params("id")
+
+		if _, err := authorize(c, service, config, id, RoleOwner); err != nil {
+			return errorResponse(c, err, "Failed to get playlist")
+		}
+
+		fileHeader, err := c.FormFile("cover")
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "No cover image provided",
+			})
+		}
+		if fileHeader.Size > MaxCoverImageSize {
+			return c.Status(400).JSON(fiber.Map{
+				"error": fmt.Sprintf("Cover image must be at most %d MB", MaxCoverImageSize/(1024*1024)),
+			})
+		}
+		switch fileHeader.Header.Get("Content-Type") {
+		case "image/jpeg", "image/jpg", "image/png", "image/webp":
+		default:
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Cover must be a JPEG, PNG or WebP image",
+			})
+		}
+
+		userID, _ := middleware.GetUserID(c)
+		playlist, err := service.SetCustomCover(id, fileHeader, userID)
+		if err != nil {
+			if errors.Is(err, ErrStorageUnavailable) {
+				return c.Status(503).JSON(fiber.Map{
+					"error": err.Error(),
+				})
+			}
+			return errorResponse(c, err, "Failed to save cover image")
+		}
+
+		return c.JSON(playlist)
+	})
+
+	// Remove the custom cover and go back to a generated mosaic
+	app.Delete("/playlists/:id/cover", requireAuth, func(c *fiber.Ctx) error {
+		id := c.Params("id")
+
+		if _, err := authorize(c, service, config, id, RoleOwner); err != nil {
+			return errorResponse(c, err, "Failed to get playlist")
+		}
+
+		userID, _ := middleware.GetUserID(c)
+		playlist, err := service.RemoveCustomCover(id, userID)
+		if err != nil {
+			return errorResponse(c, err, "Failed to remove cover")
+		}
+
+		return c.JSON(playlist)
+	})
+
+	// Update playlist
+	app.Put("/playlists/:id", requireAuth, func(c *fiber.Ctx) error {
+		id := c.Params("id")
+
+		if _, err := authorize(c, service, config, id, RoleOwner); err != nil {
+			return errorResponse(c, err, "Failed to get playlist")
+		}
+
+		var update PlaylistUpdate
+		if errs := validation.DecodeStrict(c.Body(), &update, PlaylistReadOnlyFields...); len(errs) > 0 {
+			return validation.Response(c, errs)
+		}
+
+		userID, _ := middleware.GetUserID(c)
+		updated, err := service.UpdatePlaylist(id, update, userID)
+		if err != nil {
+			var validationErrs validation.Errors
+			if errors.As(err, &validationErrs) {
+				return validation.Response(c, validationErrs)
+			}
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return c.Status(404).JSON(fiber.Map{
+					"error": "Playlist not found",
+				})
+			}
 			return c.Status(500).JSON(fiber.Map{
 				"error": "Failed to update playlist",
 			})
@@ -90,10 +535,20 @@ func RegisterRoutes(app *fiber.App, service *PlaylistService) {
 	})
 
 	// Delete playlist
-	app.Delete("/playlists/:id", func(c *fiber.Ctx) error {
+	app.Delete("/playlists/:id", requireAuth, func(c *fiber.Ctx) error {
 		id := c.Params("id")
 
-		if err := service.DeletePlaylist(id); err != nil {
+		if _, err := authorize(c, service, config, id, RoleOwner); err != nil {
+			return errorResponse(c, err, "Failed to get playlist")
+		}
+
+		userID, _ := middleware.GetUserID(c)
+		if err := service.DeletePlaylist(id, userID); err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return c.Status(404).JSON(fiber.Map{
+					"error": "Playlist not found",
+				})
+			}
 			return c.Status(500).JSON(fiber.Map{
 				"error": "Failed to delete playlist",
 			})
@@ -102,12 +557,20 @@ func RegisterRoutes(app *fiber.App, service *PlaylistService) {
 		return c.SendStatus(204)
 	})
 
-	// Add track to playlist
-	app.Post("/playlists/:id/tracks", func(c *fiber.Ctx) error {
+	// Add tracks to playlist: {"track_id"} or {"track_ids": [...]}, optionally at "position".
+	// Pass the "version" last seen to reject the edit if someone else changed the playlist.
+	app.Post("/playlists/:id/tracks", requireAuth, func(c *fiber.Ctx) error {
 		playlistID := c.Params("id")
 
+		if _, err := authorize(c, service, config, playlistID, RoleEditor); err != nil {
+			return errorResponse(c, err, "Failed to get playlist")
+		}
+
 		var body struct {
-			TrackID string `json:"track_id"`
+			TrackID  string   `json:"track_id"`
+			TrackIDs []string `json:"track_ids"`
+			Position *int     `json:"position"`
+			Version  *int     `json:"version"`
 		}
 
 		if err := c.BodyParser(&body); err != nil {
@@ -116,32 +579,557 @@ func RegisterRoutes(app *fiber.App, service *PlaylistService) {
 			})
 		}
 
-		if body.TrackID == "" {
+		trackIDs := body.TrackIDs
+		if body.TrackID != "" {
+			trackIDs = append([]string{body.TrackID}, trackIDs...)
+		}
+		if len(trackIDs) == 0 {
 			return c.Status(400).JSON(fiber.Map{
 				"error": "track_id is required",
 			})
 		}
 
-		if err := service.AddTrackToPlaylist(playlistID, body.TrackID); err != nil {
-			return c.Status(500).JSON(fiber.Map{
-				"error": "Failed to add track to playlist",
+		userID, _ := middleware.GetUserID(c)
+		playlist, err := service.AddTracks(playlistID, trackIDs, body.Position, userID, body.Version)
+		if err != nil {
+			return errorResponse(c, err, "Failed to add track to playlist")
+		}
+
+		return c.JSON(playlist)
+	})
+
+	// Remove several entries: {"entry_ids": [...], "version": n}
+	app.Delete("/playlists/:id/tracks", requireAuth, func(c *fiber.Ctx) error {
+		playlistID := c.Params("id")
+
+		if _, err := authorize(c, service, config, playlistID, RoleEditor); err != nil {
+			return errorResponse(c, err, "Failed to get playlist")
+		}
+
+		var body struct {
+			EntryIDs []string `json:"entry_ids"`
+			Version  *int     `json:"version"`
+		}
+
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid request",
+			})
+		}
+
+		if len(body.EntryIDs) == 0 {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "entry_ids is required",
+			})
+		}
+
+		userID, _ := middleware.GetUserID(c)
+		playlist, err := service.RemoveEntries(playlistID, body.EntryIDs, userID, body.Version)
+		if err != nil {
+			return errorResponse(c, err, "Failed to remove tracks from playlist")
+		}
+
+		return c.JSON(playlist)
+	})
+
+	// Remove one entry (a track ID removes every entry of that track), optionally ?version=n
+	app.Delete("/playlists/:id/tracks/:entryId", requireAuth, func(c *fiber.Ctx) error {
+		playlistID := c.Params("id")
+
+		if _, err := authorize(c, service, config, playlistID, RoleEditor); err != nil {
+			return errorResponse(c, err, "Failed to get playlist")
+		}
+
+		version, err := queryVersion(c)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "version must be a number",
 			})
 		}
 
+		userID, _ := middleware.GetUserID(c)
+		if _, err := service.RemoveEntries(playlistID, []string{c.Params("entryId")}, userID, version); err != nil {
+			return errorResponse(c, err, "Failed to remove track from playlist")
+		}
+
 		return c.SendStatus(204)
 	})
 
-	// Remove track from playlist
-	app.Delete("/playlists/:id/tracks/:trackId", func(c *fiber.Ctx) error {
+	// Move an entry: {"position": n, "version": n}
+	app.Patch("/playlists/:id/tracks/:entryId", requireAuth, func(c *fiber.Ctx) error {
 		playlistID := c.Params("id")
-		trackID := c.Params("trackId")
 
-		if err := service.RemoveTrackFromPlaylist(playlistID, trackID); err != nil {
+		if _, err := authorize(c, service, config, playlistID, RoleEditor); err != nil {
+			return errorResponse(c, err, "Failed to get playlist")
+		}
+
+		var body struct {
+			Position *int `json:"position"`
+			Version  *int `json:"version"`
+		}
+
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid request",
+			})
+		}
+
+		if body.Position == nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "position is required",
+			})
+		}
+
+		userID, _ := middleware.GetUserID(c)
+		playlist, err := service.MoveEntry(playlistID, c.Params("entryId"), *body.Position, userID, body.Version)
+		if err != nil {
+			return errorResponse(c, err, "Failed to move track")
+		}
+
+		return c.JSON(playlist)
+	})
+
+	// Change log of a playlist, newest first (?page=&limit=). Members and admins only.
+	app.Get("/playlists/:id/history", requireAuth, func(c *fiber.Ctx) error {
+		playlist, err := authorize(c, service, config, c.Params("id"), RoleViewer)
+		if err != nil {
+			return errorResponse(c, err, "Failed to get playlist")
+		}
+
+		history, err := service.GetHistory(playlist, c.QueryInt("page", 1), c.QueryInt("limit", defaultHistoryPageSize))
+		if err != nil {
+			return errorResponse(c, err, "Failed to get playlist history")
+		}
+
+		return c.JSON(history)
+	})
+
+	// One change with the playlist as it was at that version
+	app.Get("/playlists/:id/history/:version", requireAuth, func(c *fiber.Ctx) error {
+		playlist, err := authorize(c, service, config, c.Params("id"), RoleViewer)
+		if err != nil {
+			return errorResponse(c, err, "Failed to get playlist")
+		}
+
+		version, err := strconv.Atoi(c.Params("version"))
+		if err != nil || version < 0 {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid version",
+			})
+		}
+
+		change, err := service.GetChange(playlist.ID, version)
+		if err != nil {
+			return errorResponse(c, err, "Failed to get playlist change")
+		}
+
+		return c.JSON(change)
+	})
+
+	// Roll back to an earlier version: ?version=n. The owner restores everything but the cover;
+	// with ?scope=tracks only the tracks come back, which editors may do too.
+	// Optionally ?expected_version=n rejects the restore if someone else changed the playlist.
+	app.Post("/playlists/:id/restore", requireAuth, func(c *fiber.Ctx) error {
+		id := c.Params("id")
+
+		scope := c.Query("scope", "all")
+		if scope != "all" && scope != "tracks" {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "scope must be all or tracks",
+			})
+		}
+		role := RoleOwner
+		if scope == "tracks" {
+			role = RoleEditor
+		}
+		if _, err := authorize(c, service, config, id, role); err != nil {
+			return errorResponse(c, err, "Failed to get playlist")
+		}
+
+		version, err := strconv.Atoi(c.Query("version"))
+		if err != nil || version < 0 {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "version is required",
+			})
+		}
+
+		var expectedVersion *int
+		if raw := c.Query("expected_version"); raw != "" {
+			expected, err := strconv.Atoi(raw)
+			if err != nil {
+				return c.Status(400).JSON(fiber.Map{
+					"error": "expected_version must be a number",
+				})
+			}
+			expectedVersion = &expected
+		}
+
+		userID, _ := middleware.GetUserID(c)
+		playlist, err := service.RestoreVersion(id, version, scope == "tracks", userID, expectedVersion)
+		if err != nil {
+			return errorResponse(c, err, "Failed to restore playlist")
+		}
+
+		if err := service.ResolveSmart(playlist); err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error": "Failed to evaluate playlist rules",
+			})
+		}
+
+		return c.JSON(playlist)
+	})
+
+	registerCollaboratorRoutes(app, service, config)
+}
+
+// RegisterUserRoutes registers the followed playlists library on the authenticated /me group
+func RegisterUserRoutes(router fiber.Router, service *PlaylistService) {
+	// Playlists the current user follows, most recently followed first
+	router.Get("/playlists/followed", func(c *fiber.Ctx) error {
+		userID, err := middleware.GetUserID(c)
+		if err != nil {
+			return c.Status(401).JSON(fiber.Map{
+				"error": "Unauthorized",
+			})
+		}
+
+		playlists, err := service.GetFollowedPlaylists(userID)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error": "Failed to get followed playlists",
+			})
+		}
+
+		return c.JSON(playlists)
+	})
+}
+
+// RegisterAdminRoutes registers playlist maintenance on the /admin group
+func RegisterAdminRoutes(router fiber.Router, service *PlaylistService) {
+	// Report playlists referencing missing or trashed tracks without changing anything
+	router.Get("/integrity/playlists", func(c *fiber.Ctx) error {
+		report, err := service.CheckConsistency(false)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error": "Failed to check playlists",
+			})
+		}
+
+		return c.JSON(report)
+	})
+
+	// Repair the playlists the check reports
+	router.Post("/integrity/playlists/repair", func(c *fiber.Ctx) error {
+		report, err := service.CheckConsistency(true)
+		if err != nil {
 			return c.Status(500).JSON(fiber.Map{
-				"error": "Failed to remove track from playlist",
+				"error": "Failed to repair playlists",
 			})
 		}
 
+		return c.JSON(report)
+	})
+}
+
+// registerCollaboratorRoutes registers sharing: invites, accepting them and managing collaborators
+func registerCollaboratorRoutes(app *fiber.App, service *PlaylistService, config *middleware.SupabaseConfig) {
+	requireAuth := middleware.SupabaseAuth(config)
+
+	// List the owner and collaborators
+	app.Get("/playlists/:id/collaborators", requireAuth, func(c *fiber.Ctx) error {
+		playlist, err := authorize(c, service, config, c.Params("id"), RoleViewer)
+		if err != nil {
+			return errorResponse(c, err, "Failed to get playlist")
+		}
+
+		collaborators := playlist.Collaborators
+		if collaborators == nil {
+			collaborators = []Collaborator{}
+		}
+
+		return c.JSON(fiber.Map{
+			"owner":         playlist.CreatedBy,
+			"collaborators": collaborators,
+		})
+	})
+
+	// Change a collaborator's role
+	app.Put("/playlists/:id/collaborators/:userId", requireAuth, func(c *fiber.Ctx) error {
+		id := c.Params("id")
+
+		if _, err := authorize(c, service, config, id, RoleOwner); err != nil {
+			return errorResponse(c, err, "Failed to get playlist")
+		}
+
+		var body struct {
+			Role string `json:"role"`
+		}
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid request",
+			})
+		}
+
+		actorID, _ := middleware.GetUserID(c)
+		playlist, err := service.SetCollaboratorRole(id, c.Params("userId"), body.Role, actorID)
+		if err != nil {
+			return errorResponse(c, err, "Failed to update collaborator")
+		}
+
+		return c.JSON(playlist)
+	})
+
+	// Remove a collaborator (the owner can remove anyone, collaborators can leave)
+	app.Delete("/playlists/:id/collaborators/:userId", requireAuth, func(c *fiber.Ctx) error {
+		id := c.Params("id")
+		targetID := c.Params("userId")
+
+		role := RoleOwner
+		if actorID, _ := middleware.GetUserID(c); actorID == targetID {
+			role = RoleViewer
+		}
+		if _, err := authorize(c, service, config, id, role); err != nil {
+			return errorResponse(c, err, "Failed to get playlist")
+		}
+
+		actorID, _ := middleware.GetUserID(c)
+		if _, err := service.RemoveCollaborator(id, targetID, actorID); err != nil {
+			return errorResponse(c, err, "Failed to remove collaborator")
+		}
+
+		return c.SendStatus(204)
+	})
+
+	// Create an invite link
+	app.Post("/playlists/:id/invites", requireAuth, func(c *fiber.Ctx) error {
+		id := c.Params("id")
+
+		if _, err := authorize(c, service, config, id, RoleOwner); err != nil {
+			return errorResponse(c, err, "Failed to get playlist")
+		}
+
+		var body struct {
+			Role           string `json:"role"`
+			ExpiresInHours int    `json:"expires_in_hours"`
+		}
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid request",
+			})
+		}
+		if body.Role == "" {
+			body.Role = RoleEditor
+		}
+
+		userID, _ := middleware.GetUserID(c)
+		invite, err := service.CreateInvite(id, body.Role, userID, time.Duration(body.ExpiresInHours)*time.Hour)
+		if err != nil {
+			return errorResponse(c, err, "Failed to create invite")
+		}
+
+		return c.Status(201).JSON(invite)
+	})
+
+	// List active invites
+	app.Get("/playlists/:id/invites", requireAuth, func(c *fiber.Ctx) error {
+		id := c.Params("id")
+
+		if _, err := authorize(c, service, config, id, RoleOwner); err != nil {
+			return errorResponse(c, err, "Failed to get playlist")
+		}
+
+		invites, err := service.GetInvites(id)
+		if err != nil {
+			return errorResponse(c, err, "Failed to get invites")
+		}
+
+		return c.JSON(invites)
+	})
+
+	// Revoke an invite
+	app.Delete("/playlists/:id/invites/:inviteId", requireAuth, func(c *fiber.Ctx) error {
+		id := c.Params("id")
+
+		if _, err := authorize(c, service, config, id, RoleOwner); err != nil {
+			return errorResponse(c, err, "Failed to get playlist")
+		}
+
+		if err := service.RevokeInvite(id, c.Params("inviteId")); err != nil {
+			return errorResponse(c, err, "Failed to revoke invite")
+		}
+
 		return c.SendStatus(204)
 	})
+
+	// Preview an invite before accepting it
+	app.Get("/playlists/invites/:token", requireAuth, func(c *fiber.Ctx) error {
+		invite, err := service.GetInvite(c.Params("token"))
+		if err != nil {
+			return errorResponse(c, err, "Failed to get invite")
+		}
+
+		playlist, err := service.GetPlaylistByID(invite.PlaylistID.Hex())
+		if err != nil {
+			return errorResponse(c, ErrInviteInvalid, "Failed to get invite")
+		}
+
+		return c.JSON(fiber.Map{
+			"playlist_id":   playlist.ID,
+			"playlist_name": playlist.Name,
+			"owner":         playlist.CreatedBy,
+			"role":          invite.Role,
+			"expires_at":    invite.ExpiresAt,
+		})
+	})
+
+	// Accept an invite and join the playlist
+	app.Post("/playlists/invites/:token/accept", requireAuth, func(c *fiber.Ctx) error {
+		userID, err := middleware.GetUserID(c)
+		if err != nil {
+			return errorResponse(c, ErrUnauthorized, "Unauthorized")
+		}
+
+		playlist, err := service.AcceptInvite(c.Params("token"), userID)
+		if err != nil {
+			return errorResponse(c, err, "Failed to accept invite")
+		}
+
+		return c.JSON(playlist)
+	})
+}
+
+var (
+	ErrUnauthorized = errors.New("authentication required")
+	ErrForbidden    = errors.New("you do not have permission to change this playlist")
+)
+
+// authorize loads a playlist and checks that the caller has at least the given role on it.
+// Admins pass every check.
+func authorize(c *fiber.Ctx, service *PlaylistService, config *middleware.SupabaseConfig, id, role string) (*Playlist, error) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return nil, ErrUnauthorized
+	}
+
+	playlist, err := service.GetPlaylistByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if roleRank[playlist.RoleOf(userID)] >= roleRank[role] {
+		return playlist, nil
+	}
+
+	isAdmin, err := middleware.IsAdmin(c, config)
+	if err != nil {
+		return nil, err
+	}
+	if !isAdmin {
+		return nil, ErrForbidden
+	}
+
+	return playlist, nil
+}
+
+// errorResponse maps service and authorization errors to HTTP status codes
+func errorResponse(c *fiber.Ctx, err error, fallback string) error {
+	switch {
+	case errors.Is(err, ErrUnauthorized):
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthorized"})
+	case errors.Is(err, ErrForbidden):
+		return c.Status(403).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, ErrInvalidRole), errors.Is(err, ErrFollowOwn):
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, ErrInviteInvalid):
+		return c.Status(410).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, ErrUnknownFormat), errors.Is(err, ErrEmptyImport):
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, music.ErrInvalidQuery):
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, ErrSmartPlaylist), errors.Is(err, ErrNotSmart):
+		return c.Status(409).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, ErrVersionConflict):
+		return c.Status(409).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, ErrEntryNotFound), errors.Is(err, ErrTrackNotFound), errors.Is(err, ErrChangeNotFound):
+		return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, ErrInvalidPosition), errors.Is(err, ErrBatchTooLarge), errors.Is(err, ErrPlaylistFull),
+		errors.Is(err, ErrAlreadyAtChange):
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, primitive.ErrInvalidHex):
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid ID"})
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return c.Status(404).JSON(fiber.Map{"error": "Playlist not found"})
+	default:
+		return c.Status(500).JSON(fiber.Map{"error": fallback})
+	}
+}
+
+// parseRulesBody reads smart playlist rules from a request body, as query text in "query" or
+// as a rule tree in "rules". It returns nil when neither is present.
+func parseRulesBody(c *fiber.Ctx) (*music.Query, error) {
+	var body struct {
+		Query string       `json:"query"`
+		Rules *music.Query `json:"rules"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return nil, errors.New("invalid request body")
+	}
+
+	if body.Query != "" {
+		return music.ParseQuery(body.Query)
+	}
+	if body.Rules != nil {
+		if err := body.Rules.Validate(); err != nil {
+			return nil, err
+		}
+		return body.Rules, nil
+	}
+	return nil, nil
+}
+
+// queryVersion reads the optional ?version= expected playlist version
+func queryVersion(c *fiber.Ctx) (*int, error) {
+	raw := c.Query("version")
+	if raw == "" {
+		return nil, nil
+	}
+	version, err := strconv.Atoi(raw)
+	if err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
+
+// exportFileName makes a playlist name safe for a Content-Disposition file name
+func exportFileName(name string) string {
+	safe := strings.Map(func(r rune) rune {
+		switch {
+		case r < 0x20, r == 0x7f, strings.ContainsRune(`"\/:*?<>|`, r):
+			return '_'
+		default:
+			return r
+		}
+	}, strings.TrimSpace(name))
+	if safe == "" {
+		return "playlist"
+	}
+	return safe
+}
+
+// canView reports whether the caller may see a playlist: public, shared with them, or viewed by an admin
+func canView(c *fiber.Ctx, config *middleware.SupabaseConfig, playlist *Playlist) bool {
+	if playlist.IsPublic {
+		return true
+	}
+
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return false
+	}
+	if playlist.RoleOf(userID) != "" {
+		return true
+	}
+
+	isAdmin, err := middleware.IsAdmin(c, config)
+	return err == nil && isAdmin
 }
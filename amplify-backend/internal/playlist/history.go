@@ -0,0 +1,364 @@
+package playlist
+
+import (
+	"amplify-backend/internal/music"
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Page sizes for the change history
+const (
+	defaultHistoryPageSize = 50
+	maxHistoryPageSize     = 200
+)
+
+var (
+	ErrChangeNotFound  = errors.New("no recorded change for that playlist version")
+	ErrAlreadyAtChange = errors.New("playlist is already at that version")
+)
+
+// Change actions. Track and metadata actions match the playlist events they are recorded with.
+const (
+	ChangeCreated        = "created"
+	ChangeUpdated        = "updated" // Name, description, cover or visibility; see Fields
+	ChangeTrackAdded     = "track_added"
+	ChangeTrackRemoved   = "track_removed"
+	ChangeTrackMoved     = "track_moved"
+	ChangeRulesUpdated   = "rules_updated"
+	ChangeRulesRemoved   = "rules_removed"
+	ChangeTracksRepaired = "tracks_repaired" // Integrity repair of dangling or stale entries
+	ChangeRestored       = "restored"        // From the trash, or to an earlier version (see RestoredFrom)
+)
+
+// PlaylistChange is one entry in a playlist's append-only change log. Every change that bumps
+// the playlist version is recorded with the state it produced, so any version can be restored.
+type PlaylistChange struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	PlaylistID   primitive.ObjectID `bson:"playlist_id" json:"playlist_id"`
+	Version      int                `bson:"version" json:"version"` // Playlist version after the change
+	Action       string             `bson:"action" json:"action"`
+	ActorID      string             `bson:"actor_id,omitempty" json:"actor_id,omitempty"`   // Empty for system changes such as purged tracks
+	Fields       []string           `bson:"fields,omitempty" json:"fields,omitempty"`       // Metadata fields set by an update or restore
+	EntryIDs     []string           `bson:"entry_ids,omitempty" json:"entry_ids,omitempty"` // Entries added, removed or moved
+	TrackID      string             `bson:"track_id,omitempty" json:"track_id,omitempty"`   // Track purged from the catalog
+	TrackCount   int                `bson:"track_count" json:"track_count"`
+	RestoredFrom *int               `bson:"restored_from,omitempty" json:"restored_from,omitempty"` // Version brought back by a restore
+	Snapshot     *PlaylistSnapshot  `bson:"snapshot,omitempty" json:"snapshot,omitempty"`           // Left out of history listings
+	CreatedAt    time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// PlaylistSnapshot is the restorable state of a playlist after a change. Entries are only
+// stored when the change touched them (and on a playlist's first recorded change); the
+// entries at any version are those of the latest change at or before it that stored them.
+type PlaylistSnapshot struct {
+	Name        string       `bson:"name" json:"name"`
+	Description string       `bson:"description,omitempty" json:"description,omitempty"`
+	CoverArt    string       `bson:"cover_art,omitempty" json:"cover_art,omitempty"`
+	IsPublic    bool         `bson:"is_public" json:"is_public"`
+	Rules       *music.Query `bson:"rules,omitempty" json:"rules,omitempty"`
+	HasEntries  bool         `bson:"has_entries" json:"-"`
+	Entries     []Entry      `bson:"entries,omitempty" json:"entries"`
+}
+
+// HistoryPage is one page of a playlist's change log, newest first
+type HistoryPage struct {
+	Changes []PlaylistChange `json:"changes"`
+	Version int              `json:"version"` // Current playlist version
+	Page    int              `json:"page"`
+	Limit   int              `json:"limit"`
+	HasMore bool             `json:"has_more"`
+}
+
+// ensureHistoryIndexes creates the (playlist_id, version) index behind history reads and restores
+func (s *PlaylistService) ensureHistoryIndexes(ctx context.Context) error {
+	_, err := s.HistoryCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "playlist_id", Value: 1}, {Key: "version", Value: -1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+// recordChange appends a change with the playlist's current state to the change log. The
+// playlist write has already happened, so a failure is logged rather than returned.
+func (s *PlaylistService) recordChange(p *Playlist, change PlaylistChange, entriesChanged bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// The first change recorded for a playlist older than the change log carries its entries,
+	// so every later version can be restored
+	if !entriesChanged {
+		count, err := s.HistoryCollection.CountDocuments(ctx, bson.M{"playlist_id": p.ID}, options.Count().SetLimit(1))
+		if err != nil {
+			log.Printf("Failed to record change to playlist %s: %v", p.ID.Hex(), err)
+			return
+		}
+		entriesChanged = count == 0
+	}
+
+	snapshot := &PlaylistSnapshot{
+		Name:        p.Name,
+		Description: p.Description,
+		CoverArt:    p.CoverArt,
+		IsPublic:    p.IsPublic,
+		Rules:       p.Rules,
+		HasEntries:  entriesChanged,
+	}
+	if entriesChanged && p.Rules == nil {
+		snapshot.Entries = normalizeEntries(p)
+	}
+
+	change.PlaylistID = p.ID
+	change.Version = p.Version
+	change.TrackCount = len(p.TrackIDs)
+	change.Snapshot = snapshot
+	if change.CreatedAt.IsZero() {
+		change.CreatedAt = p.UpdatedAt
+	}
+
+	if _, err := s.HistoryCollection.InsertOne(ctx, change); err != nil {
+		log.Printf("Failed to record change to playlist %s at version %d: %v", p.ID.Hex(), p.Version, err)
+	}
+}
+
+// GetHistory returns one page of a playlist's change log, newest first, without snapshots
+func (s *PlaylistService) GetHistory(p *Playlist, page, limit int) (*HistoryPage, error) {
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = defaultHistoryPageSize
+	}
+	if limit > maxHistoryPageSize {
+		limit = maxHistoryPageSize
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// One extra change tells whether there is another page
+	cursor, err := s.HistoryCollection.Find(
+		ctx,
+		bson.M{"playlist_id": p.ID},
+		options.Find().
+			SetSort(bson.D{{Key: "version", Value: -1}}).
+			SetSkip(int64((page-1)*limit)).
+			SetLimit(int64(limit+1)).
+			SetProjection(bson.M{"snapshot": 0}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	changes := []PlaylistChange{}
+	if err := cursor.All(ctx, &changes); err != nil {
+		return nil, err
+	}
+
+	result := &HistoryPage{Version: p.Version, Page: page, Limit: limit}
+	if len(changes) > limit {
+		changes = changes[:limit]
+		result.HasMore = true
+	}
+	result.Changes = changes
+	return result, nil
+}
+
+// GetChange returns the change that produced a version, with the full playlist state at that version
+func (s *PlaylistService) GetChange(playlistID primitive.ObjectID, version int) (*PlaylistChange, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var change PlaylistChange
+	err := s.HistoryCollection.FindOne(ctx, bson.M{"playlist_id": playlistID, "version": version}).Decode(&change)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrChangeNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if change.Snapshot == nil {
+		return nil, ErrChangeNotFound
+	}
+	if change.Snapshot.HasEntries || change.Snapshot.Rules != nil {
+		if change.Snapshot.Entries == nil {
+			change.Snapshot.Entries = []Entry{}
+		}
+		return &change, nil
+	}
+
+	// Metadata-only change: the entries are those of the latest earlier change that stored them
+	var withEntries PlaylistChange
+	err = s.HistoryCollection.FindOne(
+		ctx,
+		bson.M{"playlist_id": playlistID, "version": bson.M{"$lte": version}, "snapshot.has_entries": true},
+		options.FindOne().
+			SetSort(bson.D{{Key: "version", Value: -1}}).
+			SetProjection(bson.M{"snapshot.entries": 1}),
+	).Decode(&withEntries)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrChangeNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	change.Snapshot.Entries = []Entry{}
+	if withEntries.Snapshot != nil && withEntries.Snapshot.Entries != nil {
+		change.Snapshot.Entries = withEntries.Snapshot.Entries
+	}
+	return &change, nil
+}
+
+// RestoreVersion rolls a playlist back to the state recorded at an earlier version. The
+// restore is a new change on top of the log, so it can itself be undone. With tracksOnly set
+// only the tracks (or rules) come back and the name, description and visibility stay as they
+// are. The cover is never restored: a mosaic is rebuilt from the restored tracks and an
+// uploaded cover stays in place. Entries whose track was purged since are dropped, and
+// entries of tracks now in the trash are marked unavailable.
+func (s *PlaylistService) RestoreVersion(playlistID string, version int, tracksOnly bool, actorID string, expectedVersion *int) (*Playlist, error) {
+	attempts := conflictRetries
+	if expectedVersion != nil {
+		attempts = 1
+	}
+
+	for attempt := 0; attempt < attempts; attempt++ {
+		playlist, err := s.GetPlaylistByID(playlistID)
+		if err != nil {
+			return nil, err
+		}
+		if expectedVersion != nil && *expectedVersion != playlist.Version {
+			return nil, ErrVersionConflict
+		}
+		if version == playlist.Version {
+			return nil, ErrAlreadyAtChange
+		}
+		if version < 0 || version > playlist.Version {
+			return nil, ErrChangeNotFound
+		}
+
+		change, err := s.GetChange(playlist.ID, version)
+		if err != nil {
+			return nil, err
+		}
+		target := change.Snapshot
+
+		// Editors can change tracks but not rules, so a tracks-only restore keeps the playlist's kind
+		if tracksOnly && (playlist.Rules != nil || target.Rules != nil) {
+			return nil, ErrSmartPlaylist
+		}
+
+		now := time.Now()
+		set := bson.M{"version": playlist.Version + 1, "updated_at": now}
+		unset := bson.M{}
+		var fields []string
+
+		if !tracksOnly {
+			set["name"] = target.Name
+			set["description"] = target.Description
+			set["is_public"] = target.IsPublic
+			fields = append(fields, "name", "description", "is_public")
+		}
+
+		if target.Rules != nil {
+			set["rules"] = target.Rules
+			set["entries"] = bson.A{}
+			set["track_ids"] = bson.A{}
+			fields = append(fields, "rules")
+		} else {
+			entries, err := s.restorableEntries(target.Entries)
+			if err != nil {
+				return nil, err
+			}
+			set["entries"] = entries
+			set["track_ids"] = trackIDsOf(entries)
+			if playlist.Rules != nil {
+				unset["rules"] = ""
+				fields = append(fields, "rules")
+			}
+		}
+
+		changes := bson.M{"$set": set}
+		if len(unset) > 0 {
+			changes["$unset"] = unset
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		var updated Playlist
+		err = s.PlaylistCollection.FindOneAndUpdate(
+			ctx,
+			versionFilter(playlist.ID, playlist.Version),
+			changes,
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&updated)
+		cancel()
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		updated.Entries = normalizeEntries(&updated)
+		s.recordChange(&updated, PlaylistChange{
+			Action:       ChangeRestored,
+			ActorID:      actorID,
+			Fields:       fields,
+			RestoredFrom: &version,
+		}, true)
+		s.scheduleCover(updated.ID)
+		s.notify(&updated, PlaylistEvent{Action: "restored", ActorID: actorID, Version: updated.Version})
+		return &updated, nil
+	}
+
+	return nil, ErrVersionConflict
+}
+
+// restorableEntries brings recorded entries in line with the catalog as it is now
+func (s *PlaylistService) restorableEntries(recorded []Entry) ([]Entry, error) {
+	entries := []Entry{}
+	if len(recorded) == 0 {
+		return entries, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := s.TrackCollection.Find(
+		ctx,
+		bson.M{"_id": bson.M{"$in": trackIDsOf(recorded)}},
+		options.Find().SetProjection(bson.M{"_id": 1, "deleted_at": 1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	var tracks []struct {
+		ID        primitive.ObjectID `bson:"_id"`
+		DeletedAt *time.Time         `bson:"deleted_at"`
+	}
+	if err := cursor.All(ctx, &tracks); err != nil {
+		return nil, err
+	}
+
+	deletedAt := make(map[primitive.ObjectID]*time.Time, len(tracks))
+	for _, track := range tracks {
+		deletedAt[track.ID] = track.DeletedAt
+	}
+
+	for _, entry := range recorded {
+		trashed, ok := deletedAt[entry.TrackID]
+		if !ok {
+			continue
+		}
+		entry.TrackDeletedAt = trashed
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
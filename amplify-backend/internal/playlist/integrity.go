@@ -0,0 +1,318 @@
+package playlist
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// integrityBatchSize is how many playlists are checked per track lookup
+const integrityBatchSize = 500
+
+// TrackTrashed marks the track's entries as unavailable. Positions do not change, so the
+// playlist version is left alone and pending edits still apply.
+func (s *PlaylistService) TrackTrashed(trackID primitive.ObjectID, deletedAt time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := s.PlaylistCollection.UpdateMany(
+		ctx,
+		bson.M{"entries.track_id": trackID},
+		bson.M{"$set": bson.M{"entries.$[entry].track_deleted_at": deletedAt}},
+		options.Update().SetArrayFilters(options.ArrayFilters{
+			Filters: []interface{}{bson.M{"entry.track_id": trackID}},
+		}),
+	)
+	if err != nil {
+		return err
+	}
+
+	s.scheduleCovers(bson.M{"entries.track_id": trackID})
+	return nil
+}
+
+// TrackRestored clears the unavailable mark set by TrackTrashed
+func (s *PlaylistService) TrackRestored(trackID primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := s.PlaylistCollection.UpdateMany(
+		ctx,
+		bson.M{"entries.track_id": trackID},
+		bson.M{"$unset": bson.M{"entries.$[entry].track_deleted_at": ""}},
+		options.Update().SetArrayFilters(options.ArrayFilters{
+			Filters: []interface{}{bson.M{"entry.track_id": trackID}},
+		}),
+	)
+	if err != nil {
+		return err
+	}
+
+	s.scheduleCovers(bson.M{"entries.track_id": trackID})
+	return nil
+}
+
+// TrackPurged removes every entry of a permanently deleted track, including from playlists in the trash
+func (s *PlaylistService) TrackPurged(trackID primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"track_ids": trackID}
+
+	// Collect members first so they can be told which playlists changed
+	cursor, err := s.PlaylistCollection.Find(ctx, filter,
+		options.Find().SetProjection(bson.M{"created_by": 1, "collaborators": 1, "deleted_at": 1}))
+	if err != nil {
+		return err
+	}
+	var affected []Playlist
+	if err := cursor.All(ctx, &affected); err != nil {
+		return err
+	}
+	if len(affected) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	if _, err := s.PlaylistCollection.UpdateMany(ctx, filter, bson.M{
+		"$pull": bson.M{
+			"track_ids": trackID,
+			"entries":   bson.M{"track_id": trackID},
+		},
+		"$set": bson.M{"updated_at": now},
+		"$inc": bson.M{"version": 1},
+	}); err != nil {
+		return err
+	}
+
+	// Record the new state of each playlist in its change log
+	ids := make([]primitive.ObjectID, len(affected))
+	for i := range affected {
+		ids[i] = affected[i].ID
+	}
+	cursor, err = s.PlaylistCollection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return err
+	}
+	var changed []Playlist
+	if err := cursor.All(ctx, &changed); err != nil {
+		return err
+	}
+	for i := range changed {
+		s.recordChange(&changed[i], PlaylistChange{Action: ChangeTrackRemoved, TrackID: trackID.Hex()}, true)
+	}
+
+	for i := range affected {
+		if affected[i].DeletedAt == nil {
+			s.notify(&affected[i], PlaylistEvent{Action: "track_removed", TrackID: trackID.Hex(), UpdatedAt: now})
+			s.scheduleCover(affected[i].ID)
+		}
+	}
+
+	return nil
+}
+
+// PlaylistIssue describes the integrity problems found in one playlist
+type PlaylistIssue struct {
+	PlaylistID        string   `json:"playlist_id"`
+	Name              string   `json:"name"`
+	MissingTrackIDs   []string `json:"missing_track_ids,omitempty"`  // Referenced tracks that no longer exist
+	MissingTombstones int      `json:"missing_tombstones,omitempty"` // Entries of trashed tracks not marked unavailable
+	StaleTombstones   int      `json:"stale_tombstones,omitempty"`   // Entries marked unavailable whose track is active
+	EntriesOutOfSync  bool     `json:"entries_out_of_sync,omitempty"`
+	Repaired          bool     `json:"repaired,omitempty"`
+	Error             string   `json:"error,omitempty"`
+}
+
+// ConsistencyReport is the result of checking (and optionally repairing) playlist references
+type ConsistencyReport struct {
+	Repair             bool            `json:"repair"`
+	PlaylistsScanned   int             `json:"playlists_scanned"`
+	PlaylistsAffected  int             `json:"playlists_affected"`
+	DanglingReferences int             `json:"dangling_references"`
+	Repaired           int             `json:"repaired"`
+	Failed             int             `json:"failed"`
+	Issues             []PlaylistIssue `json:"issues"`
+	CheckedAt          time.Time       `json:"checked_at"`
+}
+
+// CheckConsistency scans every playlist (trashed ones included) for references to tracks that no
+// longer exist, unavailable marks that disagree with the track's trash state, and entries that
+// disagree with track_ids. With repair set each affected playlist is rewritten, guarded by its version.
+func (s *PlaylistService) CheckConsistency(repair bool) (*ConsistencyReport, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	report := &ConsistencyReport{Repair: repair, Issues: []PlaylistIssue{}, CheckedAt: time.Now()}
+
+	cursor, err := s.PlaylistCollection.Find(ctx, bson.M{}, options.Find().SetProjection(bson.M{
+		"name": 1, "track_ids": 1, "entries": 1, "version": 1,
+	}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	batch := make([]Playlist, 0, integrityBatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		err := s.checkBatch(ctx, batch, report)
+		batch = batch[:0]
+		return err
+	}
+
+	for cursor.Next(ctx) {
+		var playlist Playlist
+		if err := cursor.Decode(&playlist); err != nil {
+			return nil, err
+		}
+		batch = append(batch, playlist)
+		report.PlaylistsScanned++
+
+		if len(batch) == integrityBatchSize {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// checkBatch looks up the tracks referenced by a batch of playlists and records their issues
+func (s *PlaylistService) checkBatch(ctx context.Context, batch []Playlist, report *ConsistencyReport) error {
+	ids := bson.A{}
+	seen := make(map[primitive.ObjectID]bool)
+	for _, playlist := range batch {
+		for _, trackID := range playlist.TrackIDs {
+			if !seen[trackID] {
+				seen[trackID] = true
+				ids = append(ids, trackID)
+			}
+		}
+	}
+
+	// Track ID -> deleted_at (nil while active); absent means the track no longer exists
+	tracks := make(map[primitive.ObjectID]*time.Time, len(ids))
+	if len(ids) > 0 {
+		cursor, err := s.TrackCollection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}},
+			options.Find().SetProjection(bson.M{"deleted_at": 1}))
+		if err != nil {
+			return err
+		}
+		for cursor.Next(ctx) {
+			var track struct {
+				ID        primitive.ObjectID `bson:"_id"`
+				DeletedAt *time.Time         `bson:"deleted_at"`
+			}
+			if err := cursor.Decode(&track); err != nil {
+				cursor.Close(ctx)
+				return err
+			}
+			tracks[track.ID] = track.DeletedAt
+		}
+		err = cursor.Err()
+		cursor.Close(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i := range batch {
+		issue, fixed := inspectPlaylist(&batch[i], tracks)
+		if issue == nil {
+			continue
+		}
+
+		report.PlaylistsAffected++
+		report.DanglingReferences += len(issue.MissingTrackIDs)
+
+		if report.Repair {
+			if err := s.rewriteEntries(ctx, &batch[i], fixed); err != nil {
+				issue.Error = err.Error()
+				report.Failed++
+			} else {
+				issue.Repaired = true
+				report.Repaired++
+			}
+		}
+		report.Issues = append(report.Issues, *issue)
+	}
+
+	return nil
+}
+
+// inspectPlaylist compares a playlist with the current track states. It returns nil when the
+// playlist is consistent, otherwise the issue and the corrected entries.
+func inspectPlaylist(playlist *Playlist, tracks map[primitive.ObjectID]*time.Time) (*PlaylistIssue, []Entry) {
+	issue := &PlaylistIssue{
+		PlaylistID:       playlist.ID.Hex(),
+		Name:             playlist.Name,
+		EntriesOutOfSync: !entriesInSync(playlist),
+	}
+
+	missing := make(map[primitive.ObjectID]bool)
+	fixed := make([]Entry, 0, len(playlist.TrackIDs))
+	for _, entry := range normalizeEntries(playlist) {
+		deletedAt, exists := tracks[entry.TrackID]
+		switch {
+		case !exists:
+			if !missing[entry.TrackID] {
+				missing[entry.TrackID] = true
+				issue.MissingTrackIDs = append(issue.MissingTrackIDs, entry.TrackID.Hex())
+			}
+			continue
+		case deletedAt != nil && entry.TrackDeletedAt == nil:
+			issue.MissingTombstones++
+			entry.TrackDeletedAt = deletedAt
+		case deletedAt == nil && entry.TrackDeletedAt != nil:
+			issue.StaleTombstones++
+			entry.TrackDeletedAt = nil
+		}
+		fixed = append(fixed, entry)
+	}
+
+	if len(issue.MissingTrackIDs) == 0 && issue.MissingTombstones == 0 && issue.StaleTombstones == 0 && !issue.EntriesOutOfSync {
+		return nil, nil
+	}
+	return issue, fixed
+}
+
+// rewriteEntries stores repaired entries unless the playlist changed since it was read, and
+// records the repair in the change log
+func (s *PlaylistService) rewriteEntries(ctx context.Context, playlist *Playlist, entries []Entry) error {
+	filter := bson.M{"_id": playlist.ID, "version": playlist.Version}
+	if playlist.Version == 0 {
+		filter["version"] = bson.M{"$in": bson.A{0, nil}}
+	}
+
+	var updated Playlist
+	err := s.PlaylistCollection.FindOneAndUpdate(ctx, filter, bson.M{"$set": bson.M{
+		"entries":    entries,
+		"track_ids":  trackIDsOf(entries),
+		"version":    playlist.Version + 1,
+		"updated_at": time.Now(),
+	}}, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&updated)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ErrVersionConflict
+	}
+	if err != nil {
+		return err
+	}
+
+	s.recordChange(&updated, PlaylistChange{Action: ChangeTracksRepaired}, true)
+	return nil
+}
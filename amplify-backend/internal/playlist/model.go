@@ -1,19 +1,124 @@
 package playlist
 
 import (
+	"amplify-backend/internal/music"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type Playlist struct {
-	ID          primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
-	Name        string               `bson:"name" json:"name"`
-	Description string               `bson:"description,omitempty" json:"description,omitempty"`
-	TrackIDs    []primitive.ObjectID `bson:"track_ids" json:"track_ids"`
-	CoverArt    string               `bson:"cover_art,omitempty" json:"cover_art,omitempty"`
-	IsPublic    bool                 `bson:"is_public" json:"is_public"`
-	CreatedBy   string               `bson:"created_by,omitempty" json:"created_by,omitempty"` // Clerk User ID
-	CreatedAt   time.Time            `bson:"created_at" json:"created_at"`
-	UpdatedAt   time.Time            `bson:"updated_at" json:"updated_at"`
+	ID             primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
+	Name           string               `bson:"name" json:"name"`
+	Description    string               `bson:"description,omitempty" json:"description,omitempty"`
+	TrackIDs       []primitive.ObjectID `bson:"track_ids" json:"track_ids"`
+	CoverArt       string               `bson:"cover_art,omitempty" json:"cover_art,omitempty"`
+	CoverGenerated bool                 `bson:"cover_generated,omitempty" json:"cover_generated,omitempty"` // CoverArt is a mosaic of the first albums
+	CoverPath      string               `bson:"cover_path,omitempty" json:"-"`                              // Storage path of an image this service stored
+	CoverSource    string               `bson:"cover_source,omitempty" json:"-"`                            // Album art the mosaic was built from
+	IsPublic       bool                 `bson:"is_public" json:"is_public"`
+	CreatedBy      string               `bson:"created_by,omitempty" json:"created_by,omitempty"`       // Supabase User ID of the owner
+	Entries        []Entry              `bson:"entries,omitempty" json:"entries,omitempty"`             // Who added each track, in track order
+	Collaborators  []Collaborator       `bson:"collaborators,omitempty" json:"collaborators,omitempty"` // Users the owner shared the playlist with
+	Version        int                  `bson:"version" json:"version"`                                 // Bumped on every edit, for optimistic concurrency
+	Rules          *music.Query         `bson:"rules,omitempty" json:"rules,omitempty"`                 // Smart playlists: tracks are evaluated from these on read
+	RulesText      string               `bson:"-" json:"rules_text,omitempty"`                          // Rules in the query grammar, for display and editing
+	FollowerCount  int                  `bson:"follower_count" json:"follower_count"`                   // Maintained by FollowPlaylist and UnfollowPlaylist
+	ForkCount      int                  `bson:"fork_count" json:"fork_count"`                           // Maintained by ForkPlaylist
+	ForkedFrom     *ForkSource          `bson:"forked_from,omitempty" json:"forked_from,omitempty"`     // Set on copies made with ForkPlaylist
+	CreatedAt      time.Time            `bson:"created_at" json:"created_at"`
+	UpdatedAt      time.Time            `bson:"updated_at" json:"updated_at"`
+	DeletedAt      *time.Time           `bson:"deleted_at,omitempty" json:"deleted_at,omitempty"` // Set while in the trash
+
+	// Virtual playlists (e.g. "Liked Songs") are computed on read and never stored
+	Virtual bool `bson:"-" json:"virtual,omitempty"`
+}
+
+// Collaborator roles. The owner (CreatedBy) is not stored in Collaborators.
+const (
+	RoleOwner  = "owner"
+	RoleEditor = "editor" // Can add, remove and reorder tracks
+	RoleViewer = "viewer" // Can see a private playlist
+)
+
+// roleRank orders roles so a higher rank includes the permissions of the lower ones
+var roleRank = map[string]int{
+	RoleViewer: 1,
+	RoleEditor: 2,
+	RoleOwner:  3,
+}
+
+type Collaborator struct {
+	UserID  string    `bson:"user_id" json:"user_id"`
+	Role    string    `bson:"role" json:"role"`
+	AddedAt time.Time `bson:"added_at" json:"added_at"`
+}
+
+// Entry is one position in the playlist. Its ID stays stable when entries move, so the
+// same track can appear more than once and still be addressed individually.
+type Entry struct {
+	ID      string             `bson:"id" json:"id"`
+	TrackID primitive.ObjectID `bson:"track_id" json:"track_id"`
+	AddedBy string             `bson:"added_by,omitempty" json:"added_by,omitempty"`
+	AddedAt time.Time          `bson:"added_at" json:"added_at"`
+
+	// Set while the track is in the trash; the entry is removed when the track is purged
+	TrackDeletedAt *time.Time `bson:"track_deleted_at,omitempty" json:"track_deleted_at,omitempty"`
+}
+
+// ForkSource links a forked playlist back to the playlist it was copied from
+type ForkSource struct {
+	PlaylistID primitive.ObjectID `bson:"playlist_id" json:"playlist_id"`
+	Name       string             `bson:"name" json:"name"`
+	CreatedBy  string             `bson:"created_by,omitempty" json:"created_by,omitempty"`
+	ForkedAt   time.Time          `bson:"forked_at" json:"forked_at"`
+}
+
+// Follow records that a user follows someone else's playlist
+type Follow struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	PlaylistID primitive.ObjectID `bson:"playlist_id" json:"playlist_id"`
+	UserID     string             `bson:"user_id" json:"user_id"`
+	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// Invite is a shareable link that adds whoever opens it as a collaborator until it expires.
+// Only a hash of the token is stored; the token itself is returned once, on creation.
+type Invite struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	PlaylistID primitive.ObjectID `bson:"playlist_id" json:"playlist_id"`
+	Token      string             `bson:"-" json:"token,omitempty"`
+	TokenHash  string             `bson:"token_hash" json:"-"`
+	Role       string             `bson:"role" json:"role"`
+	CreatedBy  string             `bson:"created_by" json:"created_by"`
+	ExpiresAt  time.Time          `bson:"expires_at" json:"expires_at"`
+	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// RoleOf returns the user's role on the playlist, or "" if they have none
+func (p *Playlist) RoleOf(userID string) string {
+	if userID == "" {
+		return ""
+	}
+	if p.CreatedBy == userID {
+		return RoleOwner
+	}
+	for _, collaborator := range p.Collaborators {
+		if collaborator.UserID == userID {
+			return collaborator.Role
+		}
+	}
+	return ""
+}
+
+// Members returns the owner and every collaborator
+func (p *Playlist) Members() []string {
+	members := make([]string, 0, len(p.Collaborators)+1)
+	if p.CreatedBy != "" {
+		members = append(members, p.CreatedBy)
+	}
+	for _, collaborator := range p.Collaborators {
+		members = append(members, collaborator.UserID)
+	}
+	return members
 }
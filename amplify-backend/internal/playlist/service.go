@@ -1,24 +1,53 @@
 package playlist
 
 import (
+	"amplify-backend/internal/storage"
 	"context"
+	"sync"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type PlaylistService struct {
 	PlaylistCollection *mongo.Collection
+	InviteCollection   *mongo.Collection
+	FollowCollection   *mongo.Collection
+	HistoryCollection  *mongo.Collection
+	TrackCollection    *mongo.Collection
+
+	// Evaluates smart playlist rules
+	Tracks TrackFinder
+
+	// Optional real-time delivery of playlist changes to members
+	Notifier Notifier
+
+	// Optional image storage for generated and uploaded covers
+	Storage storage.StorageProvider
+
+	coverMu      sync.Mutex
+	coverPending map[primitive.ObjectID]bool // Playlists whose mosaic is being rebuilt; true if another run is due
 }
 
 func NewPlaylistService(db *mongo.Database) *PlaylistService {
 	return &PlaylistService{
 		PlaylistCollection: db.Collection("playlists"),
+		InviteCollection:   db.Collection("playlist_invites"),
+		FollowCollection:   db.Collection("playlist_follows"),
+		HistoryCollection:  db.Collection("playlist_changes"),
+		TrackCollection:    db.Collection("tracks"),
 	}
 }
 
+// notDeleted matches playlists that are not in the trash
+func notDeleted(filter bson.M) bson.M {
+	filter["deleted_at"] = bson.M{"$exists": false}
+	return filter
+}
+
 // CreatePlaylist creates a new playlist
 func (s *PlaylistService) CreatePlaylist(p Playlist) (*Playlist, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -34,21 +63,47 @@ func (s *PlaylistService) CreatePlaylist(p Playlist) (*Playlist, error) {
 		p.TrackIDs = []primitive.ObjectID{}
 	}
 
+	// Every initial track gets its own entry, attributed to the creator
+	p.Entries = make([]Entry, len(p.TrackIDs))
+	for i, trackID := range p.TrackIDs {
+		p.Entries[i] = Entry{ID: primitive.NewObjectID().Hex(), TrackID: trackID, AddedBy: p.CreatedBy, AddedAt: now}
+	}
+	p.Version = 0
+
 	res, err := s.PlaylistCollection.InsertOne(ctx, p)
 	if err != nil {
 		return nil, err
 	}
 
 	p.ID = res.InsertedID.(primitive.ObjectID)
+	s.recordChange(&p, PlaylistChange{Action: ChangeCreated, ActorID: p.CreatedBy}, true)
+	if !p.hasCustomCover() {
+		s.scheduleCover(p.ID)
+	}
 	return &p, nil
 }
 
-// GetAllPlaylists returns all playlists
-func (s *PlaylistService) GetAllPlaylists() ([]Playlist, error) {
+// visibleTo matches public playlists plus private ones the viewer owns or collaborates on.
+// An empty viewerID (guest) only sees public playlists.
+func visibleTo(viewerID string, filter bson.M) bson.M {
+	if viewerID == "" {
+		filter["is_public"] = true
+		return filter
+	}
+	filter["$or"] = bson.A{
+		bson.M{"is_public": true},
+		bson.M{"created_by": viewerID},
+		bson.M{"collaborators.user_id": viewerID},
+	}
+	return filter
+}
+
+// GetAllPlaylists returns the playlists visible to the viewer
+func (s *PlaylistService) GetAllPlaylists(viewerID string) ([]Playlist, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	cursor, err := s.PlaylistCollection.Find(ctx, bson.M{})
+	cursor, err := s.PlaylistCollection.Find(ctx, notDeleted(visibleTo(viewerID, bson.M{})))
 	if err != nil {
 		return nil, err
 	}
@@ -58,6 +113,34 @@ func (s *PlaylistService) GetAllPlaylists() ([]Playlist, error) {
 	if err := cursor.All(ctx, &playlists); err != nil {
 		return nil, err
 	}
+	for i := range playlists {
+		playlists[i].Entries = normalizeEntries(&playlists[i])
+		if playlists[i].Rules != nil {
+			playlists[i].RulesText = playlists[i].Rules.String()
+		}
+	}
+
+	return playlists, nil
+}
+
+// GetUserPlaylists returns the playlists the user owns or collaborates on
+func (s *PlaylistService) GetUserPlaylists(userID string) ([]Playlist, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := s.PlaylistCollection.Find(ctx, notDeleted(bson.M{"$or": bson.A{
+		bson.M{"created_by": userID},
+		bson.M{"collaborators.user_id": userID},
+	}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	playlists := []Playlist{}
+	if err := cursor.All(ctx, &playlists); err != nil {
+		return nil, err
+	}
 
 	return playlists, nil
 }
@@ -73,40 +156,73 @@ func (s *PlaylistService) GetPlaylistByID(id string) (*Playlist, error) {
 	defer cancel()
 
 	var playlist Playlist
-	err = s.PlaylistCollection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&playlist)
+	err = s.PlaylistCollection.FindOne(ctx, notDeleted(bson.M{"_id": objectID})).Decode(&playlist)
 	if err != nil {
 		return nil, err
 	}
+	playlist.Entries = normalizeEntries(&playlist)
 
 	return &playlist, nil
 }
 
-// UpdatePlaylist updates playlist metadata
-func (s *PlaylistService) UpdatePlaylist(id string, updates bson.M) (*Playlist, error) {
+// UpdatePlaylist validates and applies a metadata update
+func (s *PlaylistService) UpdatePlaylist(id string, update PlaylistUpdate, editorID string) (*Playlist, error) {
 	objectID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
 		return nil, err
 	}
 
+	if errs := update.Validate(); len(errs) > 0 {
+		return nil, errs
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	updates["updated_at"] = time.Now()
+	set, unset := update.Fields()
+	set["updated_at"] = time.Now()
+
+	// A cover URL set by hand replaces the mosaic or an uploaded image
+	var previousCover string
+	if update.CoverArt != nil {
+		if current, err := s.GetPlaylistByID(id); err == nil {
+			previousCover = current.CoverPath
+		}
+		unset["cover_generated"] = ""
+		unset["cover_path"] = ""
+		unset["cover_source"] = ""
+	}
+
+	changes := bson.M{"$set": set, "$inc": bson.M{"version": 1}}
+	if len(unset) > 0 {
+		changes["$unset"] = unset
+	}
 
-	_, err = s.PlaylistCollection.UpdateOne(
+	var updated Playlist
+	err = s.PlaylistCollection.FindOneAndUpdate(
 		ctx,
-		bson.M{"_id": objectID},
-		bson.M{"$set": updates},
-	)
+		notDeleted(bson.M{"_id": objectID}),
+		changes,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
 	if err != nil {
 		return nil, err
 	}
 
-	return s.GetPlaylistByID(id)
+	updated.Entries = normalizeEntries(&updated)
+	s.recordChange(&updated, PlaylistChange{Action: ChangeUpdated, ActorID: editorID, Fields: update.FieldNames()}, false)
+	if update.CoverArt != nil {
+		s.deleteCoverImage(previousCover)
+		if updated.CoverArt == "" {
+			s.scheduleCover(updated.ID)
+		}
+	}
+	s.notify(&updated, PlaylistEvent{Action: "updated", ActorID: editorID, Version: updated.Version})
+	return &updated, nil
 }
 
-// DeletePlaylist removes a playlist
-func (s *PlaylistService) DeletePlaylist(id string) error {
+// DeletePlaylist moves a playlist to the trash
+func (s *PlaylistService) DeletePlaylist(id, actorID string) error {
 	objectID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
 		return err
@@ -115,62 +231,125 @@ func (s *PlaylistService) DeletePlaylist(id string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	_, err = s.PlaylistCollection.DeleteOne(ctx, bson.M{"_id": objectID})
-	return err
+	now := time.Now()
+	var deleted Playlist
+	err = s.PlaylistCollection.FindOneAndUpdate(
+		ctx,
+		notDeleted(bson.M{"_id": objectID}),
+		bson.M{"$set": bson.M{"deleted_at": now}},
+	).Decode(&deleted)
+	if err != nil {
+		return err
+	}
+
+	s.notify(&deleted, PlaylistEvent{Action: "deleted", ActorID: actorID, UpdatedAt: now})
+	return nil
 }
 
-// AddTrackToPlaylist adds a track to the playlist's track array
-func (s *PlaylistService) AddTrackToPlaylist(playlistID, trackID string) error {
-	playlistObjID, err := primitive.ObjectIDFromHex(playlistID)
+// GetDeletedPlaylists returns the playlists in the trash, most recently deleted first
+func (s *PlaylistService) GetDeletedPlaylists() ([]Playlist, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := s.PlaylistCollection.Find(
+		ctx,
+		bson.M{"deleted_at": bson.M{"$exists": true}},
+		options.Find().SetSort(bson.D{{Key: "deleted_at", Value: -1}}),
+	)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer cursor.Close(ctx)
+
+	playlists := []Playlist{}
+	if err := cursor.All(ctx, &playlists); err != nil {
+		return nil, err
+	}
+
+	return playlists, nil
+}
 
-	trackObjID, err := primitive.ObjectIDFromHex(trackID)
+// RestorePlaylist moves a playlist out of the trash and tells its members and followers
+func (s *PlaylistService) RestorePlaylist(id, actorID string) (*Playlist, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	_, err = s.PlaylistCollection.UpdateOne(
+	now := time.Now()
+	var playlist Playlist
+	err = s.PlaylistCollection.FindOneAndUpdate(
 		ctx,
-		bson.M{"_id": playlistObjID},
+		bson.M{"_id": objectID, "deleted_at": bson.M{"$exists": true}},
 		bson.M{
-			"$addToSet": bson.M{"track_ids": trackObjID}, // addToSet prevents duplicates
-			"$set":      bson.M{"updated_at": time.Now()},
+			"$unset": bson.M{"deleted_at": ""},
+			"$set":   bson.M{"updated_at": now},
+			"$inc":   bson.M{"version": 1},
 		},
-	)
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&playlist)
+	if err != nil {
+		return nil, err
+	}
+	playlist.Entries = normalizeEntries(&playlist)
 
-	return err
+	s.recordChange(&playlist, PlaylistChange{Action: ChangeRestored, ActorID: actorID}, false)
+	s.notify(&playlist, PlaylistEvent{Action: "restored", ActorID: actorID, Version: playlist.Version, UpdatedAt: now})
+	return &playlist, nil
 }
 
-// RemoveTrackFromPlaylist removes a track from the playlist
-func (s *PlaylistService) RemoveTrackFromPlaylist(playlistID, trackID string) error {
-	playlistObjID, err := primitive.ObjectIDFromHex(playlistID)
+// PurgePlaylist permanently removes a trashed playlist
+func (s *PlaylistService) PurgePlaylist(id string) (*Playlist, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	trackObjID, err := primitive.ObjectIDFromHex(trackID)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var playlist Playlist
+	err = s.PlaylistCollection.FindOneAndDelete(
+		ctx,
+		bson.M{"_id": objectID, "deleted_at": bson.M{"$exists": true}},
+	).Decode(&playlist)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	s.deleteCoverImage(playlist.CoverPath)
+
+	// Follows and the change log only make sense while the playlist exists
+	if _, err := s.FollowCollection.DeleteMany(ctx, bson.M{"playlist_id": objectID}); err != nil {
+		return &playlist, err
+	}
+	if _, err := s.HistoryCollection.DeleteMany(ctx, bson.M{"playlist_id": objectID}); err != nil {
+		return &playlist, err
 	}
 
+	return &playlist, nil
+}
+
+// GetExpiredPlaylists returns trashed playlists deleted before the cutoff
+func (s *PlaylistService) GetExpiredPlaylists(cutoff time.Time) ([]Playlist, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	_, err = s.PlaylistCollection.UpdateOne(
-		ctx,
-		bson.M{"_id": playlistObjID},
-		bson.M{
-			"$pull": bson.M{"track_ids": trackObjID},
-			"$set":  bson.M{"updated_at": time.Now()},
-		},
-	)
+	cursor, err := s.PlaylistCollection.Find(ctx, bson.M{"deleted_at": bson.M{"$lt": cutoff}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	playlists := []Playlist{}
+	if err := cursor.All(ctx, &playlists); err != nil {
+		return nil, err
+	}
 
-	return err
+	return playlists, nil
 }
 
 // GetTotalPlaylistCount returns the total number of playlists
@@ -178,6 +357,6 @@ func (s *PlaylistService) GetTotalPlaylistCount() (int64, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	count, err := s.PlaylistCollection.CountDocuments(ctx, bson.M{})
+	count, err := s.PlaylistCollection.CountDocuments(ctx, notDeleted(bson.M{}))
 	return count, err
 }
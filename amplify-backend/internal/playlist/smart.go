@@ -0,0 +1,190 @@
+package playlist
+
+import (
+	"amplify-backend/internal/music"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MaxSmartTracks caps a smart playlist whose rules have no LIMIT
+const MaxSmartTracks = 500
+
+var (
+	ErrSmartPlaylist = errors.New("smart playlists are defined by rules, change the rules instead")
+	ErrNotSmart      = errors.New("playlist has no rules")
+)
+
+// TrackFinder evaluates track queries (implemented by music.MusicService)
+type TrackFinder interface {
+	FindTracks(q *music.Query, fallbackLimit int) ([]music.Track, error)
+}
+
+// evaluateRules runs a smart playlist's rules. Stored rules are re-validated so a rule tree
+// written by an older version cannot produce a malformed query.
+func (s *PlaylistService) evaluateRules(p *Playlist) ([]music.Track, error) {
+	if p.Rules == nil {
+		return nil, ErrNotSmart
+	}
+	if s.Tracks == nil {
+		return nil, errors.New("track queries are not available")
+	}
+
+	query := *p.Rules
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+
+	return s.Tracks.FindTracks(&query, MaxSmartTracks)
+}
+
+// smartEntries turns evaluated tracks into entries. Entry IDs are the track IDs, which are
+// unique within a query result and stable between reads.
+func smartEntries(tracks []music.Track) []Entry {
+	entries := make([]Entry, len(tracks))
+	for i, track := range tracks {
+		entries[i] = Entry{ID: track.ID.Hex(), TrackID: track.ID, AddedAt: track.CreatedAt}
+	}
+	return entries
+}
+
+// ResolveSmart fills the entries of a smart playlist from its rules; regular playlists are left as they are
+func (s *PlaylistService) ResolveSmart(p *Playlist) error {
+	if p.Rules == nil {
+		return nil
+	}
+
+	tracks, err := s.evaluateRules(p)
+	if err != nil {
+		return err
+	}
+
+	p.Entries = smartEntries(tracks)
+	p.TrackIDs = trackIDsOf(p.Entries)
+	p.RulesText = p.Rules.String()
+	return nil
+}
+
+// SetRules turns a playlist into a smart playlist, or changes its rules
+func (s *PlaylistService) SetRules(id string, query *music.Query, editorID string) (*Playlist, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var updated Playlist
+	err = s.PlaylistCollection.FindOneAndUpdate(
+		ctx,
+		notDeleted(bson.M{"_id": objectID}),
+		bson.M{
+			// Stored entries are unused while rules are set
+			"$set": bson.M{"rules": query, "entries": bson.A{}, "track_ids": bson.A{}, "updated_at": time.Now()},
+			"$inc": bson.M{"version": 1},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	if err != nil {
+		return nil, err
+	}
+
+	s.recordChange(&updated, PlaylistChange{Action: ChangeRulesUpdated, ActorID: editorID}, true)
+	s.scheduleCover(updated.ID)
+	s.notify(&updated, PlaylistEvent{Action: "updated", ActorID: editorID, Version: updated.Version})
+
+	if err := s.ResolveSmart(&updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// ClearRules turns a smart playlist back into a regular one that keeps its current tracks
+func (s *PlaylistService) ClearRules(id, editorID string) (*Playlist, error) {
+	playlist, err := s.GetPlaylistByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	tracks, err := s.evaluateRules(playlist)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	entries := smartEntries(tracks)
+	for i := range entries {
+		entries[i].ID = primitive.NewObjectID().Hex()
+		entries[i].AddedBy = editorID
+		entries[i].AddedAt = now
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var updated Playlist
+	err = s.PlaylistCollection.FindOneAndUpdate(
+		ctx,
+		versionFilter(playlist.ID, playlist.Version),
+		bson.M{
+			"$set": bson.M{
+				"entries":    entries,
+				"track_ids":  trackIDsOf(entries),
+				"version":    playlist.Version + 1,
+				"updated_at": now,
+			},
+			"$unset": bson.M{"rules": ""},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrVersionConflict
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.recordChange(&updated, PlaylistChange{Action: ChangeRulesRemoved, ActorID: editorID}, true)
+	s.scheduleCover(updated.ID)
+	s.notify(&updated, PlaylistEvent{Action: "updated", ActorID: editorID, Version: updated.Version})
+	return &updated, nil
+}
+
+// SnapshotRules saves the current result of a smart playlist as a new regular playlist owned by userID
+func (s *PlaylistService) SnapshotRules(id, name, userID string, isPublic bool) (*Playlist, error) {
+	source, err := s.GetPlaylistByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	tracks, err := s.evaluateRules(source)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if name == "" {
+		name = fmt.Sprintf("%s (%s)", source.Name, now.Format("Jan 2006"))
+	}
+	if len(name) > MaxNameLength {
+		name = name[:MaxNameLength]
+	}
+
+	return s.CreatePlaylist(Playlist{
+		Name:        name,
+		Description: fmt.Sprintf("Snapshot of %q taken %s", source.Name, now.Format("2006-01-02")),
+		TrackIDs:    trackIDsOf(smartEntries(tracks)),
+		IsPublic:    isPublic,
+		CreatedBy:   userID,
+	})
+}
@@ -0,0 +1,325 @@
+package playlist
+
+import (
+	"amplify-backend/internal/music"
+	"context"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// streamPathPattern finds track IDs in stream URLs written by ExportItems
+var streamPathPattern = regexp.MustCompile(`/stream/([0-9a-fA-F]{24})(?:[/?#]|$)`)
+
+// How an imported entry was matched to a catalog track
+const (
+	MatchStreamURL   = "stream_url"
+	MatchPath        = "path"
+	MatchContentHash = "content_hash"
+	MatchTitleArtist = "title_artist"
+)
+
+// UnmatchedItem is a playlist file entry that matched no catalog track
+type UnmatchedItem struct {
+	Index int `json:"index"` // Position in the file, from 0
+	FileItem
+}
+
+// ImportResult reports how a playlist file was matched against the catalog
+type ImportResult struct {
+	Playlist  *Playlist       `json:"playlist,omitempty"` // Not set on a dry run
+	Name      string          `json:"name"`
+	Format    string          `json:"format"`
+	Total     int             `json:"total"`
+	Matched   int             `json:"matched"`
+	MatchedBy map[string]int  `json:"matched_by"`
+	Unmatched []UnmatchedItem `json:"unmatched"`
+	DryRun    bool            `json:"dry_run,omitempty"`
+}
+
+// ExportItems returns a playlist's playable tracks as file entries, in playlist order.
+// Missing and trashed tracks are left out. Each location is streamBaseURL + "/" + track ID.
+func (s *PlaylistService) ExportItems(p *Playlist, streamBaseURL string) ([]FileItem, error) {
+	entries := p.Entries
+	if entries == nil {
+		entries = normalizeEntries(p)
+	}
+	if len(entries) == 0 {
+		return []FileItem{}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := s.TrackCollection.Find(ctx, bson.M{
+		"_id":        bson.M{"$in": trackIDsOf(entries)},
+		"deleted_at": bson.M{"$exists": false},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var tracks []music.Track
+	if err := cursor.All(ctx, &tracks); err != nil {
+		return nil, err
+	}
+	byID := make(map[primitive.ObjectID]*music.Track, len(tracks))
+	for i := range tracks {
+		byID[tracks[i].ID] = &tracks[i]
+	}
+
+	streamBaseURL = strings.TrimSuffix(streamBaseURL, "/")
+	items := make([]FileItem, 0, len(entries))
+	for _, entry := range entries {
+		track, ok := byID[entry.TrackID]
+		if !ok {
+			continue
+		}
+		hash := track.ContentHash
+		if hash == "" {
+			hash = music.ContentHash(track.Title, track.Artist, track.Duration)
+		}
+		items = append(items, FileItem{
+			Location:    streamBaseURL + "/" + track.ID.Hex(),
+			Title:       track.Title,
+			Artist:      track.Artist,
+			Album:       track.Album,
+			Duration:    track.Duration,
+			ContentHash: hash,
+		})
+	}
+
+	return items, nil
+}
+
+// ImportPlaylist matches the entries of a playlist file to catalog tracks and creates a
+// playlist owned by userID from the matches. Each entry is tried, in order, by a stream URL
+// from this server, by file path or name, by content hash and by title and artist.
+// Entries that match nothing are reported and left out. A dry run only reports.
+func (s *PlaylistService) ImportPlaylist(name, format string, items []FileItem, userID string, isPublic, dryRun bool) (*ImportResult, error) {
+	if len(items) == 0 {
+		return nil, ErrEmptyImport
+	}
+	if len(items) > MaxPlaylistEntries {
+		return nil, ErrPlaylistFull
+	}
+
+	matcher, err := s.loadImportCandidates(items)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ImportResult{
+		Name:      name,
+		Format:    format,
+		Total:     len(items),
+		MatchedBy: map[string]int{},
+		Unmatched: []UnmatchedItem{},
+		DryRun:    dryRun,
+	}
+
+	trackIDs := make([]primitive.ObjectID, 0, len(items))
+	for i, item := range items {
+		trackID, how := matcher.match(item)
+		if how == "" {
+			result.Unmatched = append(result.Unmatched, UnmatchedItem{Index: i, FileItem: item})
+			continue
+		}
+		trackIDs = append(trackIDs, trackID)
+		result.Matched++
+		result.MatchedBy[how]++
+	}
+
+	if dryRun {
+		return result, nil
+	}
+
+	playlist, err := s.CreatePlaylist(Playlist{
+		Name:      name,
+		TrackIDs:  trackIDs,
+		IsPublic:  isPublic,
+		CreatedBy: userID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	result.Playlist = playlist
+
+	return result, nil
+}
+
+// importMatcher indexes the candidate tracks of an import by every key entries can match on
+type importMatcher struct {
+	byID          map[primitive.ObjectID]primitive.ObjectID
+	byPath        map[string]primitive.ObjectID
+	byFileName    map[string]primitive.ObjectID
+	byHash        map[string]primitive.ObjectID
+	byTitleArtist map[string]primitive.ObjectID
+	byTitle       map[string][]primitive.ObjectID
+}
+
+// matchKey normalizes metadata for comparison
+func matchKey(value string) string {
+	return strings.Join(strings.Fields(strings.ToLower(value)), " ")
+}
+
+// itemHash returns the content hash an entry carries, or one computed from its metadata
+func itemHash(item FileItem) string {
+	if item.ContentHash != "" {
+		return item.ContentHash
+	}
+	if item.Title == "" || item.Duration <= 0 {
+		return ""
+	}
+	return music.ContentHash(item.Title, item.Artist, item.Duration)
+}
+
+// loadImportCandidates fetches, in one query, every non-trashed track that any entry could match
+func (s *PlaylistService) loadImportCandidates(items []FileItem) (*importMatcher, error) {
+	ids := bson.A{}
+	paths := bson.A{}
+	fileNames := bson.A{}
+	hashes := bson.A{}
+	titles := bson.A{}
+	seenTitles := make(map[string]bool)
+
+	for _, item := range items {
+		if item.Location != "" {
+			if found := streamPathPattern.FindStringSubmatch(item.Location); found != nil {
+				if id, err := primitive.ObjectIDFromHex(found[1]); err == nil {
+					ids = append(ids, id)
+				}
+			}
+			paths = append(paths, item.Location)
+			if fileName := locationFileName(item.Location); fileName != "" && fileName != "." && fileName != "/" {
+				fileNames = append(fileNames, fileName)
+			}
+		}
+		if hash := itemHash(item); hash != "" {
+			hashes = append(hashes, hash)
+		}
+		if key := matchKey(item.Title); key != "" && !seenTitles[key] {
+			seenTitles[key] = true
+			titles = append(titles, primitive.Regex{Pattern: "^" + regexp.QuoteMeta(strings.TrimSpace(item.Title)) + "$", Options: "i"})
+		}
+	}
+
+	var or bson.A
+	if len(ids) > 0 {
+		or = append(or, bson.M{"_id": bson.M{"$in": ids}})
+	}
+	if len(paths) > 0 {
+		or = append(or, bson.M{"file_path": bson.M{"$in": paths}})
+	}
+	if len(fileNames) > 0 {
+		or = append(or, bson.M{"file_name": bson.M{"$in": fileNames}})
+	}
+	if len(hashes) > 0 {
+		or = append(or, bson.M{"content_hash": bson.M{"$in": hashes}})
+	}
+	if len(titles) > 0 {
+		or = append(or, bson.M{"title": bson.M{"$in": titles}})
+	}
+
+	matcher := &importMatcher{
+		byID:          map[primitive.ObjectID]primitive.ObjectID{},
+		byPath:        map[string]primitive.ObjectID{},
+		byFileName:    map[string]primitive.ObjectID{},
+		byHash:        map[string]primitive.ObjectID{},
+		byTitleArtist: map[string]primitive.ObjectID{},
+		byTitle:       map[string][]primitive.ObjectID{},
+	}
+	if len(or) == 0 {
+		return matcher, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Oldest first, so when several tracks share a key the original upload wins
+	cursor, err := s.TrackCollection.Find(ctx, bson.M{
+		"$or":        or,
+		"deleted_at": bson.M{"$exists": false},
+	}, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}).SetProjection(bson.M{
+		"title": 1, "artist": 1, "duration": 1, "file_path": 1, "file_name": 1, "content_hash": 1,
+	}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var tracks []music.Track
+	if err := cursor.All(ctx, &tracks); err != nil {
+		return nil, err
+	}
+
+	for _, track := range tracks {
+		matcher.byID[track.ID] = track.ID
+		addFirst(matcher.byPath, track.FilePath, track.ID)
+		addFirst(matcher.byFileName, track.FileName, track.ID)
+		hash := track.ContentHash
+		if hash == "" {
+			hash = music.ContentHash(track.Title, track.Artist, track.Duration)
+		}
+		addFirst(matcher.byHash, hash, track.ID)
+		title := matchKey(track.Title)
+		addFirst(matcher.byTitleArtist, title+"\x1f"+matchKey(track.Artist), track.ID)
+		if title != "" {
+			matcher.byTitle[title] = append(matcher.byTitle[title], track.ID)
+		}
+	}
+
+	return matcher, nil
+}
+
+func addFirst(index map[string]primitive.ObjectID, key string, id primitive.ObjectID) {
+	if _, ok := index[key]; key != "" && !ok {
+		index[key] = id
+	}
+}
+
+// match returns the track an entry refers to and how it was matched, or "" if nothing matched.
+// An entry without an artist matches by title only when a single track has that title.
+func (m *importMatcher) match(item FileItem) (primitive.ObjectID, string) {
+	if item.Location != "" {
+		if found := streamPathPattern.FindStringSubmatch(item.Location); found != nil {
+			if id, err := primitive.ObjectIDFromHex(found[1]); err == nil {
+				if trackID, ok := m.byID[id]; ok {
+					return trackID, MatchStreamURL
+				}
+			}
+		}
+		if trackID, ok := m.byPath[item.Location]; ok {
+			return trackID, MatchPath
+		}
+		if trackID, ok := m.byFileName[locationFileName(item.Location)]; ok {
+			return trackID, MatchPath
+		}
+	}
+
+	if hash := itemHash(item); hash != "" {
+		if trackID, ok := m.byHash[hash]; ok {
+			return trackID, MatchContentHash
+		}
+	}
+
+	title := matchKey(item.Title)
+	if title == "" {
+		return primitive.NilObjectID, ""
+	}
+	if item.Artist != "" {
+		if trackID, ok := m.byTitleArtist[title+"\x1f"+matchKey(item.Artist)]; ok {
+			return trackID, MatchTitleArtist
+		}
+		return primitive.NilObjectID, ""
+	}
+	if candidates := m.byTitle[title]; len(candidates) == 1 {
+		return candidates[0], MatchTitleArtist
+	}
+	return primitive.NilObjectID, ""
+}
@@ -0,0 +1,88 @@
+package playlist
+
+import (
+	"amplify-backend/internal/validation"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Validation limits for playlist metadata
+const (
+	MaxNameLength        = 100
+	MaxDescriptionLength = 300
+	MaxCoverURLLength    = 2048
+)
+
+// PlaylistReadOnlyFields are returned by the API but cannot be updated through PUT /playlists/:id.
+// Clients that send back a whole playlist object have them ignored instead of rejected.
+var PlaylistReadOnlyFields = []string{
+	"id", "track_ids", "entries", "collaborators", "version", "rules", "rules_text",
+	"follower_count", "fork_count", "forked_from", "cover_generated", "created_by", "created_at", "updated_at", "deleted_at", "virtual",
+}
+
+// PlaylistUpdate is the allowlist of playlist metadata that can be edited. Nil fields are left unchanged.
+type PlaylistUpdate struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+	CoverArt    *string `json:"cover_art"` // Empty string removes the cover
+	IsPublic    *bool   `json:"is_public"`
+}
+
+// Validate checks every set field and returns all problems at once
+func (u PlaylistUpdate) Validate() validation.Errors {
+	var errs validation.Errors
+
+	errs.String("name", u.Name, 1, MaxNameLength)
+	errs.String("description", u.Description, 0, MaxDescriptionLength)
+	errs.URL("cover_art", u.CoverArt, MaxCoverURLLength)
+
+	if u.Name == nil && u.Description == nil && u.CoverArt == nil && u.IsPublic == nil {
+		errs.Add("", validation.CodeEmpty, "no fields to update")
+	}
+
+	return errs
+}
+
+// Fields converts the update to the Mongo fields to set and to unset
+func (u PlaylistUpdate) Fields() (bson.M, bson.M) {
+	set := bson.M{}
+	unset := bson.M{}
+
+	if u.Name != nil {
+		set["name"] = strings.TrimSpace(*u.Name)
+	}
+	if u.Description != nil {
+		set["description"] = strings.TrimSpace(*u.Description)
+	}
+	if u.CoverArt != nil {
+		if cover := strings.TrimSpace(*u.CoverArt); cover != "" {
+			set["cover_art"] = cover
+		} else {
+			unset["cover_art"] = ""
+		}
+	}
+	if u.IsPublic != nil {
+		set["is_public"] = *u.IsPublic
+	}
+
+	return set, unset
+}
+
+// FieldNames lists the fields the update sets or removes
+func (u PlaylistUpdate) FieldNames() []string {
+	var names []string
+	if u.Name != nil {
+		names = append(names, "name")
+	}
+	if u.Description != nil {
+		names = append(names, "description")
+	}
+	if u.CoverArt != nil {
+		names = append(names, "cover_art")
+	}
+	if u.IsPublic != nil {
+		names = append(names, "is_public")
+	}
+	return names
+}
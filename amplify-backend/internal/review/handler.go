@@ -0,0 +1,222 @@
+package review
+
+import (
+	"amplify-backend/internal/middleware"
+	"errors"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// RegisterRoutes registers the public review listing
+func RegisterRoutes(app *fiber.App, service *ReviewService) {
+	// List published reviews for a track
+	app.Get("/tracks/:id/reviews", func(c *fiber.Ctx) error {
+		page, limit := parsePagination(c)
+
+		reviews, err := service.GetTrackReviews(c.Params("id"), page, limit)
+		if err != nil {
+			return errorResponse(c, err, "Failed to get reviews")
+		}
+
+		return c.JSON(reviews)
+	})
+}
+
+// RegisterUserRoutes registers rating and review routes on the authenticated /me group
+func RegisterUserRoutes(router fiber.Router, service *ReviewService) {
+	// Get the current user's review for a track
+	router.Get("/reviews/:trackId", func(c *fiber.Ctx) error {
+		userID, err := middleware.GetUserID(c)
+		if err != nil {
+			return c.Status(401).JSON(fiber.Map{
+				"error": "Unauthorized",
+			})
+		}
+
+		review, err := service.GetUserReview(userID, c.Params("trackId"))
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return c.Status(404).JSON(fiber.Map{
+					"error": "Review not found",
+				})
+			}
+			return errorResponse(c, err, "Failed to get review")
+		}
+
+		return c.JSON(review)
+	})
+
+	// Rate and optionally review a track
+	router.Put("/reviews/:trackId", func(c *fiber.Ctx) error {
+		userID, err := middleware.GetUserID(c)
+		if err != nil {
+			return c.Status(401).JSON(fiber.Map{
+				"error": "Unauthorized",
+			})
+		}
+
+		var body struct {
+			Rating int    `json:"rating"`
+			Text   string `json:"text"`
+		}
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid request",
+			})
+		}
+
+		review, err := service.SubmitReview(userID, c.Params("trackId"), body.Rating, body.Text)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return c.Status(404).JSON(fiber.Map{
+					"error": "Track not found",
+				})
+			}
+			return errorResponse(c, err, "Failed to save review")
+		}
+
+		return c.JSON(review)
+	})
+
+	// Remove the current user's rating and review
+	router.Delete("/reviews/:trackId", func(c *fiber.Ctx) error {
+		userID, err := middleware.GetUserID(c)
+		if err != nil {
+			return c.Status(401).JSON(fiber.Map{
+				"error": "Unauthorized",
+			})
+		}
+
+		if err := service.DeleteUserReview(userID, c.Params("trackId")); err != nil {
+			return errorResponse(c, err, "Failed to delete review")
+		}
+
+		return c.SendStatus(204)
+	})
+}
+
+// RegisterAdminRoutes registers the moderation queue on the /admin group
+func RegisterAdminRoutes(router fiber.Router, service *ReviewService) {
+	// Moderation queue: ?status=pending (default) or ?status=hidden
+	router.Get("/reviews/queue", func(c *fiber.Ctx) error {
+		page, limit := parsePagination(c)
+
+		reviews, err := service.GetModerationQueue(c.Query("status", "pending"), page, limit)
+		if err != nil {
+			return errorResponse(c, err, "Failed to get moderation queue")
+		}
+
+		return c.JSON(reviews)
+	})
+
+	// Moderation history for a review
+	router.Get("/reviews/:id/moderation", func(c *fiber.Ctx) error {
+		entries, err := service.GetModerationLog(c.Params("id"))
+		if err != nil {
+			return errorResponse(c, err, "Failed to get moderation log")
+		}
+
+		return c.JSON(entries)
+	})
+
+	// Approve a review
+	router.Post("/reviews/:id/approve", func(c *fiber.Ctx) error {
+		moderatorID, _ := middleware.GetUserID(c)
+
+		review, err := service.ApproveReview(c.Params("id"), moderatorID)
+		if err != nil {
+			return errorResponse(c, err, "Failed to approve review")
+		}
+
+		return c.JSON(review)
+	})
+
+	// Hide a review with a reason
+	router.Post("/reviews/:id/hide", func(c *fiber.Ctx) error {
+		moderatorID, _ := middleware.GetUserID(c)
+
+		var body struct {
+			Reason string `json:"reason"`
+		}
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid request",
+			})
+		}
+
+		review, err := service.HideReview(c.Params("id"), moderatorID, body.Reason)
+		if err != nil {
+			return errorResponse(c, err, "Failed to hide review")
+		}
+
+		return c.JSON(review)
+	})
+
+	// Delete a review with a reason (?reason= or JSON body)
+	router.Delete("/reviews/:id", func(c *fiber.Ctx) error {
+		moderatorID, _ := middleware.GetUserID(c)
+
+		reason := c.Query("reason")
+		if reason == "" && len(c.Body()) > 0 {
+			var body struct {
+				Reason string `json:"reason"`
+			}
+			if err := c.BodyParser(&body); err != nil {
+				return c.Status(400).JSON(fiber.Map{
+					"error": "Invalid request",
+				})
+			}
+			reason = body.Reason
+		}
+
+		if err := service.DeleteReview(c.Params("id"), moderatorID, reason); err != nil {
+			return errorResponse(c, err, "Failed to delete review")
+		}
+
+		return c.SendStatus(204)
+	})
+}
+
+// errorResponse maps service errors to HTTP status codes
+func errorResponse(c *fiber.Ctx, err error, fallback string) error {
+	switch {
+	case errors.Is(err, primitive.ErrInvalidHex):
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid ID"})
+	case errors.Is(err, ErrInvalidRating), errors.Is(err, ErrTextTooLong), errors.Is(err, ErrReasonMissing):
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return c.Status(404).JSON(fiber.Map{"error": "Review not found"})
+	default:
+		return c.Status(500).JSON(fiber.Map{"error": fallback})
+	}
+}
+
+// parsePagination reads ?page= and ?limit= with sane defaults
+func parsePagination(c *fiber.Ctx) (int, int) {
+	page := 1
+	if pageParam := c.Query("page"); pageParam != "" {
+		if parsedPage, err := strconv.Atoi(pageParam); err == nil && parsedPage > 0 {
+			page = parsedPage
+		}
+	}
+
+	limit := defaultPageSize
+	if limitParam := c.Query("limit"); limitParam != "" {
+		if parsedLimit, err := strconv.Atoi(limitParam); err == nil && parsedLimit > 0 {
+			limit = parsedLimit
+		}
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+
+	return page, limit
+}
@@ -0,0 +1,65 @@
+package review
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Review status values
+const (
+	StatusPublished = "published"
+	StatusHidden    = "hidden"
+)
+
+// Moderation actions recorded in the moderation log
+const (
+	ActionApprove = "approve"
+	ActionHide    = "hide"
+	ActionDelete  = "delete"
+)
+
+// Limits for ratings and review text
+const (
+	MinRating     = 1
+	MaxRating     = 5
+	MaxTextLength = 500 // characters
+)
+
+// Review is a user's 1-5 star rating of a track with an optional short text review
+type Review struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID    string             `bson:"user_id" json:"user_id"` // Supabase User ID
+	TrackID   primitive.ObjectID `bson:"track_id" json:"track_id"`
+	Rating    int                `bson:"rating" json:"rating"`
+	Text      string             `bson:"text,omitempty" json:"text,omitempty"`
+	Status    string             `bson:"status" json:"status"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time          `bson:"updated_at" json:"updated_at"`
+
+	// Moderation state (set once an admin has reviewed the text)
+	ModeratedAt      *time.Time `bson:"moderated_at,omitempty" json:"moderated_at,omitempty"`
+	ModeratedBy      string     `bson:"moderated_by,omitempty" json:"moderated_by,omitempty"`
+	ModerationReason string     `bson:"moderation_reason,omitempty" json:"moderation_reason,omitempty"`
+}
+
+// ModerationEntry is an append-only record of a moderation decision
+type ModerationEntry struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	ReviewID    primitive.ObjectID `bson:"review_id" json:"review_id"`
+	TrackID     primitive.ObjectID `bson:"track_id" json:"track_id"`
+	UserID      string             `bson:"user_id" json:"user_id"` // Author of the review
+	Action      string             `bson:"action" json:"action"`
+	Reason      string             `bson:"reason,omitempty" json:"reason,omitempty"`
+	ModeratorID string             `bson:"moderator_id" json:"moderator_id"`
+	Text        string             `bson:"text,omitempty" json:"text,omitempty"` // Review text at the time of the decision
+	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// ReviewPage is a page of reviews with the total count for pagination
+type ReviewPage struct {
+	Reviews []Review `json:"reviews"`
+	Total   int64    `json:"total"`
+	Page    int      `json:"page"`
+	Limit   int      `json:"limit"`
+}
@@ -0,0 +1,427 @@
+package review
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrInvalidRating = errors.New("rating must be between 1 and 5")
+	ErrTextTooLong   = errors.New("review text must be at most 500 characters")
+	ErrReasonMissing = errors.New("a moderation reason is required")
+)
+
+type ReviewService struct {
+	ReviewCollection     *mongo.Collection
+	ModerationCollection *mongo.Collection
+	TrackCollection      *mongo.Collection
+}
+
+func NewReviewService(db *mongo.Database) *ReviewService {
+	return &ReviewService{
+		ReviewCollection:     db.Collection("reviews"),
+		ModerationCollection: db.Collection("review_moderation"),
+		TrackCollection:      db.Collection("tracks"),
+	}
+}
+
+// EnsureIndexes creates the indexes used by rating upserts, track listings and the moderation queue
+func (s *ReviewService) EnsureIndexes() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := s.ReviewCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "track_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "track_id", Value: 1}, {Key: "status", Value: 1}, {Key: "created_at", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "status", Value: 1}, {Key: "moderated_at", Value: 1}, {Key: "created_at", Value: 1}},
+		},
+	})
+	return err
+}
+
+// SubmitReview creates or replaces the user's rating and review for a track
+// Changing the text sends the review back to the moderation queue
+func (s *ReviewService) SubmitReview(userID, trackID string, rating int, text string) (*Review, error) {
+	trackObjID, err := primitive.ObjectIDFromHex(trackID)
+	if err != nil {
+		return nil, err
+	}
+
+	if rating < MinRating || rating > MaxRating {
+		return nil, ErrInvalidRating
+	}
+
+	text = strings.TrimSpace(text)
+	if utf8.RuneCountInString(text) > MaxTextLength {
+		return nil, ErrTextTooLong
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Make sure the track exists before accepting a rating
+	if err := s.TrackCollection.FindOne(ctx, bson.M{"_id": trackObjID, "deleted_at": bson.M{"$exists": false}}).Err(); err != nil {
+		return nil, err
+	}
+
+	filter := bson.M{"user_id": userID, "track_id": trackObjID}
+
+	var existing Review
+	err = s.ReviewCollection.FindOne(ctx, filter).Decode(&existing)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, err
+	}
+	textChanged := err != nil || existing.Text != text
+
+	now := time.Now()
+	update := bson.M{
+		"$set": bson.M{
+			"rating":     rating,
+			"text":       text,
+			"updated_at": now,
+		},
+		"$setOnInsert": bson.M{
+			"created_at": now,
+		},
+	}
+
+	// New or edited text has to be moderated again
+	if textChanged {
+		update["$set"].(bson.M)["status"] = StatusPublished
+		update["$unset"] = bson.M{
+			"moderated_at":      "",
+			"moderated_by":      "",
+			"moderation_reason": "",
+		}
+	}
+
+	var review Review
+	err = s.ReviewCollection.FindOneAndUpdate(
+		ctx,
+		filter,
+		update,
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&review)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.recomputeTrackRating(ctx, trackObjID); err != nil {
+		return nil, err
+	}
+
+	return &review, nil
+}
+
+// GetUserReview returns the user's review for a track
+func (s *ReviewService) GetUserReview(userID, trackID string) (*Review, error) {
+	trackObjID, err := primitive.ObjectIDFromHex(trackID)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var review Review
+	err = s.ReviewCollection.FindOne(ctx, bson.M{"user_id": userID, "track_id": trackObjID}).Decode(&review)
+	if err != nil {
+		return nil, err
+	}
+
+	return &review, nil
+}
+
+// DeleteUserReview removes the user's own rating and review for a track
+func (s *ReviewService) DeleteUserReview(userID, trackID string) error {
+	trackObjID, err := primitive.ObjectIDFromHex(trackID)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := s.ReviewCollection.DeleteOne(ctx, bson.M{"user_id": userID, "track_id": trackObjID})
+	if err != nil {
+		return err
+	}
+
+	if res.DeletedCount == 0 {
+		return nil
+	}
+
+	return s.recomputeTrackRating(ctx, trackObjID)
+}
+
+// GetTrackReviews returns the published text reviews for a track, newest first
+func (s *ReviewService) GetTrackReviews(trackID string, page, limit int) (*ReviewPage, error) {
+	trackObjID, err := primitive.ObjectIDFromHex(trackID)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := bson.M{
+		"track_id": trackObjID,
+		"status":   StatusPublished,
+		"text":     bson.M{"$nin": bson.A{"", nil}},
+	}
+
+	return s.findPage(filter, bson.D{{Key: "created_at", Value: -1}}, page, limit)
+}
+
+// GetModerationQueue returns text reviews waiting for moderation (status "pending", oldest first)
+// or reviews that were hidden (status "hidden", most recently moderated first)
+func (s *ReviewService) GetModerationQueue(status string, page, limit int) (*ReviewPage, error) {
+	if status == StatusHidden {
+		return s.findPage(
+			bson.M{"status": StatusHidden},
+			bson.D{{Key: "moderated_at", Value: -1}},
+			page,
+			limit,
+		)
+	}
+
+	filter := bson.M{
+		"status":       StatusPublished,
+		"moderated_at": bson.M{"$exists": false},
+		"text":         bson.M{"$nin": bson.A{"", nil}},
+	}
+
+	return s.findPage(filter, bson.D{{Key: "created_at", Value: 1}}, page, limit)
+}
+
+// ApproveReview marks a review as moderated and keeps it published
+func (s *ReviewService) ApproveReview(reviewID, moderatorID string) (*Review, error) {
+	return s.moderate(reviewID, moderatorID, ActionApprove, StatusPublished, "")
+}
+
+// HideReview hides a review's text from public listings. The rating still counts towards the average.
+func (s *ReviewService) HideReview(reviewID, moderatorID, reason string) (*Review, error) {
+	if strings.TrimSpace(reason) == "" {
+		return nil, ErrReasonMissing
+	}
+	return s.moderate(reviewID, moderatorID, ActionHide, StatusHidden, reason)
+}
+
+// DeleteReview permanently removes a review and its rating, recording the reason in the moderation log
+func (s *ReviewService) DeleteReview(reviewID, moderatorID, reason string) error {
+	objectID, err := primitive.ObjectIDFromHex(reviewID)
+	if err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(reason) == "" {
+		return ErrReasonMissing
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var review Review
+	err = s.ReviewCollection.FindOneAndDelete(ctx, bson.M{"_id": objectID}).Decode(&review)
+	if err != nil {
+		return err
+	}
+
+	if err := s.logModeration(ctx, &review, moderatorID, ActionDelete, reason); err != nil {
+		return err
+	}
+
+	return s.recomputeTrackRating(ctx, review.TrackID)
+}
+
+// GetModerationLog returns the moderation decisions for a review
+func (s *ReviewService) GetModerationLog(reviewID string) ([]ModerationEntry, error) {
+	objectID, err := primitive.ObjectIDFromHex(reviewID)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := s.ModerationCollection.Find(
+		ctx,
+		bson.M{"review_id": objectID},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	entries := []ModerationEntry{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+func (s *ReviewService) moderate(reviewID, moderatorID, action, status, reason string) (*Review, error) {
+	objectID, err := primitive.ObjectIDFromHex(reviewID)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	set := bson.M{
+		"status":       status,
+		"moderated_at": now,
+		"moderated_by": moderatorID,
+	}
+	update := bson.M{"$set": set}
+	if reason != "" {
+		set["moderation_reason"] = reason
+	} else {
+		update["$unset"] = bson.M{"moderation_reason": ""}
+	}
+
+	var review Review
+	err = s.ReviewCollection.FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": objectID},
+		update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&review)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.logModeration(ctx, &review, moderatorID, action, reason); err != nil {
+		return nil, err
+	}
+
+	return &review, nil
+}
+
+func (s *ReviewService) logModeration(ctx context.Context, review *Review, moderatorID, action, reason string) error {
+	_, err := s.ModerationCollection.InsertOne(ctx, ModerationEntry{
+		ReviewID:    review.ID,
+		TrackID:     review.TrackID,
+		UserID:      review.UserID,
+		Action:      action,
+		Reason:      reason,
+		ModeratorID: moderatorID,
+		Text:        review.Text,
+		CreatedAt:   time.Now(),
+	})
+	return err
+}
+
+func (s *ReviewService) findPage(filter bson.M, sort bson.D, page, limit int) (*ReviewPage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	total, err := s.ReviewCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	cursor, err := s.ReviewCollection.Find(
+		ctx,
+		filter,
+		options.Find().
+			SetSort(sort).
+			SetSkip(int64((page-1)*limit)).
+			SetLimit(int64(limit)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	reviews := []Review{}
+	if err := cursor.All(ctx, &reviews); err != nil {
+		return nil, err
+	}
+
+	return &ReviewPage{
+		Reviews: reviews,
+		Total:   total,
+		Page:    page,
+		Limit:   limit,
+	}, nil
+}
+
+// recomputeTrackRating denormalizes the average rating and rating count onto the track
+func (s *ReviewService) recomputeTrackRating(ctx context.Context, trackID primitive.ObjectID) error {
+	pipeline := []bson.M{
+		{"$match": bson.M{"track_id": trackID}},
+		{
+			"$group": bson.M{
+				"_id":     nil,
+				"average": bson.M{"$avg": "$rating"},
+				"count":   bson.M{"$sum": 1},
+			},
+		},
+	}
+
+	cursor, err := s.ReviewCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	var result []struct {
+		Average float64 `bson:"average"`
+		Count   int     `bson:"count"`
+	}
+	if err := cursor.All(ctx, &result); err != nil {
+		return err
+	}
+
+	average, count := 0.0, 0
+	if len(result) > 0 {
+		average, count = result[0].Average, result[0].Count
+	}
+
+	_, err = s.TrackCollection.UpdateOne(
+		ctx,
+		bson.M{"_id": trackID},
+		bson.M{"$set": bson.M{
+			"average_rating": average,
+			"rating_count":   count,
+		}},
+	)
+	return err
+}
+
+// TrackTrashed keeps the reviews of a trashed track, so restoring it brings them back
+func (s *ReviewService) TrackTrashed(trackID primitive.ObjectID, deletedAt time.Time) error {
+	return nil
+}
+
+func (s *ReviewService) TrackRestored(trackID primitive.ObjectID) error {
+	return nil
+}
+
+// TrackPurged removes the reviews of a permanently deleted track and their moderation history
+func (s *ReviewService) TrackPurged(trackID primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := s.ReviewCollection.DeleteMany(ctx, bson.M{"track_id": trackID}); err != nil {
+		return err
+	}
+	_, err := s.ModerationCollection.DeleteMany(ctx, bson.M{"track_id": trackID})
+	return err
+}
@@ -0,0 +1,92 @@
+package trash
+
+import (
+	"amplify-backend/internal/middleware"
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// RegisterAdminRoutes registers trash management on the /admin group
+func RegisterAdminRoutes(router fiber.Router, purger *Purger) {
+	// List everything in the trash
+	router.Get("/trash", func(c *fiber.Ctx) error {
+		tracks, err := purger.MusicService.GetDeletedTracks()
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error": "Failed to get deleted tracks",
+			})
+		}
+
+		playlists, err := purger.PlaylistService.GetDeletedPlaylists()
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error": "Failed to get deleted playlists",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"tracks":         tracks,
+			"playlists":      playlists,
+			"retention_days": int(purger.Retention.Hours() / 24),
+		})
+	})
+
+	// Restore a track
+	router.Post("/trash/tracks/:id/restore", func(c *fiber.Ctx) error {
+		track, err := purger.MusicService.RestoreTrack(c.Params("id"))
+		if err != nil {
+			return errorResponse(c, err, "Failed to restore track")
+		}
+
+		return c.JSON(track)
+	})
+
+	// Restore a playlist
+	router.Post("/trash/playlists/:id/restore", func(c *fiber.Ctx) error {
+		actorID, _ := middleware.GetUserID(c)
+		playlist, err := purger.PlaylistService.RestorePlaylist(c.Params("id"), actorID)
+		if err != nil {
+			return errorResponse(c, err, "Failed to restore playlist")
+		}
+
+		return c.JSON(playlist)
+	})
+
+	// Permanently delete a track now (including its audio file)
+	router.Delete("/trash/tracks/:id", func(c *fiber.Ctx) error {
+		if err := purger.PurgeTrack(c.Params("id")); err != nil {
+			return errorResponse(c, err, "Failed to purge track")
+		}
+
+		return c.SendStatus(204)
+	})
+
+	// Permanently delete a playlist now
+	router.Delete("/trash/playlists/:id", func(c *fiber.Ctx) error {
+		if _, err := purger.PlaylistService.PurgePlaylist(c.Params("id")); err != nil {
+			return errorResponse(c, err, "Failed to purge playlist")
+		}
+
+		return c.SendStatus(204)
+	})
+
+	// Run the retention purge immediately
+	router.Post("/trash/purge", func(c *fiber.Ctx) error {
+		return c.JSON(purger.PurgeExpired())
+	})
+}
+
+// errorResponse maps service errors to HTTP status codes
+func errorResponse(c *fiber.Ctx, err error, fallback string) error {
+	switch {
+	case errors.Is(err, primitive.ErrInvalidHex):
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid ID"})
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return c.Status(404).JSON(fiber.Map{"error": "Item not found in trash"})
+	default:
+		return c.Status(500).JSON(fiber.Map{"error": fallback})
+	}
+}
@@ -0,0 +1,113 @@
+package trash
+
+import (
+	"amplify-backend/internal/music"
+	"amplify-backend/internal/playlist"
+	"amplify-backend/internal/storage"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// DefaultRetention is how long deleted items stay in the trash before they are purged
+const DefaultRetention = 30 * 24 * time.Hour
+
+// DefaultInterval is how often the purge job runs
+const DefaultInterval = time.Hour
+
+// Purger permanently deletes trashed tracks and playlists once the retention period has passed
+type Purger struct {
+	MusicService    *music.MusicService
+	PlaylistService *playlist.PlaylistService
+	Storage         storage.StorageProvider
+	Retention       time.Duration
+	Interval        time.Duration
+}
+
+// PurgeReport summarizes a purge run
+type PurgeReport struct {
+	Tracks    int      `json:"tracks"`
+	Playlists int      `json:"playlists"`
+	Errors    []string `json:"errors,omitempty"`
+}
+
+// NewPurger creates a purger using TRASH_RETENTION_DAYS (default 30 days)
+func NewPurger(musicService *music.MusicService, playlistService *playlist.PlaylistService, storageService storage.StorageProvider) *Purger {
+	retention := DefaultRetention
+	if days := os.Getenv("TRASH_RETENTION_DAYS"); days != "" {
+		if parsed, err := strconv.Atoi(days); err == nil && parsed >= 0 {
+			retention = time.Duration(parsed) * 24 * time.Hour
+		}
+	}
+
+	return &Purger{
+		MusicService:    musicService,
+		PlaylistService: playlistService,
+		Storage:         storageService,
+		Retention:       retention,
+		Interval:        DefaultInterval,
+	}
+}
+
+// Run purges expired items on every interval. It blocks, so start it in a goroutine.
+func (p *Purger) Run() {
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+
+	for {
+		report := p.PurgeExpired()
+		if report.Tracks > 0 || report.Playlists > 0 || len(report.Errors) > 0 {
+			log.Printf("Trash purge: %d tracks, %d playlists, %d errors", report.Tracks, report.Playlists, len(report.Errors))
+		}
+		<-ticker.C
+	}
+}
+
+// PurgeExpired permanently deletes everything that has been in the trash longer than the retention period
+func (p *Purger) PurgeExpired() PurgeReport {
+	cutoff := time.Now().Add(-p.Retention)
+	var report PurgeReport
+
+	tracks, err := p.MusicService.GetExpiredTracks(cutoff)
+	if err != nil {
+		report.Errors = append(report.Errors, "failed to list expired tracks: "+err.Error())
+	}
+	for _, track := range tracks {
+		if err := p.PurgeTrack(track.ID.Hex()); err != nil {
+			report.Errors = append(report.Errors, "track "+track.ID.Hex()+": "+err.Error())
+			continue
+		}
+		report.Tracks++
+	}
+
+	playlists, err := p.PlaylistService.GetExpiredPlaylists(cutoff)
+	if err != nil {
+		report.Errors = append(report.Errors, "failed to list expired playlists: "+err.Error())
+	}
+	for _, pl := range playlists {
+		if _, err := p.PlaylistService.PurgePlaylist(pl.ID.Hex()); err != nil {
+			report.Errors = append(report.Errors, "playlist "+pl.ID.Hex()+": "+err.Error())
+			continue
+		}
+		report.Playlists++
+	}
+
+	return report
+}
+
+// PurgeTrack permanently deletes a trashed track and its audio file
+func (p *Purger) PurgeTrack(id string) error {
+	track, err := p.MusicService.PurgeTrack(id)
+	if err != nil {
+		return err
+	}
+
+	if track.FilePath != "" {
+		if err := p.Storage.DeleteFile(track.FilePath); err != nil {
+			log.Printf("Failed to delete audio file for purged track %s: %v", id, err)
+		}
+	}
+
+	return nil
+}
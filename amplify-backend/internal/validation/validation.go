@@ -0,0 +1,205 @@
+package validation
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Error codes returned in field errors
+const (
+	CodeInvalidJSON  = "invalid_json"
+	CodeUnknownField = "unknown_field"
+	CodeInvalidType  = "invalid_type"
+	CodeRequired     = "required"
+	CodeTooShort     = "too_short"
+	CodeTooLong      = "too_long"
+	CodeOutOfRange   = "out_of_range"
+	CodeInvalidURL   = "invalid_url"
+	CodeEmpty        = "empty"
+)
+
+// FieldError describes why a single field was rejected
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Errors is a list of field errors; it implements error so services can return it
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	parts := make([]string, len(e))
+	for i, fe := range e {
+		if fe.Field == "" {
+			parts[i] = fe.Message
+		} else {
+			parts[i] = fe.Field + ": " + fe.Message
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Add appends a field error
+func (e *Errors) Add(field, code, message string) {
+	*e = append(*e, FieldError{Field: field, Code: code, Message: message})
+}
+
+// Err returns the errors as an error, or nil when there are none
+func (e Errors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Prefix nests the errors under a parent field, e.g. "title" becomes "set.title"
+func (e Errors) Prefix(parent string) Errors {
+	nested := make(Errors, len(e))
+	for i, fe := range e {
+		nested[i] = fe
+		if fe.Field == "" {
+			nested[i].Field = parent
+		} else {
+			nested[i].Field = parent + "." + fe.Field
+		}
+	}
+	return nested
+}
+
+// Response writes a 400 response with the field errors
+func Response(c *fiber.Ctx, errs Errors) error {
+	return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+		"error":  "Validation failed",
+		"fields": errs,
+	})
+}
+
+// DecodeStrict decodes a JSON object into the struct pointed to by dst, field by field
+// Only keys matching a json tag on dst are accepted; keys listed in ignored are dropped silently
+// (for read-only fields clients echo back). Every unknown key and mistyped value is reported.
+func DecodeStrict(body []byte, dst interface{}, ignored ...string) Errors {
+	var errs Errors
+
+	var raw map[string]json.RawMessage
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	if err := decoder.Decode(&raw); err != nil || raw == nil {
+		errs.Add("", CodeInvalidJSON, "request body must be a JSON object")
+		return errs
+	}
+
+	skip := make(map[string]bool, len(ignored))
+	for _, field := range ignored {
+		skip[field] = true
+	}
+
+	value := reflect.ValueOf(dst).Elem()
+	fields := make(map[string]reflect.Value, value.NumField())
+	for i := 0; i < value.NumField(); i++ {
+		name := strings.Split(value.Type().Field(i).Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" {
+			fields[name] = value.Field(i)
+		}
+	}
+
+	for key, rawValue := range raw {
+		if skip[key] {
+			continue
+		}
+
+		field, ok := fields[key]
+		if !ok {
+			errs.Add(key, CodeUnknownField, "field is not allowed")
+			continue
+		}
+
+		target := reflect.New(field.Type())
+		if err := json.Unmarshal(rawValue, target.Interface()); err != nil {
+			errs.Add(key, CodeInvalidType, "must be "+typeName(field.Type()))
+			continue
+		}
+		field.Set(target.Elem())
+	}
+
+	sortErrors(errs)
+	return errs
+}
+
+// String checks the trimmed length of an optional string field
+func (e *Errors) String(field string, value *string, minLen, maxLen int) {
+	if value == nil {
+		return
+	}
+	length := utf8.RuneCountInString(strings.TrimSpace(*value))
+	if minLen > 0 && length < minLen {
+		if minLen == 1 {
+			e.Add(field, CodeEmpty, "must not be empty")
+		} else {
+			e.Add(field, CodeTooShort, fmt.Sprintf("must be at least %d characters", minLen))
+		}
+		return
+	}
+	if maxLen > 0 && length > maxLen {
+		e.Add(field, CodeTooLong, fmt.Sprintf("must be at most %d characters", maxLen))
+	}
+}
+
+// IntRange checks an optional integer field against inclusive bounds
+func (e *Errors) IntRange(field string, value *int, minValue, maxValue int) {
+	if value == nil {
+		return
+	}
+	if *value < minValue || *value > maxValue {
+		e.Add(field, CodeOutOfRange, fmt.Sprintf("must be between %d and %d", minValue, maxValue))
+	}
+}
+
+// URL checks that an optional field is an absolute http(s) URL; an empty string is allowed (clears the field)
+func (e *Errors) URL(field string, value *string, maxLen int) {
+	if value == nil || strings.TrimSpace(*value) == "" {
+		return
+	}
+	if maxLen > 0 && len(*value) > maxLen {
+		e.Add(field, CodeTooLong, fmt.Sprintf("must be at most %d characters", maxLen))
+		return
+	}
+	parsed, err := url.Parse(strings.TrimSpace(*value))
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		e.Add(field, CodeInvalidURL, "must be an absolute http or https URL")
+	}
+}
+
+func typeName(t reflect.Type) string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	default:
+		return "an object"
+	}
+}
+
+// sortErrors orders errors by field name so responses are deterministic
+func sortErrors(errs Errors) {
+	sort.SliceStable(errs, func(i, j int) bool {
+		return errs[i].Field < errs[j].Field
+	})
+}
@@ -0,0 +1,44 @@
+package websocket
+
+import "time"
+
+// PingData is the optional payload of a client ping, used to estimate the clock offset
+type PingData struct {
+	ClientTime int64 `json:"client_time"` // Client clock (ms since the epoch) when the ping was sent
+}
+
+// PongData answers a ping. A client that receives it at clientReceived (its own clock) estimates
+// the server clock as its clock plus offset, where
+//
+//	offset = server_time - (client_time + clientReceived) / 2
+//
+// Keeping the sample with the smallest round trip gives the most accurate offset.
+type PongData struct {
+	ClientTime int64 `json:"client_time,omitempty"` // Echoed from the ping
+	ServerTime int64 `json:"server_time"`           // Server clock (ms since the epoch) when the pong was sent
+}
+
+// nowMillis is the server clock in milliseconds since the epoch, as used in server_time fields
+func nowMillis() int64 {
+	return time.Now().UnixMilli()
+}
+
+// playbackRate is the state's playback speed, 1 unless set
+func (s *PlaybackState) playbackRate() float64 {
+	if s.Rate == nil || *s.Rate <= 0 {
+		return 1
+	}
+	return *s.Rate
+}
+
+// advanceTo extrapolates the position of a playing state to the server time now and stamps
+// the state with it. A paused state keeps its position; only the stamp moves.
+func (s *PlaybackState) advanceTo(now int64) {
+	if s.Position != nil && s.Playing != nil && *s.Playing && s.ServerTime > 0 && now > s.ServerTime {
+		position := *s.Position + int(float64(now-s.ServerTime)*s.playbackRate())
+		s.Position = &position
+	}
+	if s.Position != nil {
+		s.ServerTime = now
+	}
+}
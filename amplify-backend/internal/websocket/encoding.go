@@ -0,0 +1,110 @@
+package websocket
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/fasthttp/websocket"
+)
+
+// Subprotocols negotiated on /ws. Messages are JSON inside the hub and on Redis; each
+// connection gets them in its own encoding, so devices on different encodings share the
+// same fan-out. Clients that ask for no subprotocol get JSON.
+const (
+	SubprotocolJSON    = "amplify.v1.json"
+	SubprotocolMsgpack = "amplify.v1.msgpack"
+)
+
+// supportedSubprotocols is the server's order of preference
+var supportedSubprotocols = []string{SubprotocolMsgpack, SubprotocolJSON}
+
+// encodeFrame converts a JSON message to the frame sent on a connection with the subprotocol
+func encodeFrame(subprotocol string, message []byte) ([]byte, error) {
+	if subprotocol != SubprotocolMsgpack {
+		return message, nil
+	}
+	return jsonToMsgpack(message)
+}
+
+// decodeFrame converts a received frame to JSON. Binary frames are msgpack; text frames are
+// JSON on any connection.
+func decodeFrame(frameType int, frame []byte) ([]byte, error) {
+	if frameType != websocket.BinaryMessage {
+		return frame, nil
+	}
+	value, err := decodeMsgpack(frame)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(value)
+}
+
+// jsonToMsgpack re-encodes a JSON document as msgpack, keeping integers as integers
+func jsonToMsgpack(message []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(message))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	value, err := fromJSONNumbers(value)
+	if err != nil {
+		return nil, err
+	}
+	return appendMsgpack(make([]byte, 0, len(message)), value)
+}
+
+// fromJSONNumbers replaces json.Number with int64, or float64 if it is not an integer
+func fromJSONNumbers(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case json.Number:
+		if n, err := strconv.ParseInt(v.String(), 10, 64); err == nil {
+			return n, nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %s: %w", v, err)
+		}
+		return f, nil
+	case []interface{}:
+		for i, item := range v {
+			converted, err := fromJSONNumbers(item)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = converted
+		}
+	case map[string]interface{}:
+		for key, item := range v {
+			converted, err := fromJSONNumbers(item)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = converted
+		}
+	}
+	return value, nil
+}
+
+// frameType is the WebSocket frame type for this client's encoding
+func (c *Client) frameType() int {
+	if c.subprotocol == SubprotocolMsgpack {
+		return websocket.BinaryMessage
+	}
+	return websocket.TextMessage
+}
+
+// encode converts a JSON message to this client's encoding. Returns nil, after logging, if
+// the message can't be encoded.
+func (c *Client) encode(message []byte) []byte {
+	frame, err := encodeFrame(c.subprotocol, message)
+	if err != nil {
+		log.Printf("Failed to encode message for client %s: %v", c.ID, err)
+		return nil
+	}
+	return frame
+}
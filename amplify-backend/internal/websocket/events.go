@@ -0,0 +1,213 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// eventLogLength is roughly how many events are kept per user for replay
+	eventLogLength = 500
+
+	// maxReplay is the most events replayed to a reconnecting client; a longer gap gets a
+	// snapshot instead. Kept below the send buffer so a replay fits in it.
+	maxReplay = 200
+)
+
+// ResumeInfo is sent once a client is up to date, after the replay or the snapshot.
+// The client keeps the seq of the last message it received and reconnects with
+// /ws?last_seq=<seq> to get the events it missed.
+type ResumeInfo struct {
+	Seq      string `json:"seq,omitempty"` // Last event included; empty if the user has no events yet
+	Replayed int    `json:"replayed"`      // Number of events replayed
+	Snapshot bool   `json:"snapshot"`      // The current state was sent instead of a replay
+}
+
+// loggedEvent is a message from a user's event log
+type loggedEvent struct {
+	Seq     string
+	Payload []byte
+}
+
+func getEventsKey(userID string) string {
+	return "user:" + userID + ":events"
+}
+
+// publishEventScript appends a message to the user's event log and publishes it, tagged with
+// its log ID, in one step so live delivery and the log always agree on the order.
+//
+// KEYS[1] is the event log. ARGV[1] is the log length, ARGV[2] the TTL (s), ARGV[3] the
+// message and ARGV[4] the channel. The channel payload is "<seq> <message>".
+var publishEventScript = redis.NewScript(`
+local seq = redis.call('XADD', KEYS[1], 'MAXLEN', '~', ARGV[1], '*', 'message', ARGV[3])
+redis.call('EXPIRE', KEYS[1], ARGV[2])
+redis.call('PUBLISH', ARGV[4], seq .. ' ' .. ARGV[3])
+return seq
+`)
+
+// appendEvent logs and publishes a marshaled message for every device of the user
+func (h *Hub) appendEvent(userID string, data []byte) error {
+	return publishEventScript.Run(
+		context.Background(),
+		h.redisClient,
+		[]string{getEventsKey(userID)},
+		eventLogLength, int(playbackTTL/time.Second), data, getPlaybackChannel(userID),
+	).Err()
+}
+
+// splitEvent splits a channel payload into its seq and message. Payloads published without
+// the event log (by an older server) have no seq.
+func splitEvent(payload string) (string, []byte) {
+	if strings.HasPrefix(payload, "{") {
+		return "", []byte(payload)
+	}
+	seq, message, _ := strings.Cut(payload, " ")
+	return seq, []byte(message)
+}
+
+// withSeq adds the seq to a marshaled message
+func withSeq(message []byte, seq string) []byte {
+	if seq == "" {
+		return message
+	}
+
+	var raw struct {
+		Type string          `json:"type"`
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(message, &raw); err != nil {
+		return message
+	}
+
+	msg := Message{Type: raw.Type, Seq: seq}
+	if raw.Data != nil {
+		msg.Data = raw.Data
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return message
+	}
+	return data
+}
+
+// parseSeq splits an event log ID ("<ms>-<n>") into its parts
+func parseSeq(seq string) (uint64, uint64, bool) {
+	msPart, nPart, ok := strings.Cut(seq, "-")
+	if !ok {
+		return 0, 0, false
+	}
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	n, err := strconv.ParseUint(nPart, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return ms, n, true
+}
+
+// seqAfter reports whether seq a comes after seq b. Anything comes after an invalid seq.
+func seqAfter(a, b string) bool {
+	bMs, bN, ok := parseSeq(b)
+	if !ok {
+		return true
+	}
+	aMs, aN, ok := parseSeq(a)
+	if !ok {
+		return false
+	}
+	return aMs > bMs || (aMs == bMs && aN > bN)
+}
+
+// missedEvents returns the events logged after lastSeq. It reports false when they can't be
+// replayed: lastSeq is no longer in the log (trimmed, expired or never seen) or too many
+// events were missed.
+func (h *Hub) missedEvents(userID, lastSeq string) ([]loggedEvent, bool) {
+	if _, _, ok := parseSeq(lastSeq); !ok {
+		return nil, false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Starting at lastSeq itself shows whether the log still reaches back that far
+	entries, err := h.redisClient.XRangeN(ctx, getEventsKey(userID), lastSeq, "+", maxReplay+2).Result()
+	if err != nil {
+		log.Printf("Failed to read event log for user %s: %v", userID, err)
+		return nil, false
+	}
+	if len(entries) == 0 || entries[0].ID != lastSeq || len(entries) > maxReplay+1 {
+		return nil, false
+	}
+
+	events := make([]loggedEvent, 0, len(entries)-1)
+	for _, entry := range entries[1:] {
+		message, _ := entry.Values["message"].(string)
+		events = append(events, loggedEvent{Seq: entry.ID, Payload: []byte(message)})
+	}
+	return events, true
+}
+
+// latestSeq returns the ID of the user's last logged event, or "" if there is none
+func (h *Hub) latestSeq(userID string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	entries, err := h.redisClient.XRevRangeN(ctx, getEventsKey(userID), "+", "-", 1).Result()
+	if err != nil || len(entries) == 0 {
+		return ""
+	}
+	return entries[0].ID
+}
+
+// resume brings a newly registered client up to date: the events it missed since its
+// last_seq, or the current state when there is no last_seq or the gap can't be replayed.
+// The user's subscription is already up, so events published meanwhile are delivered live
+// and anything already replayed is skipped by seq.
+func (h *Hub) resume(c *Client) {
+	if c.lastSeq != "" {
+		if events, ok := h.missedEvents(c.UserID, c.lastSeq); ok {
+			for _, event := range events {
+				if frame := c.encode(withSeq(event.Payload, event.Seq)); frame != nil {
+					c.trySend(frame)
+				}
+				c.lastSeq = event.Seq
+			}
+			c.sendMessage(Message{Type: "session:ready", Data: ResumeInfo{Seq: c.lastSeq, Replayed: len(events)}})
+			return
+		}
+		log.Printf("Cannot replay events after %s for client %s, sending snapshot", c.lastSeq, c.ID)
+	}
+
+	// Read the position in the log first: events after it are delivered live, and any that
+	// are already part of the snapshot only repeat state the client has
+	c.lastSeq = h.latestSeq(c.UserID)
+	h.sendSnapshot(c)
+	c.sendMessage(Message{Type: "session:ready", Data: ResumeInfo{Seq: c.lastSeq, Snapshot: true}})
+}
+
+// sendSnapshot sends the current playback state and queue to a client. The device list
+// follows from the registration itself.
+func (h *Hub) sendSnapshot(c *Client) {
+	state, err := h.loadPlaybackState(c.UserID)
+	if err == nil && state.Version > 0 {
+		// Send the position as of now, not as of the last update
+		state.advanceTo(nowMillis())
+		c.sendMessage(Message{Type: "playback:sync", Data: state})
+
+		// Bring the new client's lyrics view in step with the player
+		h.pushLyricLine(c.UserID, state, c)
+	}
+
+	// Send the shared queue so the new device shows the same up next
+	if queue, err := h.loadQueue(c.UserID); err == nil && !queue.isEmpty() {
+		c.sendMessage(Message{Type: "queue:sync", Data: queue.sync()})
+	}
+}
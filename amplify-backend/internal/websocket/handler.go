@@ -9,6 +9,11 @@ import (
 
 // RegisterWebSocketRoutesWithSupabase handles WebSocket with Supabase auth
 func RegisterWebSocketRoutesWithSupabase(app *fiber.App, hub *Hub, config *middleware.SupabaseConfig) {
+	// Message schema (JSON Schema) for generating client types
+	app.Get("/ws/schema", func(c *fiber.Ctx) error {
+		return c.JSON(hub.Schema())
+	})
+
 	app.Get("/ws", func(c *fiber.Ctx) error {
 		log.Println("[WebSocket] Connection attempt received")
 
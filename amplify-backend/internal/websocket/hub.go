@@ -6,6 +6,7 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"log"
+	"sync"
 	"time"
 
 	"github.com/fasthttp/websocket"
@@ -17,6 +18,7 @@ import (
 var fasthttpUpgrader = websocket.FastHTTPUpgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
+	Subprotocols:    supportedSubprotocols,
 	CheckOrigin: func(ctx *fasthttp.RequestCtx) bool {
 		return true // Allow all origins in development
 	},
@@ -36,49 +38,110 @@ type Hub struct {
 	broadcast chan *UserMessage
 
 	redisClient *redis.Client
+
+	// Redis subscription per user with clients on this instance
+	subscriptions map[string]*redis.PubSub
+
+	// Server messages described for the schema by other packages (see schema.go)
+	extraMessages map[string]messageSpec
+
+	// Optional lyrics source for lyrics:line updates (see lyrics.go)
+	lyrics        LyricsProvider
+	lyricsCache   map[string]lyricsCacheEntry
+	lyricsPending map[string][]lyricsRequest
+	lyricsLoaded  chan lyricsResult
+	lyricsCursors map[string]lyricsCursor
 }
 
 type Client struct {
 	hub        *Hub
 	conn       *websocket.Conn
-	send       chan []byte
+	send       chan []byte // Written through trySend and closed through close, never directly
 	ID         string
 	UserID     string
 	DeviceID   string
 	DeviceName string
+
+	// Seq of the last event from the user's event log sent to this client (see events.go)
+	lastSeq string
+
+	// Negotiated subprotocol, which sets the encoding of sent messages (see encoding.go)
+	subprotocol string
+
+	// Guards send: the hub closes it while readPump may still be replying
+	sendMu sync.Mutex
+	closed bool
 }
 
 type UserMessage struct {
 	UserID  string
+	Seq     string // Position in the user's event log, empty for unlogged messages
 	Message []byte
 }
 
+// Message is the envelope of every message in either direction (see protocol.go)
 type Message struct {
-	Type string      `json:"type"`
-	Data interface{} `json:"data"`
+	Type      string      `json:"type"`
+	RequestID string      `json:"request_id,omitempty"` // Chosen by the client, echoed in the ack, error or reply
+	Seq       string      `json:"seq,omitempty"`        // Set on events from the user's event log
+	Data      interface{} `json:"data"`
 }
 
 type PlaybackState struct {
-	TrackID        string  `json:"track_id"`
-	Position       *int    `json:"position,omitempty"`
-	Playing        *bool   `json:"playing,omitempty"`
-	Volume         float64 `json:"volume,omitempty"`
-	Shuffle        bool    `json:"shuffle,omitempty"`
-	Repeat         string  `json:"repeat,omitempty"`
-	ActiveDeviceID string  `json:"active_device_id,omitempty"`
+	TrackID        string   `json:"track_id"`
+	Position       *int     `json:"position,omitempty"`
+	Playing        *bool    `json:"playing,omitempty"`
+	Volume         *float64 `json:"volume,omitempty"`
+	Shuffle        *bool    `json:"shuffle,omitempty"`
+	Repeat         string   `json:"repeat,omitempty"`
+	ActiveDeviceID string   `json:"active_device_id,omitempty"`
+
+	// Server clock (ms since the epoch) at which Position was recorded. While playing, the
+	// position now is Position + (server now - ServerTime) * Rate; see clock.go.
+	ServerTime int64    `json:"server_time,omitempty"`
+	Rate       *float64 `json:"rate,omitempty"` // Playback speed, 1 when omitted
+
+	// Bumped by every change (see state.go). Clients send the version they last saw and
+	// updates based on an older state are rejected.
+	Version int64 `json:"version,omitempty"`
 }
 
 // Control message data structures
 type SeekCommand struct {
-	Position int `json:"position"`
+	Position   int   `json:"position"`
+	ServerTime int64 `json:"server_time,omitempty"` // Set by the server when the seek is received
 }
 
 type VolumeCommand struct {
-	Volume float64 `json:"volume"`
+	Volume *float64 `json:"volume"` // 0 to 1
+}
+
+type ShuffleCommand struct {
+	Shuffle *bool `json:"shuffle"`
+}
+
+type RepeatCommand struct {
+	Repeat string `json:"repeat,omitempty"`
+	Mode   string `json:"mode,omitempty"` // Sent by older clients instead of repeat
+}
+
+// mode is the requested repeat mode, from either field
+func (c *RepeatCommand) mode() string {
+	if c.Repeat != "" {
+		return c.Repeat
+	}
+	return c.Mode
 }
 
 type LoadTrackCommand struct {
 	TrackID string `json:"track_id"`
+
+	// Optional context to play the track from (see queue.go). TrackIDs replaces the queue's
+	// context tracks and Index picks the one to start at; without Index it is the first
+	// occurrence of TrackID.
+	Context  string   `json:"context,omitempty"`
+	TrackIDs []string `json:"track_ids,omitempty"`
+	Index    *int     `json:"index,omitempty"`
 }
 
 // Device management messages
@@ -90,7 +153,7 @@ type DeviceInfo struct {
 
 type SetActiveDeviceCommand struct {
 	DeviceID string `json:"device_id"`
-	Position int    `json:"position"`
+	Position *int   `json:"position,omitempty"` // Only used when the server has no timed position to hand over
 }
 
 type DeviceListUpdate struct {
@@ -110,57 +173,21 @@ func getPlaybackChannel(userID string) string {
 
 func NewHub(redisClient *redis.Client) *Hub {
 	return &Hub{
-		clients:     make(map[string]map[*Client]bool),
-		register:    make(chan *Client),
-		unregister:  make(chan *Client),
-		broadcast:   make(chan *UserMessage),
-		redisClient: redisClient,
+		clients:       make(map[string]map[*Client]bool),
+		register:      make(chan *Client),
+		unregister:    make(chan *Client),
+		broadcast:     make(chan *UserMessage),
+		redisClient:   redisClient,
+		subscriptions: make(map[string]*redis.PubSub),
+		extraMessages: make(map[string]messageSpec),
+		lyricsCache:   make(map[string]lyricsCacheEntry),
+		lyricsCursors: make(map[string]lyricsCursor),
+		lyricsPending: make(map[string][]lyricsRequest),
+		lyricsLoaded:  make(chan lyricsResult),
 	}
 }
 
 func (h *Hub) Run() {
-	// Helper to save state
-	savePlaybackState := func(userID string, newState PlaybackState) {
-		ctx := context.Background()
-		key := "user:" + userID + ":playback"
-
-		// Get existing state
-		var currentState PlaybackState
-		val, err := h.redisClient.Get(ctx, key).Result()
-		if err == nil {
-			json.Unmarshal([]byte(val), &currentState)
-		}
-
-		// Merge updates
-		if newState.TrackID != "" {
-			currentState.TrackID = newState.TrackID
-		}
-		if newState.Position != nil {
-			currentState.Position = newState.Position
-		}
-		if newState.Playing != nil {
-			currentState.Playing = newState.Playing
-		}
-		if newState.Volume != 0 {
-			currentState.Volume = newState.Volume
-		}
-		if newState.ActiveDeviceID != "" {
-			currentState.ActiveDeviceID = newState.ActiveDeviceID
-		}
-		// Sync shuffle state (explicit boolean check)
-		if newState.Shuffle != currentState.Shuffle {
-			currentState.Shuffle = newState.Shuffle
-		}
-		// Sync repeat mode
-		if newState.Repeat != "" {
-			currentState.Repeat = newState.Repeat
-		}
-
-		// Save back
-		data, _ := json.Marshal(currentState)
-		h.redisClient.Set(ctx, key, data, 24*time.Hour)
-	}
-
 	for {
 		select {
 		case client := <-h.register:
@@ -168,7 +195,7 @@ func (h *Hub) Run() {
 			if _, ok := h.clients[client.UserID]; !ok {
 				h.clients[client.UserID] = make(map[*Client]bool)
 				// Start subscription for this user if it's the first client
-				go h.subscribeToUser(client.UserID)
+				h.subscribeToUser(client.UserID)
 			}
 
 			h.clients[client.UserID][client] = true
@@ -177,22 +204,8 @@ func (h *Hub) Run() {
 			// Register device in Redis
 			h.registerDevice(client)
 
-			// Send initial state if exists
-			ctx := context.Background()
-			key := "user:" + client.UserID + ":playback"
-			val, err := h.redisClient.Get(ctx, key).Result()
-			if err == nil {
-				var state PlaybackState
-				if err := json.Unmarshal([]byte(val), &state); err == nil {
-					// Use standard message format for initial sync
-					msg := Message{
-						Type: "playback:sync",
-						Data: state,
-					}
-					data, _ := json.Marshal(msg)
-					client.send <- data
-				}
-			}
+			// Replay what the client missed, or send the current state
+			h.resume(client)
 
 			// Broadcast updated device list to all user's clients
 			h.broadcastDeviceList(client.UserID)
@@ -201,55 +214,43 @@ func (h *Hub) Run() {
 			if userClients, ok := h.clients[client.UserID]; ok {
 				if _, ok := userClients[client]; ok {
 					delete(userClients, client)
-					close(client.send)
+					client.close()
 					log.Printf("Client %s disconnected (Device: %s)", client.ID, client.DeviceID)
 
 					// Remove device from Redis
 					h.removeDevice(client.UserID, client.DeviceID)
 
 					// Check if the disconnecting device was the active device
-					ctx := context.Background()
-					key := "user:" + client.UserID + ":playback"
-					val, err := h.redisClient.Get(ctx, key).Result()
-
-					var wasActiveDevice bool
-					var currentState PlaybackState
-
-					if err == nil {
-						if err := json.Unmarshal([]byte(val), &currentState); err == nil {
-							wasActiveDevice = currentState.ActiveDeviceID == client.DeviceID
-						}
-					}
+					currentState, err := h.loadPlaybackState(client.UserID)
+					wasActiveDevice := err == nil && currentState.ActiveDeviceID == client.DeviceID
 
 					if wasActiveDevice {
 						log.Printf("Active device %s disconnected, handling device switch", client.DeviceID)
 
+						// Stop playback where the device got to
+						fields := map[string]string{"playing": formatFlag(false)}
+
 						// Get remaining devices
 						remainingDevices, err := h.getActiveDevices(client.UserID)
 						if err == nil && len(remainingDevices) > 0 {
 							// Set first remaining device as active, but stop playback
-							playing := false
-							currentState.Playing = &playing
-							currentState.ActiveDeviceID = remainingDevices[0].ID
+							fields["active_device_id"] = remainingDevices[0].ID
 							log.Printf("Switched active device to %s (playback stopped)", remainingDevices[0].ID)
 						} else {
 							// No remaining devices, clear active device
-							playing := false
-							currentState.Playing = &playing
-							currentState.ActiveDeviceID = ""
+							fields["active_device_id"] = ""
 							log.Printf("No remaining devices, cleared active device")
 						}
 
-						// Save updated state
-						data, _ := json.Marshal(currentState)
-						h.redisClient.Set(ctx, key, data, 24*time.Hour)
-
-						// Broadcast updated playback state
-						msg := Message{
-							Type: "playback:sync",
-							Data: currentState,
+						// Only if nothing changed since the state was read, e.g. another
+						// device taking over in the meantime
+						merged, applied, err := h.mergePlaybackState(client.UserID, fields, currentState.Version)
+						if err != nil {
+							log.Printf("Failed to update playback state for user %s: %v", client.UserID, err)
+						} else if applied {
+							// Broadcast updated playback state
+							h.publishToRedis(client.UserID, Message{Type: "playback:sync", Data: merged})
 						}
-						h.publishToRedis(client.UserID, msg)
 					}
 
 					// Broadcast updated device list to remaining clients
@@ -258,67 +259,107 @@ func (h *Hub) Run() {
 					// If no more clients for this user, clean up map
 					if len(userClients) == 0 {
 						delete(h.clients, client.UserID)
+						delete(h.lyricsCursors, client.UserID)
+						h.unsubscribeFromUser(client.UserID)
 					}
 				}
 			}
 
+		case result := <-h.lyricsLoaded:
+			h.finishLyricsLoad(result)
+
 		case userMsg := <-h.broadcast:
-			// Intercept broadcast to save state if it's a playback sync
+			// Playback state is stored by the sender (see state.go); syncs and seeks are only
+			// inspected here to keep lyrics in step
+			var syncedState *PlaybackState
 			var msg Message
 			if err := json.Unmarshal(userMsg.Message, &msg); err == nil {
 				switch msg.Type {
 				case "playback:sync":
-					// Extract state from message data map/struct
-					// This is tricky because Data is interface{}.
-					// We need to re-marshal/unmarshal or type assert if possible.
-					// Since it came from Redis string, it's likely a map[string]interface{}.
-
-					// Use a fresh unmarshal for safety
+					// Data came through Redis as a map, so re-marshal it into the struct
 					var state PlaybackState
 					dataBytes, _ := json.Marshal(msg.Data)
 					if err := json.Unmarshal(dataBytes, &state); err == nil {
-						savePlaybackState(userMsg.UserID, state)
+						syncedState = &state
 					}
 				case "control:seek":
-					// Also save state for seek commands
-					var seekCmd SeekCommand
-					dataBytes, _ := json.Marshal(msg.Data)
-					if err := json.Unmarshal(dataBytes, &seekCmd); err == nil {
-						state := PlaybackState{Position: &seekCmd.Position}
-						savePlaybackState(userMsg.UserID, state)
+					if state, err := h.loadPlaybackState(userMsg.UserID); err == nil {
+						syncedState = &state
 					}
 				}
 			}
 
+			message := withSeq(userMsg.Message, userMsg.Seq)
+
+			// Encoded once per encoding in use
+			frames := make(map[string][]byte)
 			if clients, ok := h.clients[userMsg.UserID]; ok {
 				for client := range clients {
-					select {
-					case client.send <- userMsg.Message:
-					default:
-						close(client.send)
+					if userMsg.Seq != "" {
+						// Already sent in the client's replay
+						if !seqAfter(userMsg.Seq, client.lastSeq) {
+							continue
+						}
+						client.lastSeq = userMsg.Seq
+					}
+					frame, ok := frames[client.subprotocol]
+					if !ok {
+						frame = client.encode(message)
+						frames[client.subprotocol] = frame
+					}
+					if frame == nil {
+						continue
+					}
+					if !client.trySend(frame) {
+						client.close()
 						delete(clients, client)
 					}
 				}
 			}
+
+			// Push the current lyric line alongside the sync
+			if syncedState != nil {
+				h.pushLyricLine(userMsg.UserID, *syncedState, nil)
+			}
 		}
 	}
 }
 
+// subscribeToUser starts forwarding the user's events to this instance. It returns once the
+// subscription is confirmed, so a replay read afterwards can't miss an event.
 func (h *Hub) subscribeToUser(userID string) {
-	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
 	channel := getPlaybackChannel(userID)
 	sub := h.redisClient.Subscribe(ctx, channel)
-	ch := sub.Channel()
+	if _, err := sub.Receive(ctx); err != nil {
+		log.Printf("Failed to confirm Redis subscription for %s: %v", channel, err)
+	}
+	h.subscriptions[userID] = sub
 
 	log.Printf("Started Redis subscription for %s", channel)
 
-	// This goroutine runs until the hub stops or subscription fails
-	// In a production app, we'd need better lifecycle management here
-	for msg := range ch {
-		// Forward message to user's clients
-		h.broadcast <- &UserMessage{
-			UserID:  userID,
-			Message: []byte(msg.Payload),
+	// Runs until the last client of the user disconnects and the subscription is closed
+	go func() {
+		for msg := range sub.Channel() {
+			// Forward message to user's clients
+			seq, message := splitEvent(msg.Payload)
+			h.broadcast <- &UserMessage{
+				UserID:  userID,
+				Seq:     seq,
+				Message: message,
+			}
+		}
+	}()
+}
+
+// unsubscribeFromUser stops forwarding the user's events once no client of theirs is left
+func (h *Hub) unsubscribeFromUser(userID string) {
+	if sub, ok := h.subscriptions[userID]; ok {
+		delete(h.subscriptions, userID)
+		if err := sub.Close(); err != nil {
+			log.Printf("Failed to close Redis subscription for user %s: %v", userID, err)
 		}
 	}
 }
@@ -396,16 +437,9 @@ func (h *Hub) removeDevice(userID, deviceID string) error {
 // broadcastDeviceList sends updated device list to all connected clients for a user
 func (h *Hub) broadcastDeviceList(userID string) {
 	// Get current active device from playback state
-	ctx := context.Background()
-	key := "user:" + userID + ":playback"
 	var activeDeviceID string
-
-	val, err := h.redisClient.Get(ctx, key).Result()
-	if err == nil {
-		var state PlaybackState
-		if err := json.Unmarshal([]byte(val), &state); err == nil {
-			activeDeviceID = state.ActiveDeviceID
-		}
+	if state, err := h.loadPlaybackState(userID); err == nil {
+		activeDeviceID = state.ActiveDeviceID
 	}
 
 	// Get all active devices
@@ -440,8 +474,6 @@ func (h *Hub) broadcastDeviceList(userID string) {
 }
 
 func (h *Hub) publishToRedis(userID string, msg interface{}) {
-	ctx := context.Background()
-
 	// If it's a playback state, ensure we're publishing to the right channel
 	// Or wrap it in a standard message format
 
@@ -468,7 +500,8 @@ func (h *Hub) publishToRedis(userID string, msg interface{}) {
 		return
 	}
 
-	if err := h.redisClient.Publish(ctx, getPlaybackChannel(userID), data).Err(); err != nil {
+	// Logged so reconnecting clients can replay it (see events.go)
+	if err := h.appendEvent(userID, data); err != nil {
 		log.Printf("Failed to publish to Redis: %v", err)
 	}
 }
@@ -477,6 +510,7 @@ func (h *Hub) HandleWebSocketFiber(c *fiber.Ctx) error {
 	// Extract Info from Query Params
 	deviceID := c.Query("device_id")
 	deviceName := c.Query("device_name")
+	lastSeq := c.Query("last_seq") // Seq of the last message received before reconnecting
 
 	if deviceID == "" {
 		deviceID = generateClientID() // Fallback
@@ -498,13 +532,15 @@ func (h *Hub) HandleWebSocketFiber(c *fiber.Ctx) error {
 
 	return fasthttpUpgrader.Upgrade(c.Context(), func(conn *websocket.Conn) {
 		client := &Client{
-			hub:        h,
-			conn:       conn,
-			send:       make(chan []byte, 256),
-			ID:         generateClientID(),
-			UserID:     userID,
-			DeviceID:   deviceID,
-			DeviceName: deviceName,
+			hub:         h,
+			conn:        conn,
+			send:        make(chan []byte, 256),
+			ID:          generateClientID(),
+			UserID:      userID,
+			DeviceID:    deviceID,
+			DeviceName:  deviceName,
+			lastSeq:     lastSeq,
+			subprotocol: conn.Subprotocol(),
 		}
 
 		h.register <- client
@@ -528,7 +564,7 @@ func (c *Client) readPump() {
 	})
 
 	for {
-		_, messageBytes, err := c.conn.ReadMessage()
+		frameType, frame, err := c.conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Printf("WebSocket error: %v", err)
@@ -536,272 +572,336 @@ func (c *Client) readPump() {
 			break
 		}
 
-		var msg Message
-		if err := json.Unmarshal(messageBytes, &msg); err != nil {
-			log.Printf("Failed to unmarshal message: %v", err)
+		messageBytes, err := decodeFrame(frameType, frame)
+		if err != nil {
+			log.Printf("Rejected frame from %s (User %s): %v", c.ID, c.UserID, err)
+			c.sendError(Message{}, errInvalidMessage)
+			continue
+		}
+
+		msg, err := decodeMessage(messageBytes)
+		if err != nil {
+			log.Printf("Rejected message from %s (User %s): %v", c.ID, c.UserID, err)
+			c.sendError(msg, err)
 			continue
 		}
 
 		log.Printf("Received message from %s (User %s): %s", c.ID, c.UserID, msg.Type)
 
-		// Handle different message types
-		switch msg.Type {
-		case "playback:update":
-			// Verify if this device is allowed to update playback state
-			// Only the active device should be sending position updates
-			ctx := context.Background()
-			key := "user:" + c.UserID + ":playback"
-			val, err := c.hub.redisClient.Get(ctx, key).Result()
-
-			var currentState PlaybackState
-			if err == nil {
-				json.Unmarshal([]byte(val), &currentState)
-			}
+		if err := c.handleMessage(msg); err != nil {
+			c.sendError(msg, err)
+			continue
+		}
+		c.sendAck(msg)
+	}
+}
 
-			// If there is an active device set, and it's NOT us, ignore the update
-			// This prevents "zombie" tabs or other devices from interfering
-			if currentState.ActiveDeviceID != "" && currentState.ActiveDeviceID != c.DeviceID {
-				// log.Printf("Ignored playback update from inactive device %s (Active: %s)", c.DeviceID, currentState.ActiveDeviceID)
-				continue
-			}
+// handleMessage applies a decoded client message. Its Data is the pointer to the type's data
+// type set by decodeMessage.
+func (c *Client) handleMessage(msg Message) error {
+	// Handle different message types
+	switch msg.Type {
+	case "playback:update":
+		// Verify if this device is allowed to update playback state
+		// Only the active device should be sending position updates
+		currentState, err := c.hub.loadPlaybackState(c.UserID)
+		if err != nil {
+			return err
+		}
+
+		// If there is an active device set, and it's NOT us, reject the update
+		// This prevents "zombie" tabs or other devices from interfering
+		if currentState.ActiveDeviceID != "" && currentState.ActiveDeviceID != c.DeviceID {
+			return errNotActiveDevice
+		}
+
+		state := *msg.Data.(*PlaybackState)
+		state.ActiveDeviceID = c.DeviceID // Mark this device as active sender
+		_, err = c.hub.updatePlayback(c.UserID, state, c)
+		return err
+
+	case "control:play":
+		state := *msg.Data.(*PlaybackState)
+		playing := true
+		state.Playing = &playing
+		if state.ActiveDeviceID == "" {
+			state.ActiveDeviceID = c.DeviceID
+		}
+		_, err := c.hub.updatePlayback(c.UserID, state, c)
+		return err
+
+	case "control:pause":
+		state := *msg.Data.(*PlaybackState)
+		playing := false
+		state.Playing = &playing
+		_, err := c.hub.updatePlayback(c.UserID, state, c)
+		return err
 
-			stateData, _ := json.Marshal(msg.Data)
-			var state PlaybackState
-			if err := json.Unmarshal(stateData, &state); err != nil {
-				log.Printf("Failed to unmarshal playback:update from client %s: %v", c.ID, err)
-				continue
+	case "control:stop":
+		state := *msg.Data.(*PlaybackState)
+		playing := false
+		position := 0
+		state.Playing = &playing
+		state.Position = &position
+		_, err := c.hub.updatePlayback(c.UserID, state, c)
+		return err
+
+	case "control:seek":
+		seekCmd := *msg.Data.(*SeekCommand)
+
+		// Store the new position; the devices are told through the seek command below
+		position := seekCmd.Position
+		merged, _, err := c.hub.mergePlaybackState(c.UserID, playbackFields(PlaybackState{Position: &position}), 0)
+		if err != nil {
+			return err
+		}
+		seekCmd.ServerTime = merged.ServerTime
+
+		// Broadcast the specific control command so active devices can handle it
+		// We send the command as-is, instead of converting to playback:sync
+		// This triggers the 'control:seek' handler on the frontend which sets seekTarget
+		cmd := Message{
+			Type: "control:seek",
+			Data: seekCmd,
+		}
+		c.hub.publishToRedis(c.UserID, cmd)
+		return nil
+
+	case "control:volume":
+		volume := *msg.Data.(*VolumeCommand).Volume
+
+		// Get current state to check if volume actually changed
+		currentState, _ := c.hub.loadPlaybackState(c.UserID)
+		if currentState.Volume != nil && *currentState.Volume == volume {
+			return nil
+		}
+
+		_, err := c.hub.updatePlayback(c.UserID, PlaybackState{Volume: &volume}, c)
+		return err
+
+	case "control:load":
+		loadCmd := *msg.Data.(*LoadTrackCommand)
+		// Fetch current state to check if there is an active device
+		currentState, _ := c.hub.loadPlaybackState(c.UserID)
+
+		playing := true
+		position := 0
+		state := PlaybackState{
+			TrackID:  loadCmd.TrackID,
+			Position: &position,
+			Playing:  &playing,
+		}
+
+		// Only set active device if none is currently active
+		if currentState.ActiveDeviceID == "" && c.DeviceID != "" {
+			state.ActiveDeviceID = c.DeviceID
+		}
+
+		// Keep the server-side queue in step: a context replaces the queue's tracks,
+		// a single track plays on its own and the context resumes after it
+		queue, err := c.hub.updateQueue(c.UserID, func(q *PlayQueue) error {
+			if len(loadCmd.TrackIDs) == 0 {
+				q.playStandalone(loadCmd.TrackID)
+				return nil
 			}
-			state.ActiveDeviceID = c.DeviceID // Mark this device as active sender
-			c.hub.publishToRedis(c.UserID, state)
-
-		case "control:play":
-			stateData, _ := json.Marshal(msg.Data)
-			var state PlaybackState
-			json.Unmarshal(stateData, &state)
-			playing := true
-			state.Playing = &playing
-			if state.ActiveDeviceID == "" {
-				state.ActiveDeviceID = c.DeviceID
+			item, err := q.setContext(loadCmd.Context, loadCmd.TrackIDs, contextStart(loadCmd))
+			if err != nil {
+				return err
 			}
-			c.hub.publishToRedis(c.UserID, state)
-
-		case "control:pause":
-			stateData, _ := json.Marshal(msg.Data)
-			var state PlaybackState
-			json.Unmarshal(stateData, &state)
-			playing := false
-			state.Playing = &playing
-			c.hub.publishToRedis(c.UserID, state)
-
-		case "control:stop":
-			stateData, _ := json.Marshal(msg.Data)
-			var state PlaybackState
-			json.Unmarshal(stateData, &state)
-			playing := false
-			position := 0
-			state.Playing = &playing
-			state.Position = &position
-			c.hub.publishToRedis(c.UserID, state)
-
-		case "control:seek":
-			stateData, _ := json.Marshal(msg.Data)
-			var seekCmd SeekCommand
-			if err := json.Unmarshal(stateData, &seekCmd); err != nil {
-				log.Printf("Failed to unmarshal seek command: %v", err)
-				continue
+			state.TrackID = item.TrackID
+			return nil
+		})
+		if err != nil {
+			log.Printf("Failed to update queue for user %s: %v", c.UserID, err)
+			// Still play the track the context starts at
+			if state.TrackID == "" {
+				state.TrackID = loadCmd.TrackIDs[contextStart(loadCmd)]
 			}
+		}
 
-			// Broadcast the specific control command so active devices can handle it
-			// We send the command as-is, instead of converting to playback:sync
-			// This triggers the 'control:seek' handler on the frontend which sets seekTarget
-			cmd := Message{
-				Type: "control:seek",
-				Data: seekCmd,
-			}
-			c.hub.publishToRedis(c.UserID, cmd)
-
-		case "control:volume":
-			stateData, _ := json.Marshal(msg.Data)
-			var volCmd VolumeCommand
-			json.Unmarshal(stateData, &volCmd)
-
-			// Get current state to check if volume actually changed
-			ctx := context.Background()
-			key := "user:" + c.UserID + ":playback"
-			val, _ := c.hub.redisClient.Get(ctx, key).Result()
-			var currentState PlaybackState
-			if val != "" {
-				json.Unmarshal([]byte(val), &currentState)
-				// If volume is essentially the same, skip broadcast
-				if currentState.Volume == volCmd.Volume {
-					continue
-				}
-			}
+		if _, err := c.hub.updatePlayback(c.UserID, state, c); err != nil {
+			return err
+		}
+		if queue != nil {
+			c.hub.publishQueue(c.UserID, queue)
+		}
+		return nil
 
-			state := PlaybackState{Volume: volCmd.Volume}
-			c.hub.publishToRedis(c.UserID, state)
-
-		case "control:load":
-			stateData, _ := json.Marshal(msg.Data)
-			var loadCmd LoadTrackCommand
-			json.Unmarshal(stateData, &loadCmd)
-			// Fetch current state to check if there is an active device
-			ctx := context.Background()
-			key := "user:" + c.UserID + ":playback"
-			val, err := c.hub.redisClient.Get(ctx, key).Result()
-
-			var currentState PlaybackState
-			if err == nil {
-				json.Unmarshal([]byte(val), &currentState)
-			}
+	case "control:next", "control:previous":
+		// Resolved against the server-side queue with repeat and shuffle applied
+		return c.skip(msg)
 
-			playing := true
-			position := 0
-			state := PlaybackState{
-				TrackID:  loadCmd.TrackID,
-				Position: &position,
-				Playing:  &playing,
-			}
+	case "queue:add", "queue:remove", "queue:move", "queue:clear":
+		return c.handleQueueCommand(msg)
+
+	case "control:shuffle":
+		shuffle := *msg.Data.(*ShuffleCommand).Shuffle
 
-			// Only set active device if none is currently active
-			if currentState.ActiveDeviceID == "" && c.DeviceID != "" {
-				state.ActiveDeviceID = c.DeviceID
+		// Reorder the server-side queue, keeping the current track in place
+		queue, err := c.hub.updateQueue(c.UserID, func(q *PlayQueue) error {
+			if q.Shuffle == shuffle {
+				return errQueueUnchanged
 			}
+			q.setShuffle(shuffle)
+			return nil
+		})
+		if err == nil {
+			c.hub.publishQueue(c.UserID, queue)
+		} else if err != errQueueUnchanged {
+			log.Printf("Failed to shuffle queue for user %s: %v", c.UserID, err)
+		}
 
-			c.hub.publishToRedis(c.UserID, state)
-
-		case "control:next":
-			wrapper := Message{Type: "control:next", Data: nil}
-			c.hub.publishToRedis(c.UserID, wrapper)
-
-		case "control:previous":
-			wrapper := Message{Type: "control:previous", Data: nil}
-			c.hub.publishToRedis(c.UserID, wrapper)
-
-		case "control:shuffle":
-			// Extract shuffle state and save to Redis
-			stateData, _ := json.Marshal(msg.Data)
-			var shuffleData map[string]interface{}
-			json.Unmarshal(stateData, &shuffleData)
-
-			if shuffle, ok := shuffleData["shuffle"].(bool); ok {
-				// Get current state to verify change
-				ctx := context.Background()
-				key := "user:" + c.UserID + ":playback"
-				val, _ := c.hub.redisClient.Get(ctx, key).Result()
-				var currentState PlaybackState
-				if val != "" {
-					json.Unmarshal([]byte(val), &currentState)
-					if currentState.Shuffle == shuffle {
-						continue
-					}
-				}
+		// Get current state to verify change
+		currentState, _ := c.hub.loadPlaybackState(c.UserID)
+		if currentState.Shuffle != nil && *currentState.Shuffle == shuffle {
+			return nil
+		}
 
-				// Save to playback state
-				state := PlaybackState{Shuffle: shuffle}
-				c.hub.publishToRedis(c.UserID, state)
-			}
+		// Save to playback state
+		if _, err := c.hub.updatePlayback(c.UserID, PlaybackState{Shuffle: &shuffle}, c); err != nil {
+			return err
+		}
 
-			// Also broadcast the control message for immediate UI update
-			wrapper := Message{Type: "control:shuffle", Data: msg.Data}
-			c.hub.publishToRedis(c.UserID, wrapper)
-
-		case "control:repeat":
-			// Extract repeat mode and save to Redis
-			stateData, _ := json.Marshal(msg.Data)
-			var repeatData map[string]interface{}
-			json.Unmarshal(stateData, &repeatData)
-
-			if mode, ok := repeatData["mode"].(string); ok {
-				// Get current state to verify change
-				ctx := context.Background()
-				key := "user:" + c.UserID + ":playback"
-				val, _ := c.hub.redisClient.Get(ctx, key).Result()
-				var currentState PlaybackState
-				if val != "" {
-					json.Unmarshal([]byte(val), &currentState)
-					if currentState.Repeat == mode {
-						continue
-					}
-				}
+		// Also broadcast the control message for immediate UI update
+		wrapper := Message{Type: "control:shuffle", Data: ShuffleCommand{Shuffle: &shuffle}}
+		c.hub.publishToRedis(c.UserID, wrapper)
+		return nil
+
+	case "control:repeat":
+		mode := msg.Data.(*RepeatCommand).mode()
 
-				// Save to playback state
-				state := PlaybackState{Repeat: mode}
-				c.hub.publishToRedis(c.UserID, state)
+		// next and previous apply the repeat mode on the server
+		queue, err := c.hub.updateQueue(c.UserID, func(q *PlayQueue) error {
+			if q.Repeat == mode {
+				return errQueueUnchanged
 			}
+			q.Repeat = mode
+			return nil
+		})
+		if err == nil {
+			c.hub.publishQueue(c.UserID, queue)
+		} else if err != errQueueUnchanged {
+			log.Printf("Failed to set queue repeat mode for user %s: %v", c.UserID, err)
+		}
 
-			// Also broadcast the control message for immediate UI update
-			wrapper := Message{Type: "control:repeat", Data: msg.Data}
-			c.hub.publishToRedis(c.UserID, wrapper)
+		// Get current state to verify change
+		currentState, _ := c.hub.loadPlaybackState(c.UserID)
+		if currentState.Repeat == mode {
+			return nil
+		}
 
-		case "device:set_active":
-			stateData, _ := json.Marshal(msg.Data)
-			var cmd SetActiveDeviceCommand
-			json.Unmarshal(stateData, &cmd)
+		// Save to playback state
+		if _, err := c.hub.updatePlayback(c.UserID, PlaybackState{Repeat: mode}, c); err != nil {
+			return err
+		}
 
-			state := PlaybackState{
-				ActiveDeviceID: cmd.DeviceID,
-				Position:       &cmd.Position,
-			}
-			c.hub.publishToRedis(c.UserID, state)
-
-		case "ping":
-			response := Message{Type: "pong", Data: nil}
-			responseBytes, _ := json.Marshal(response)
-			select {
-			case c.send <- responseBytes:
-			default:
-				close(c.send)
-				return
-			}
+		// Also broadcast the control message for immediate UI update
+		wrapper := Message{Type: "control:repeat", Data: RepeatCommand{Repeat: mode}}
+		c.hub.publishToRedis(c.UserID, wrapper)
+		return nil
 
-		case "device:get_list":
-			// Get current active device from playback state
-			ctx := context.Background()
-			key := "user:" + c.UserID + ":playback"
-			var activeDeviceID string
-
-			val, err := c.hub.redisClient.Get(ctx, key).Result()
-			if err == nil {
-				var state PlaybackState
-				if err := json.Unmarshal([]byte(val), &state); err == nil {
-					activeDeviceID = state.ActiveDeviceID
-				}
-			}
+	case "device:set_active":
+		cmd := msg.Data.(*SetActiveDeviceCommand)
 
-			// Get all active devices
-			devices, err := c.hub.getActiveDevices(c.UserID)
-			if err != nil {
-				log.Printf("Failed to get active devices: %v", err)
-				continue
-			}
+		// The stored position is extrapolated to the handover when the state is merged;
+		// the client's position is only a fallback for state recorded without a server time
+		state := PlaybackState{ActiveDeviceID: cmd.DeviceID}
+		if current, err := c.hub.loadPlaybackState(c.UserID); err == nil && current.ServerTime == 0 {
+			state.Position = cmd.Position
+		}
+		_, err := c.hub.updatePlayback(c.UserID, state, c)
+		return err
 
-			// Build device list with status
-			devicesWithStatus := make([]DeviceWithStatus, 0, len(devices))
-			for _, device := range devices {
-				devicesWithStatus = append(devicesWithStatus, DeviceWithStatus{
-					ID:       device.ID,
-					Name:     device.Name,
-					IsActive: device.ID == activeDeviceID,
-				})
-			}
+	case "ping":
+		// Echo the client's clock with ours for clock offset estimation
+		ping := msg.Data.(*PingData)
+		c.sendMessage(Message{
+			Type:      "pong",
+			RequestID: msg.RequestID,
+			Data:      PongData{ClientTime: ping.ClientTime, ServerTime: nowMillis()},
+		})
+		return nil
 
-			// Send response directly to requesting client
-			response := Message{
-				Type: "device:list_update",
-				Data: DeviceListUpdate{
-					Devices:        devicesWithStatus,
-					ActiveDeviceID: activeDeviceID,
-				},
-			}
-			responseBytes, _ := json.Marshal(response)
-			select {
-			case c.send <- responseBytes:
-			default:
-				close(c.send)
-				return
-			}
+	case "device:get_list":
+		// Get current active device from playback state
+		var activeDeviceID string
+		if state, err := c.hub.loadPlaybackState(c.UserID); err == nil {
+			activeDeviceID = state.ActiveDeviceID
+		}
+
+		// Get all active devices
+		devices, err := c.hub.getActiveDevices(c.UserID)
+		if err != nil {
+			return err
+		}
+
+		// Build device list with status
+		devicesWithStatus := make([]DeviceWithStatus, 0, len(devices))
+		for _, device := range devices {
+			devicesWithStatus = append(devicesWithStatus, DeviceWithStatus{
+				ID:       device.ID,
+				Name:     device.Name,
+				IsActive: device.ID == activeDeviceID,
+			})
 		}
+
+		// Send response directly to requesting client
+		c.sendMessage(Message{
+			Type:      "device:list_update",
+			RequestID: msg.RequestID,
+			Data: DeviceListUpdate{
+				Devices:        devicesWithStatus,
+				ActiveDeviceID: activeDeviceID,
+			},
+		})
+		return nil
+	}
+
+	// decodeMessage only lets through types listed in the schema
+	return errUnknownType
+}
+
+// sendMessage sends a message to this client only, dropping it if the client is not keeping up
+func (c *Client) sendMessage(msg Message) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("Failed to marshal %s for client %s: %v", msg.Type, c.ID, err)
+		return
+	}
+	frame := c.encode(data)
+	if frame == nil {
+		return
+	}
+	if !c.trySend(frame) {
+		log.Printf("Dropped %s for slow client %s", msg.Type, c.ID)
+	}
+}
+
+// trySend queues a frame without blocking. It reports false if the send buffer is full or
+// the client was closed.
+func (c *Client) trySend(frame []byte) bool {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+
+	if c.closed {
+		return false
+	}
+	select {
+	case c.send <- frame:
+		return true
+	default:
+		return false
+	}
+}
+
+// close closes the send channel, which stops writePump. Safe to call more than once.
+func (c *Client) close() {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+
+	if !c.closed {
+		c.closed = true
+		close(c.send)
 	}
 }
 
@@ -827,7 +927,7 @@ func (c *Client) writePump() {
 				return
 			}
 
-			if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+			if err := c.conn.WriteMessage(c.frameType(), message); err != nil {
 				log.Printf("WebSocket write error: %v", err)
 				return
 			}
@@ -0,0 +1,162 @@
+package websocket
+
+import (
+	"amplify-backend/internal/lyrics"
+	"encoding/json"
+	"log"
+	"time"
+)
+
+// How long line timings are cached before lyrics are re-read from the provider
+const lyricsCacheTTL = time.Minute
+
+// Expired cache entries are swept once the cache grows past this size
+const lyricsCacheSweepSize = 1000
+
+// LyricsProvider supplies the sorted line start times (ms) of a track's synced lyrics
+type LyricsProvider interface {
+	GetLineTimes(trackID string) ([]int, error)
+}
+
+// LyricsLineUpdate tells controllers which lyric line is active on the player
+type LyricsLineUpdate struct {
+	TrackID   string `json:"track_id"`
+	LineIndex int    `json:"line_index"` // -1 before the first line
+	Position  int    `json:"position"`
+}
+
+type lyricsCacheEntry struct {
+	lineTimes []int
+	fetchedAt time.Time
+}
+
+// lyricsRequest is a lyric line push waiting for its track's line timings
+type lyricsRequest struct {
+	userID string
+	state  PlaybackState
+	target *Client
+}
+
+// lyricsResult is the line timings of a track loaded outside Run
+type lyricsResult struct {
+	trackID   string
+	lineTimes []int
+}
+
+type lyricsCursor struct {
+	trackID   string
+	lineIndex int
+}
+
+// SetLyricsProvider enables lyric line updates alongside playback:sync
+// Must be called before Run
+func (h *Hub) SetLyricsProvider(provider LyricsProvider) {
+	h.lyrics = provider
+}
+
+// lineTimes returns cached line timings for a track. On a miss it starts loading them in the
+// background and reports false; the result comes back to Run through lyricsLoaded, so a slow
+// provider never holds up the hub. Only called from Run.
+func (h *Hub) lineTimes(trackID string) ([]int, bool) {
+	if entry, ok := h.lyricsCache[trackID]; ok && time.Since(entry.fetchedAt) < lyricsCacheTTL {
+		return entry.lineTimes, true
+	}
+
+	if _, loading := h.lyricsPending[trackID]; !loading {
+		h.lyricsPending[trackID] = nil
+		go func() {
+			times, err := h.lyrics.GetLineTimes(trackID)
+			if err != nil {
+				log.Printf("Failed to load lyrics for track %s: %v", trackID, err)
+				times = []int{}
+			}
+			h.lyricsLoaded <- lyricsResult{trackID: trackID, lineTimes: times}
+		}()
+	}
+	return nil, false
+}
+
+// finishLyricsLoad caches loaded line timings and sends the lyric lines that waited for them
+// Only called from Run
+func (h *Hub) finishLyricsLoad(result lyricsResult) {
+	if len(h.lyricsCache) >= lyricsCacheSweepSize {
+		for id, entry := range h.lyricsCache {
+			if time.Since(entry.fetchedAt) >= lyricsCacheTTL {
+				delete(h.lyricsCache, id)
+			}
+		}
+	}
+	h.lyricsCache[result.trackID] = lyricsCacheEntry{lineTimes: result.lineTimes, fetchedAt: time.Now()}
+
+	requests := h.lyricsPending[result.trackID]
+	delete(h.lyricsPending, result.trackID)
+	for _, req := range requests {
+		// The client may have disconnected while the lyrics loaded
+		if req.target != nil && !h.clients[req.userID][req.target] {
+			continue
+		}
+		// The player has moved on in the meantime
+		req.state.advanceTo(nowMillis())
+		h.pushLyricLine(req.userID, req.state, req.target)
+	}
+}
+
+// pushLyricLine sends lyrics:line to the user's local clients when the active line changed
+// Each instance computes this from the synced state, so it is not re-published to Redis
+func (h *Hub) pushLyricLine(userID string, state PlaybackState, target *Client) {
+	if h.lyrics == nil || state.TrackID == "" || state.Position == nil {
+		return
+	}
+
+	times, ok := h.lineTimes(state.TrackID)
+	if !ok {
+		// Sent once the line timings are loaded; a newer state for the same recipient
+		// replaces the one waiting
+		req := lyricsRequest{userID: userID, state: state, target: target}
+		pending := h.lyricsPending[state.TrackID]
+		for i := range pending {
+			if pending[i].userID == userID && pending[i].target == target {
+				pending[i] = req
+				return
+			}
+		}
+		h.lyricsPending[state.TrackID] = append(pending, req)
+		return
+	}
+	if len(times) == 0 {
+		return
+	}
+
+	cursor := lyricsCursor{trackID: state.TrackID, lineIndex: lyrics.LineIndexAt(times, *state.Position)}
+	if target == nil && h.lyricsCursors[userID] == cursor {
+		return
+	}
+	h.lyricsCursors[userID] = cursor
+
+	data, err := json.Marshal(Message{
+		Type: "lyrics:line",
+		Data: LyricsLineUpdate{
+			TrackID:   cursor.trackID,
+			LineIndex: cursor.lineIndex,
+			Position:  *state.Position,
+		},
+	})
+	if err != nil {
+		return
+	}
+
+	if target != nil {
+		if frame := target.encode(data); frame != nil {
+			target.trySend(frame)
+		}
+		return
+	}
+
+	for client := range h.clients[userID] {
+		frame := client.encode(data)
+		if frame == nil {
+			continue
+		}
+		client.trySend(frame)
+	}
+}
@@ -0,0 +1,311 @@
+package websocket
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// A minimal MessagePack codec for the JSON data model: nil, bool, integers, float64,
+// string, []interface{} and map[string]interface{}. Messages are encoded with the same
+// structure and keys as their JSON, so the schema describes both encodings.
+
+// msgpackMaxDepth bounds the nesting of decoded values
+const msgpackMaxDepth = 32
+
+var errMsgpack = errors.New("invalid msgpack")
+
+// appendMsgpack encodes a value from the JSON data model. Map keys are sorted so equal values
+// encode to equal bytes.
+func appendMsgpack(buf []byte, value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case nil:
+		return append(buf, 0xc0), nil
+	case bool:
+		if v {
+			return append(buf, 0xc3), nil
+		}
+		return append(buf, 0xc2), nil
+	case int:
+		return appendMsgpackInt(buf, int64(v)), nil
+	case int64:
+		return appendMsgpackInt(buf, v), nil
+	case uint64:
+		if v <= math.MaxInt64 {
+			return appendMsgpackInt(buf, int64(v)), nil
+		}
+		return binary.BigEndian.AppendUint64(append(buf, 0xcf), v), nil
+	case float64:
+		return binary.BigEndian.AppendUint64(append(buf, 0xcb), math.Float64bits(v)), nil
+	case string:
+		return appendMsgpackString(buf, v), nil
+	case []interface{}:
+		buf = appendMsgpackHeader(buf, len(v), 0x90, 15, 0xdc, 0xdd)
+		var err error
+		for _, item := range v {
+			if buf, err = appendMsgpack(buf, item); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		buf = appendMsgpackHeader(buf, len(v), 0x80, 15, 0xde, 0xdf)
+		var err error
+		for _, key := range keys {
+			buf = appendMsgpackString(buf, key)
+			if buf, err = appendMsgpack(buf, v[key]); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	default:
+		return nil, fmt.Errorf("msgpack: unsupported type %T", value)
+	}
+}
+
+func appendMsgpackInt(buf []byte, v int64) []byte {
+	switch {
+	case v >= 0 && v <= 0x7f:
+		return append(buf, byte(v))
+	case v < 0 && v >= -32:
+		return append(buf, byte(v))
+	case v >= 0 && v <= math.MaxUint8:
+		return append(buf, 0xcc, byte(v))
+	case v >= 0 && v <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(buf, 0xcd), uint16(v))
+	case v >= 0 && v <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(buf, 0xce), uint32(v))
+	case v >= math.MinInt8 && v < 0:
+		return append(buf, 0xd0, byte(v))
+	case v >= math.MinInt16 && v < 0:
+		return binary.BigEndian.AppendUint16(append(buf, 0xd1), uint16(v))
+	case v >= math.MinInt32 && v < 0:
+		return binary.BigEndian.AppendUint32(append(buf, 0xd2), uint32(v))
+	default:
+		return binary.BigEndian.AppendUint64(append(buf, 0xd3), uint64(v))
+	}
+}
+
+func appendMsgpackString(buf []byte, s string) []byte {
+	switch {
+	case len(s) <= 31:
+		buf = append(buf, 0xa0|byte(len(s)))
+	case len(s) <= math.MaxUint8:
+		buf = append(buf, 0xd9, byte(len(s)))
+	case len(s) <= math.MaxUint16:
+		buf = binary.BigEndian.AppendUint16(append(buf, 0xda), uint16(len(s)))
+	default:
+		buf = binary.BigEndian.AppendUint32(append(buf, 0xdb), uint32(len(s)))
+	}
+	return append(buf, s...)
+}
+
+// appendMsgpackHeader writes an array or map header: the fix format up to fixMax
+// elements, then the 16 and 32 bit formats
+func appendMsgpackHeader(buf []byte, n int, fix byte, fixMax int, code16, code32 byte) []byte {
+	switch {
+	case n <= fixMax:
+		return append(buf, fix|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(buf, code16), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(buf, code32), uint32(n))
+	}
+}
+
+// decodeMsgpack decodes one value that must fill data. Binary values decode as strings;
+// extension types and non-string map keys are rejected.
+func decodeMsgpack(data []byte) (interface{}, error) {
+	d := msgpackDecoder{data: data}
+	value, err := d.value(0)
+	if err != nil {
+		return nil, err
+	}
+	if d.pos != len(d.data) {
+		return nil, fmt.Errorf("%w: trailing bytes", errMsgpack)
+	}
+	return value, nil
+}
+
+type msgpackDecoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *msgpackDecoder) next(n int) ([]byte, error) {
+	if n < 0 || len(d.data)-d.pos < n {
+		return nil, fmt.Errorf("%w: unexpected end of data", errMsgpack)
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+// length reads a big-endian length of size bytes
+func (d *msgpackDecoder) length(size int) (int, error) {
+	b, err := d.next(size)
+	if err != nil {
+		return 0, err
+	}
+	switch size {
+	case 1:
+		return int(b[0]), nil
+	case 2:
+		return int(binary.BigEndian.Uint16(b)), nil
+	default:
+		return int(binary.BigEndian.Uint32(b)), nil
+	}
+}
+
+func (d *msgpackDecoder) value(depth int) (interface{}, error) {
+	if depth > msgpackMaxDepth {
+		return nil, fmt.Errorf("%w: nested too deeply", errMsgpack)
+	}
+
+	b, err := d.next(1)
+	if err != nil {
+		return nil, err
+	}
+	code := b[0]
+
+	switch {
+	case code <= 0x7f:
+		return int64(code), nil
+	case code >= 0xe0:
+		return int64(int8(code)), nil
+	case code&0xe0 == 0xa0:
+		return d.str(int(code & 0x1f))
+	case code&0xf0 == 0x90:
+		return d.array(int(code&0x0f), depth)
+	case code&0xf0 == 0x80:
+		return d.mapOf(int(code&0x0f), depth)
+	}
+
+	switch code {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		b, err := d.next(1 << (code - 0xcc))
+		if err != nil {
+			return nil, err
+		}
+		var v uint64
+		for _, c := range b {
+			v = v<<8 | uint64(c)
+		}
+		if v <= math.MaxInt64 {
+			return int64(v), nil
+		}
+		return v, nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (code - 0xd0)
+		b, err := d.next(size)
+		if err != nil {
+			return nil, err
+		}
+		var v uint64
+		for _, c := range b {
+			v = v<<8 | uint64(c)
+		}
+		// Sign-extend from the encoded width
+		shift := 64 - 8*size
+		return int64(v<<shift) >> shift, nil
+	case 0xca:
+		b, err := d.next(4)
+		if err != nil {
+			return nil, err
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), nil
+	case 0xcb:
+		b, err := d.next(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), nil
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.length(1 << (code - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return d.str(n)
+	case 0xc4, 0xc5, 0xc6:
+		n, err := d.length(1 << (code - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		return d.str(n)
+	case 0xdc, 0xdd:
+		n, err := d.length(2 << (code - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.array(n, depth)
+	case 0xde, 0xdf:
+		n, err := d.length(2 << (code - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.mapOf(n, depth)
+	}
+
+	return nil, fmt.Errorf("%w: unsupported type 0x%02x", errMsgpack, code)
+}
+
+func (d *msgpackDecoder) str(n int) (interface{}, error) {
+	b, err := d.next(n)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (d *msgpackDecoder) array(n, depth int) (interface{}, error) {
+	// Every element takes at least a byte, so a bogus length fails before allocating
+	if n > len(d.data)-d.pos {
+		return nil, fmt.Errorf("%w: unexpected end of data", errMsgpack)
+	}
+	items := make([]interface{}, n)
+	for i := range items {
+		item, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		items[i] = item
+	}
+	return items, nil
+}
+
+func (d *msgpackDecoder) mapOf(n, depth int) (interface{}, error) {
+	if 2*n > len(d.data)-d.pos {
+		return nil, fmt.Errorf("%w: unexpected end of data", errMsgpack)
+	}
+	m := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		key, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		name, ok := key.(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: map key is not a string", errMsgpack)
+		}
+		value, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		m[name] = value
+	}
+	return m, nil
+}
@@ -0,0 +1,15 @@
+package websocket
+
+// NotifyUsers sends a message to every connected device of each user, on any server instance.
+// Used for events that originate outside the WebSocket connection, such as playlist edits.
+func (h *Hub) NotifyUsers(userIDs []string, messageType string, data interface{}) {
+	seen := make(map[string]bool, len(userIDs))
+	for _, userID := range userIDs {
+		if userID == "" || seen[userID] {
+			continue
+		}
+		seen[userID] = true
+
+		h.publishToRedis(userID, Message{Type: messageType, Data: data})
+	}
+}
@@ -0,0 +1,305 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+)
+
+// ProtocolVersion is the version of the message schema served at /ws/schema. It changes
+// only for changes that break existing clients; new message types and optional fields
+// are added within a version.
+const ProtocolVersion = 1
+
+// Message directions
+const (
+	directionClient = "client" // Client → server
+	directionServer = "server" // Server → client
+	directionBoth   = "both"   // Sent by clients and rebroadcast to all devices
+)
+
+var (
+	errInvalidMessage  = errors.New("message is not a valid JSON object with a type")
+	errUnknownType     = errors.New("unknown message type")
+	errInvalidData     = errors.New("invalid message data")
+	errNotActiveDevice = errors.New("only the active device can update playback")
+	errStaleVersion    = errors.New("playback state has changed since the given version")
+)
+
+// Error codes sent in error replies
+const (
+	CodeInvalidMessage    = "invalid_message"
+	CodeUnknownType       = "unknown_type"
+	CodeInvalidData       = "invalid_data"
+	CodeNotActiveDevice   = "not_active_device"
+	CodeStaleVersion      = "stale_version"
+	CodeQueueFull         = "queue_full"
+	CodeQueueItemNotFound = "queue_item_not_found"
+	CodeConflict          = "conflict"
+	CodeInternal          = "internal_error"
+)
+
+// errorCodes describes every error code, for the schema
+var errorCodes = map[string]string{
+	CodeInvalidMessage:    "The message is not a JSON object with a type",
+	CodeUnknownType:       "The type is not a client message of this protocol",
+	CodeInvalidData:       "The data does not match the message type",
+	CodeNotActiveDevice:   "playback:update from a device other than the active one",
+	CodeStaleVersion:      "The playback state changed since the version sent; a playback:sync with the current state follows",
+	CodeQueueFull:         "The queue has no room for the tracks",
+	CodeQueueItemNotFound: "No queue item with the ID, or a position out of range",
+	CodeConflict:          "The queue kept changing concurrently; retry",
+	CodeInternal:          "The server failed to apply the message; retry",
+}
+
+// AckData confirms a client message with a request_id was applied
+type AckData struct {
+	Type string `json:"type"` // Type of the acknowledged message
+}
+
+// ErrorData reports why a client message was rejected
+type ErrorData struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Type    string `json:"type,omitempty"` // Type of the rejected message, if it could be read
+}
+
+// messageSpec describes one message type of the protocol
+type messageSpec struct {
+	Direction   string
+	Description string
+
+	// Data returns a new value of the message's data type; nil when it has no data
+	Data func() interface{}
+
+	// Reply is the message type sent back instead of an ack
+	Reply string
+}
+
+// validator is implemented by message data that checks more than its JSON shape
+type validator interface {
+	Validate() error
+}
+
+func dataOf[T any]() func() interface{} {
+	return func() interface{} { return new(T) }
+}
+
+// protocolMessages is the message schema. Clients send a request_id with any message to get
+// an ack (or the listed reply) once it is applied; errors are always sent.
+var protocolMessages = map[string]messageSpec{
+	"control:play":      {Direction: directionClient, Description: "Resume playback, optionally at a position", Data: dataOf[PlaybackState]()},
+	"control:pause":     {Direction: directionClient, Description: "Pause playback", Data: dataOf[PlaybackState]()},
+	"control:stop":      {Direction: directionClient, Description: "Stop playback and return to the start", Data: dataOf[PlaybackState]()},
+	"control:seek":      {Direction: directionBoth, Description: "Seek to a position; rebroadcast with server_time", Data: dataOf[SeekCommand]()},
+	"control:volume":    {Direction: directionClient, Description: "Set the volume", Data: dataOf[VolumeCommand]()},
+	"control:load":      {Direction: directionClient, Description: "Load and play a track, optionally from a context that replaces the queue", Data: dataOf[LoadTrackCommand]()},
+	"control:next":      {Direction: directionBoth, Description: "Skip to the next track; rebroadcast as is when the server has no queue", Data: dataOf[NextCommand]()},
+	"control:previous":  {Direction: directionBoth, Description: "Go back to the previous track; rebroadcast as is when the server has no queue"},
+	"control:shuffle":   {Direction: directionBoth, Description: "Turn shuffle on or off; rebroadcast to all devices", Data: dataOf[ShuffleCommand]()},
+	"control:repeat":    {Direction: directionBoth, Description: "Set the repeat mode; rebroadcast to all devices", Data: dataOf[RepeatCommand]()},
+	"playback:update":   {Direction: directionClient, Description: "State report from the active device", Data: dataOf[PlaybackState]()},
+	"queue:add":         {Direction: directionClient, Description: "Add tracks to up next", Data: dataOf[QueueAddCommand]()},
+	"queue:remove":      {Direction: directionClient, Description: "Remove queue items", Data: dataOf[QueueRemoveCommand]()},
+	"queue:move":        {Direction: directionClient, Description: "Move a queue item within its list", Data: dataOf[QueueMoveCommand]()},
+	"queue:clear":       {Direction: directionClient, Description: "Clear up next, or the whole queue", Data: dataOf[QueueClearCommand]()},
+	"device:set_active": {Direction: directionClient, Description: "Hand playback to another device", Data: dataOf[SetActiveDeviceCommand]()},
+	"device:get_list":   {Direction: directionClient, Description: "Request the device list", Reply: "device:list_update"},
+	"ping":              {Direction: directionClient, Description: "Keepalive and clock offset sample", Data: dataOf[PingData](), Reply: "pong"},
+
+	"playback:sync":      {Direction: directionServer, Description: "The full playback state after a change", Data: dataOf[PlaybackState]()},
+	"queue:sync":         {Direction: directionServer, Description: "The queue after a change", Data: dataOf[QueueSync]()},
+	"device:list_update": {Direction: directionServer, Description: "The user's connected devices", Data: dataOf[DeviceListUpdate]()},
+	"lyrics:line":        {Direction: directionServer, Description: "The active lyric line changed", Data: dataOf[LyricsLineUpdate]()},
+	"session:ready":      {Direction: directionServer, Description: "The client is up to date after connecting", Data: dataOf[ResumeInfo]()},
+	"pong":               {Direction: directionServer, Description: "Reply to ping", Data: dataOf[PongData]()},
+	"ack":                {Direction: directionServer, Description: "A message with a request_id was applied", Data: dataOf[AckData]()},
+	"error":              {Direction: directionServer, Description: "A message was rejected", Data: dataOf[ErrorData]()},
+}
+
+// inboundMessage is a client message before its data is decoded for its type
+type inboundMessage struct {
+	Type      string          `json:"type"`
+	RequestID string          `json:"request_id,omitempty"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// decodeMessage reads and validates a client message. Data is decoded into the type's data
+// type, as a pointer. On error the returned message carries whatever type and request ID
+// could be read, for the error reply.
+func decodeMessage(raw []byte) (Message, error) {
+	var in inboundMessage
+	if err := json.Unmarshal(raw, &in); err != nil || in.Type == "" {
+		return Message{Type: in.Type, RequestID: in.RequestID}, errInvalidMessage
+	}
+
+	msg := Message{Type: in.Type, RequestID: in.RequestID}
+	spec, ok := protocolMessages[in.Type]
+	if !ok || spec.Direction == directionServer {
+		return msg, errUnknownType
+	}
+	if spec.Data == nil {
+		return msg, nil
+	}
+
+	data := spec.Data()
+	if len(in.Data) > 0 && string(in.Data) != "null" {
+		if err := json.Unmarshal(in.Data, data); err != nil {
+			return msg, fmt.Errorf("%w: %v", errInvalidData, err)
+		}
+	}
+	if v, ok := data.(validator); ok {
+		if err := v.Validate(); err != nil {
+			return msg, fmt.Errorf("%w: %v", errInvalidData, err)
+		}
+	}
+	msg.Data = data
+	return msg, nil
+}
+
+// errorCode maps an error from handling a message to its code. Unexpected errors are
+// reported without their details.
+func errorCode(err error) (string, string) {
+	switch {
+	case errors.Is(err, errInvalidMessage):
+		return CodeInvalidMessage, err.Error()
+	case errors.Is(err, errUnknownType):
+		return CodeUnknownType, err.Error()
+	case errors.Is(err, errInvalidData):
+		return CodeInvalidData, err.Error()
+	case errors.Is(err, errNotActiveDevice):
+		return CodeNotActiveDevice, err.Error()
+	case errors.Is(err, errStaleVersion):
+		return CodeStaleVersion, err.Error()
+	case errors.Is(err, errQueueFull):
+		return CodeQueueFull, err.Error()
+	case errors.Is(err, errQueueItem):
+		return CodeQueueItemNotFound, err.Error()
+	case errors.Is(err, errQueueConflict):
+		return CodeConflict, err.Error()
+	default:
+		return CodeInternal, "internal error"
+	}
+}
+
+// sendError tells the client its message was rejected
+func (c *Client) sendError(msg Message, err error) {
+	code, message := errorCode(err)
+	if code == CodeInternal {
+		log.Printf("Failed to handle %s from client %s: %v", msg.Type, c.ID, err)
+	}
+	c.sendMessage(Message{Type: "error", RequestID: msg.RequestID, Data: ErrorData{Code: code, Message: message, Type: msg.Type}})
+}
+
+// sendAck confirms a message that asked for it and has no reply of its own
+func (c *Client) sendAck(msg Message) {
+	if msg.RequestID == "" || protocolMessages[msg.Type].Reply != "" {
+		return
+	}
+	c.sendMessage(Message{Type: "ack", RequestID: msg.RequestID, Data: AckData{Type: msg.Type}})
+}
+
+// Validate checks the fields a client may set in a playback state
+func (s *PlaybackState) Validate() error {
+	if s.Position != nil && *s.Position < 0 {
+		return errors.New("position must not be negative")
+	}
+	if s.Volume != nil && (*s.Volume < 0 || *s.Volume > 1) {
+		return errors.New("volume must be between 0 and 1")
+	}
+	if s.Repeat != "" && !validRepeatMode(s.Repeat) {
+		return fmt.Errorf("repeat must be %q, %q or %q", RepeatNone, RepeatOne, RepeatAll)
+	}
+	if s.Rate != nil && *s.Rate <= 0 {
+		return errors.New("rate must be positive")
+	}
+	if s.Version < 0 {
+		return errors.New("version must not be negative")
+	}
+	return nil
+}
+
+func (c *SeekCommand) Validate() error {
+	if c.Position < 0 {
+		return errors.New("position must not be negative")
+	}
+	return nil
+}
+
+func (c *VolumeCommand) Validate() error {
+	if c.Volume == nil {
+		return errors.New("volume is required")
+	}
+	if *c.Volume < 0 || *c.Volume > 1 {
+		return errors.New("volume must be between 0 and 1")
+	}
+	return nil
+}
+
+func (c *LoadTrackCommand) Validate() error {
+	if c.TrackID == "" && len(c.TrackIDs) == 0 {
+		return errors.New("track_id or track_ids is required")
+	}
+	if len(c.TrackIDs) > MaxQueueTracks {
+		return fmt.Errorf("at most %d track_ids", MaxQueueTracks)
+	}
+	if c.Index != nil && (*c.Index < 0 || *c.Index >= len(c.TrackIDs)) {
+		return errors.New("index is out of range of track_ids")
+	}
+	return nil
+}
+
+func (c *ShuffleCommand) Validate() error {
+	if c.Shuffle == nil {
+		return errors.New("shuffle is required")
+	}
+	return nil
+}
+
+func (c *RepeatCommand) Validate() error {
+	if c.mode() == "" {
+		return errors.New("repeat is required")
+	}
+	if !validRepeatMode(c.mode()) {
+		return fmt.Errorf("repeat must be %q, %q or %q", RepeatNone, RepeatOne, RepeatAll)
+	}
+	return nil
+}
+
+func (c *SetActiveDeviceCommand) Validate() error {
+	if c.DeviceID == "" {
+		return errors.New("device_id is required")
+	}
+	if c.Position != nil && *c.Position < 0 {
+		return errors.New("position must not be negative")
+	}
+	return nil
+}
+
+func (c *QueueAddCommand) Validate() error {
+	if c.TrackID == "" && len(c.TrackIDs) == 0 {
+		return errors.New("track_id or track_ids is required")
+	}
+	if c.Position != nil && *c.Position < 0 {
+		return errors.New("position must not be negative")
+	}
+	return nil
+}
+
+func (c *QueueRemoveCommand) Validate() error {
+	if len(c.ItemIDs) == 0 {
+		return errors.New("item_ids is required")
+	}
+	return nil
+}
+
+func (c *QueueMoveCommand) Validate() error {
+	if c.ItemID == "" {
+		return errors.New("item_id is required")
+	}
+	if c.Position < 0 {
+		return errors.New("position must not be negative")
+	}
+	return nil
+}
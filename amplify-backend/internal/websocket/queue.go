@@ -0,0 +1,691 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Queue limits
+const (
+	MaxQueueTracks   = 10000 // Tracks in the context (playlist, album) being played
+	MaxUpNext        = 500   // Tracks added by the user
+	queueHistorySize = 100
+	queueRetries     = 5
+)
+
+// restartThreshold is how far (ms) into a track "previous" restarts it instead of going back
+const restartThreshold = 3000
+
+// Repeat modes
+const (
+	RepeatNone = "none"
+	RepeatOne  = "one"
+	RepeatAll  = "all"
+)
+
+var (
+	errQueueConflict = errors.New("queue was modified concurrently")
+	errQueueFull     = errors.New("queue is full")
+	errQueueItem     = errors.New("queue item not found")
+
+	// errQueueUnchanged aborts an update that would not change the queue
+	errQueueUnchanged = errors.New("queue unchanged")
+)
+
+// QueueItem is one position in the queue. Its ID stays stable when items move, so the same
+// track can be queued more than once and still be addressed individually.
+type QueueItem struct {
+	ID      string `json:"id"`
+	TrackID string `json:"track_id"`
+}
+
+// queueHistoryEntry is a played item. Position is its index in the context's play order, or
+// -1 if it was not played from the context.
+type queueHistoryEntry struct {
+	Item     QueueItem `json:"item"`
+	Position int       `json:"position"`
+}
+
+// PlayQueue is the server-side queue of one user, shared by all their devices. It is stored
+// as JSON under user:<id>:queue and changed with optimistic WATCH transactions.
+type PlayQueue struct {
+	Context          string              `json:"context,omitempty"` // Where the tracks came from, e.g. "playlist:<id>"
+	Tracks           []QueueItem         `json:"tracks"`            // Context tracks in their original order
+	Order            []int               `json:"order,omitempty"`   // Play order as indices into Tracks while shuffled
+	Position         int                 `json:"position"`          // Play order index of the current or last played context track; -1 before the first
+	UpNext           []QueueItem         `json:"up_next"`           // Added by the user, played before the rest of the context
+	History          []queueHistoryEntry `json:"history"`           // Most recent last
+	Current          *QueueItem          `json:"current,omitempty"`
+	CurrentInContext bool                `json:"current_in_context"`
+	Shuffle          bool                `json:"shuffle"`
+	Seed             int64               `json:"seed,omitempty"` // Seed of the current shuffle permutation
+	Repeat           string              `json:"repeat"`
+	Version          int                 `json:"version"`
+}
+
+// QueueSync is the queue as broadcast to clients in queue:sync
+type QueueSync struct {
+	Version  int         `json:"version"`
+	Context  string      `json:"context,omitempty"`
+	Current  *QueueItem  `json:"current,omitempty"`
+	Position int         `json:"position"` // Index in tracks of the current or last played context track, -1 before the first
+	Tracks   []QueueItem `json:"tracks"`   // Context tracks in play order (shuffled while shuffle is on)
+	UpNext   []QueueItem `json:"up_next"`
+	History  []QueueItem `json:"history"` // Most recent last
+	Shuffle  bool        `json:"shuffle"`
+	Seed     int64       `json:"seed,omitempty"`
+	Repeat   string      `json:"repeat"`
+}
+
+// Queue message data structures
+type QueueAddCommand struct {
+	TrackID  string   `json:"track_id"`
+	TrackIDs []string `json:"track_ids"`
+	Position *int     `json:"position"` // Index in up next; appended when omitted
+}
+
+type QueueRemoveCommand struct {
+	ItemIDs []string `json:"item_ids"`
+}
+
+type QueueMoveCommand struct {
+	ItemID   string `json:"item_id"`
+	Position int    `json:"position"` // Index in the list the item is in: up next or the context play order
+}
+
+type QueueClearCommand struct {
+	All bool `json:"all"` // Also clear the context tracks, not just up next
+}
+
+type NextCommand struct {
+	Auto bool `json:"auto"` // Sent by the player when a track ends; repeat "one" replays it
+}
+
+func getQueueKey(userID string) string {
+	return "user:" + userID + ":queue"
+}
+
+func newQueue() *PlayQueue {
+	return &PlayQueue{Position: -1, Repeat: RepeatNone}
+}
+
+func newQueueItem(trackID string) QueueItem {
+	return QueueItem{ID: generateClientID(), TrackID: trackID}
+}
+
+func validRepeatMode(mode string) bool {
+	return mode == RepeatNone || mode == RepeatOne || mode == RepeatAll
+}
+
+// contextStart is the index in a load command's context tracks to start playing at
+func contextStart(cmd LoadTrackCommand) int {
+	if cmd.Index != nil {
+		return *cmd.Index
+	}
+	for i, trackID := range cmd.TrackIDs {
+		if trackID == cmd.TrackID {
+			return i
+		}
+	}
+	return 0
+}
+
+func newShuffleSeed() int64 {
+	return time.Now().UnixNano()
+}
+
+// decodeQueue turns a stored queue into a PlayQueue; a missing key is an empty queue
+func decodeQueue(val string, err error) (*PlayQueue, error) {
+	if err == redis.Nil {
+		return newQueue(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	queue := newQueue()
+	if err := json.Unmarshal([]byte(val), queue); err != nil {
+		return nil, err
+	}
+	return queue, nil
+}
+
+// loadQueue reads the user's queue
+func (h *Hub) loadQueue(userID string) (*PlayQueue, error) {
+	return decodeQueue(h.redisClient.Get(context.Background(), getQueueKey(userID)).Result())
+}
+
+// updateQueue applies fn to the user's queue and stores it, retrying when another device or
+// server instance changed the queue in between
+func (h *Hub) updateQueue(userID string, fn func(q *PlayQueue) error) (*PlayQueue, error) {
+	ctx := context.Background()
+	key := getQueueKey(userID)
+
+	var updated *PlayQueue
+	txf := func(tx *redis.Tx) error {
+		queue, err := decodeQueue(tx.Get(ctx, key).Result())
+		if err != nil {
+			return err
+		}
+		if err := fn(queue); err != nil {
+			return err
+		}
+		queue.Version++
+
+		data, err := json.Marshal(queue)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, data, 24*time.Hour)
+			return nil
+		})
+		if err == nil {
+			updated = queue
+		}
+		return err
+	}
+
+	for attempt := 0; attempt < queueRetries; attempt++ {
+		err := h.redisClient.Watch(ctx, txf, key)
+		if err == redis.TxFailedErr {
+			continue
+		}
+		return updated, err
+	}
+	return nil, errQueueConflict
+}
+
+// publishQueue broadcasts the queue to every device of the user
+func (h *Hub) publishQueue(userID string, queue *PlayQueue) {
+	h.publishToRedis(userID, Message{Type: "queue:sync", Data: queue.sync()})
+}
+
+// sync builds the queue:sync view of the queue
+func (q *PlayQueue) sync() QueueSync {
+	history := make([]QueueItem, len(q.History))
+	for i, entry := range q.History {
+		history[i] = entry.Item
+	}
+	upNext := q.UpNext
+	if upNext == nil {
+		upNext = []QueueItem{}
+	}
+
+	return QueueSync{
+		Version:  q.Version,
+		Context:  q.Context,
+		Current:  q.Current,
+		Position: q.Position,
+		Tracks:   q.sequence(),
+		UpNext:   upNext,
+		History:  history,
+		Shuffle:  q.Shuffle,
+		Seed:     q.Seed,
+		Repeat:   q.Repeat,
+	}
+}
+
+// isEmpty reports whether the server has nothing queued for the user
+func (q *PlayQueue) isEmpty() bool {
+	return len(q.Tracks) == 0 && len(q.UpNext) == 0 && q.Current == nil
+}
+
+// sequence returns the context tracks in play order
+func (q *PlayQueue) sequence() []QueueItem {
+	items := make([]QueueItem, len(q.Tracks))
+	if !q.Shuffle || len(q.Order) != len(q.Tracks) {
+		copy(items, q.Tracks)
+		return items
+	}
+	for i, index := range q.Order {
+		items[i] = q.Tracks[index]
+	}
+	return items
+}
+
+// setSequence stores context tracks given in play order. While shuffled the original order
+// of the remaining tracks is kept and only the permutation changes.
+func (q *PlayQueue) setSequence(items []QueueItem) {
+	if !q.Shuffle {
+		q.Tracks = items
+		q.Order = nil
+		return
+	}
+
+	remaining := make(map[string]bool, len(items))
+	for _, item := range items {
+		remaining[item.ID] = true
+	}
+	tracks := make([]QueueItem, 0, len(items))
+	indexOf := make(map[string]int, len(items))
+	for _, item := range q.Tracks {
+		if remaining[item.ID] {
+			indexOf[item.ID] = len(tracks)
+			tracks = append(tracks, item)
+		}
+	}
+
+	order := make([]int, len(items))
+	for i, item := range items {
+		order[i] = indexOf[item.ID]
+	}
+	q.Tracks = tracks
+	q.Order = order
+}
+
+// pushHistory records the current item as played
+func (q *PlayQueue) pushHistory() {
+	if q.Current == nil {
+		return
+	}
+
+	position := -1
+	if q.CurrentInContext {
+		position = q.Position
+	}
+	q.History = append(q.History, queueHistoryEntry{Item: *q.Current, Position: position})
+	if len(q.History) > queueHistorySize {
+		q.History = q.History[len(q.History)-queueHistorySize:]
+	}
+}
+
+// setContext replaces the context tracks and starts playing the one at start (an index into
+// trackIDs). Up next is kept; history entries no longer point into the context.
+func (q *PlayQueue) setContext(context string, trackIDs []string, start int) (*QueueItem, error) {
+	if len(trackIDs) > MaxQueueTracks {
+		return nil, errQueueFull
+	}
+	if start < 0 || start >= len(trackIDs) {
+		return nil, errQueueItem
+	}
+
+	q.pushHistory()
+	for i := range q.History {
+		q.History[i].Position = -1
+	}
+
+	q.Context = context
+	q.Tracks = make([]QueueItem, len(trackIDs))
+	for i, trackID := range trackIDs {
+		q.Tracks[i] = newQueueItem(trackID)
+	}
+	q.Order = nil
+	q.Position = start
+	if q.Shuffle {
+		q.shuffleFrom(start, newShuffleSeed())
+	}
+
+	item := q.Tracks[start]
+	q.Current = &item
+	q.CurrentInContext = true
+	return &item, nil
+}
+
+// playStandalone plays a track outside the context; the context resumes after it
+func (q *PlayQueue) playStandalone(trackID string) *QueueItem {
+	q.pushHistory()
+	item := newQueueItem(trackID)
+	q.Current = &item
+	q.CurrentInContext = false
+	return &item
+}
+
+// shuffleFrom draws a new play order from seed. The context track at original index first
+// (or -1 for none) is moved to the front so shuffling does not interrupt it.
+func (q *PlayQueue) shuffleFrom(first int, seed int64) {
+	order := rand.New(rand.NewSource(seed)).Perm(len(q.Tracks))
+	if first >= 0 {
+		for i, index := range order {
+			if index == first {
+				order[0], order[i] = order[i], order[0]
+				break
+			}
+		}
+		q.Position = 0
+	}
+	q.Order = order
+	q.Seed = seed
+}
+
+// setShuffle turns shuffle on or off, keeping the current context track in place
+func (q *PlayQueue) setShuffle(on bool) {
+	if on == q.Shuffle {
+		return
+	}
+
+	current := -1
+	if q.Position >= 0 && q.Position < len(q.Tracks) {
+		current = q.Position
+		if q.Shuffle && len(q.Order) == len(q.Tracks) {
+			current = q.Order[q.Position]
+		}
+	}
+
+	q.Shuffle = on
+	if on {
+		q.shuffleFrom(current, newShuffleSeed())
+		return
+	}
+
+	q.Order = nil
+	q.Seed = 0
+	if current >= 0 {
+		q.Position = current
+	}
+}
+
+// add queues tracks in up next, at position or at the end
+func (q *PlayQueue) add(trackIDs []string, position *int) error {
+	if len(q.UpNext)+len(trackIDs) > MaxUpNext {
+		return errQueueFull
+	}
+
+	at := len(q.UpNext)
+	if position != nil {
+		if *position < 0 || *position > len(q.UpNext) {
+			return errQueueItem
+		}
+		at = *position
+	}
+
+	added := make([]QueueItem, len(trackIDs))
+	for i, trackID := range trackIDs {
+		added[i] = newQueueItem(trackID)
+	}
+
+	upNext := make([]QueueItem, 0, len(q.UpNext)+len(added))
+	upNext = append(upNext, q.UpNext[:at]...)
+	upNext = append(upNext, added...)
+	q.UpNext = append(upNext, q.UpNext[at:]...)
+	return nil
+}
+
+// remove drops items from up next and from the context. The current track keeps playing.
+func (q *PlayQueue) remove(itemIDs []string) error {
+	remove := make(map[string]bool, len(itemIDs))
+	for _, id := range itemIDs {
+		remove[id] = true
+	}
+
+	found := 0
+	upNext := make([]QueueItem, 0, len(q.UpNext))
+	for _, item := range q.UpNext {
+		if remove[item.ID] {
+			found++
+			continue
+		}
+		upNext = append(upNext, item)
+	}
+	q.UpNext = upNext
+
+	sequence := q.sequence()
+	remaining := make([]QueueItem, 0, len(sequence))
+	position := -1
+	for i, item := range sequence {
+		if remove[item.ID] {
+			found++
+			if i == q.Position && q.CurrentInContext {
+				q.CurrentInContext = false
+			}
+			continue
+		}
+		remaining = append(remaining, item)
+		if i <= q.Position {
+			position = len(remaining) - 1
+		}
+	}
+
+	if found == 0 {
+		return errQueueItem
+	}
+
+	q.setSequence(remaining)
+	q.Position = position
+	return nil
+}
+
+// move moves an item within up next or within the context play order
+func (q *PlayQueue) move(itemID string, position int) error {
+	if from := indexOfItem(q.UpNext, itemID); from >= 0 {
+		moved, err := moveItem(q.UpNext, from, position)
+		if err != nil {
+			return err
+		}
+		q.UpNext = moved
+		return nil
+	}
+
+	sequence := q.sequence()
+	from := indexOfItem(sequence, itemID)
+	if from < 0 {
+		return errQueueItem
+	}
+
+	var currentID string
+	if q.Position >= 0 && q.Position < len(sequence) {
+		currentID = sequence[q.Position].ID
+	}
+
+	moved, err := moveItem(sequence, from, position)
+	if err != nil {
+		return err
+	}
+	q.setSequence(moved)
+	if currentID != "" {
+		q.Position = indexOfItem(moved, currentID)
+	}
+	return nil
+}
+
+// clear empties up next, and with all set the context too
+func (q *PlayQueue) clear(all bool) {
+	q.UpNext = nil
+	if !all {
+		return
+	}
+
+	q.Context = ""
+	q.Tracks = nil
+	q.Order = nil
+	q.Position = -1
+	q.CurrentInContext = false
+	for i := range q.History {
+		q.History[i].Position = -1
+	}
+}
+
+// next resolves the track to play after the current one: up next first, then the context in
+// play order. With repeat "all" the context starts over (reshuffled while shuffled); at its
+// end with no repeat nil is returned and the queue is left as it is. With auto set (the track
+// ended on its own) repeat "one" plays the current track again.
+func (q *PlayQueue) next(auto bool) *QueueItem {
+	if auto && q.Repeat == RepeatOne && q.Current != nil {
+		return q.Current
+	}
+
+	if len(q.UpNext) > 0 {
+		q.pushHistory()
+		item := q.UpNext[0]
+		q.UpNext = q.UpNext[1:]
+		q.Current = &item
+		q.CurrentInContext = false
+		return &item
+	}
+
+	position := q.Position + 1
+	if position >= len(q.Tracks) {
+		if q.Repeat != RepeatAll || len(q.Tracks) == 0 {
+			return nil
+		}
+		position = 0
+	}
+
+	q.pushHistory()
+	if position == 0 && q.Position >= 0 && q.Shuffle {
+		q.shuffleFrom(-1, newShuffleSeed())
+	}
+	q.Position = position
+
+	item := q.sequence()[position]
+	q.Current = &item
+	q.CurrentInContext = true
+	return &item
+}
+
+// previous resolves the track to go back to. Past restartThreshold, or with nothing to go
+// back to, the current track restarts. A track from up next that is left goes back to the
+// front of up next so it is not lost.
+func (q *PlayQueue) previous(positionMs int) *QueueItem {
+	if q.Current != nil && positionMs > restartThreshold {
+		return q.Current
+	}
+
+	if len(q.History) == 0 {
+		// Repeat "all" wraps from the first context track to the last
+		if q.Repeat == RepeatAll && q.CurrentInContext && q.Position == 0 && len(q.Tracks) > 1 {
+			q.Position = len(q.Tracks) - 1
+			item := q.sequence()[q.Position]
+			q.Current = &item
+			return &item
+		}
+		return q.Current
+	}
+
+	entry := q.History[len(q.History)-1]
+	q.History = q.History[:len(q.History)-1]
+
+	leaving, leavingInContext := q.Current, q.CurrentInContext
+	if leaving != nil && !leavingInContext {
+		q.UpNext = append([]QueueItem{*leaving}, q.UpNext...)
+		if len(q.UpNext) > MaxUpNext {
+			q.UpNext = q.UpNext[:MaxUpNext]
+		}
+	}
+
+	item := entry.Item
+	q.Current = &item
+	q.CurrentInContext = entry.Position >= 0 && entry.Position < len(q.Tracks)
+	if q.CurrentInContext {
+		q.Position = entry.Position
+	} else if leaving != nil && leavingInContext {
+		// The context track being left plays again on next
+		q.Position--
+	}
+	return &item
+}
+
+func indexOfItem(items []QueueItem, itemID string) int {
+	for i, item := range items {
+		if item.ID == itemID {
+			return i
+		}
+	}
+	return -1
+}
+
+// moveItem moves items[from] to position, counted in the list without the moved item
+func moveItem(items []QueueItem, from, position int) ([]QueueItem, error) {
+	if position < 0 || position >= len(items) {
+		return nil, errQueueItem
+	}
+
+	moved := items[from]
+	result := make([]QueueItem, 0, len(items))
+	result = append(result, items[:from]...)
+	result = append(result, items[from+1:]...)
+	return append(result[:position], append([]QueueItem{moved}, result[position:]...)...), nil
+}
+
+// handleQueueCommand applies a queue:* message from a client and broadcasts the new queue
+func (c *Client) handleQueueCommand(msg Message) error {
+	var apply func(q *PlayQueue) error
+	switch cmd := msg.Data.(type) {
+	case *QueueAddCommand:
+		trackIDs := cmd.TrackIDs
+		if cmd.TrackID != "" {
+			trackIDs = append([]string{cmd.TrackID}, trackIDs...)
+		}
+		apply = func(q *PlayQueue) error { return q.add(trackIDs, cmd.Position) }
+
+	case *QueueRemoveCommand:
+		apply = func(q *PlayQueue) error { return q.remove(cmd.ItemIDs) }
+
+	case *QueueMoveCommand:
+		apply = func(q *PlayQueue) error { return q.move(cmd.ItemID, cmd.Position) }
+
+	case *QueueClearCommand:
+		apply = func(q *PlayQueue) error {
+			q.clear(cmd.All)
+			return nil
+		}
+
+	default:
+		return errUnknownType
+	}
+
+	queue, err := c.hub.updateQueue(c.UserID, apply)
+	if err != nil {
+		return err
+	}
+	c.hub.publishQueue(c.UserID, queue)
+	return nil
+}
+
+// skip resolves control:next and control:previous against the queue and starts the resolved
+// track on the player. Without a server-side queue the command is rebroadcast as before, for
+// clients that keep their own.
+func (c *Client) skip(msg Message) error {
+	state := c.hub.currentPlaybackState(c.UserID)
+
+	var resolved *QueueItem
+	queue, err := c.hub.updateQueue(c.UserID, func(q *PlayQueue) error {
+		if q.isEmpty() {
+			return errQueueItem
+		}
+		if msg.Type == "control:previous" {
+			position := 0
+			if state.Position != nil {
+				position = *state.Position
+			}
+			resolved = q.previous(position)
+			return nil
+		}
+
+		auto := false
+		if cmd, ok := msg.Data.(*NextCommand); ok {
+			auto = cmd.Auto
+		}
+		resolved = q.next(auto)
+		return nil
+	})
+	if errors.Is(err, errQueueItem) {
+		c.hub.publishToRedis(c.UserID, Message{Type: msg.Type, Data: msg.Data})
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	position := 0
+	if resolved == nil {
+		// End of the queue without repeat
+		playing := false
+		_, err = c.hub.updatePlayback(c.UserID, PlaybackState{Playing: &playing, Position: &position}, c)
+	} else {
+		playing := true
+		next := PlaybackState{TrackID: resolved.TrackID, Position: &position, Playing: &playing}
+		if state.ActiveDeviceID == "" {
+			next.ActiveDeviceID = c.DeviceID
+		}
+		_, err = c.hub.updatePlayback(c.UserID, next, c)
+	}
+	// The queue has moved on either way
+	c.hub.publishQueue(c.UserID, queue)
+	return err
+}
@@ -0,0 +1,173 @@
+package websocket
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DescribeMessage adds a server message sent from outside the hub (through NotifyUsers) to
+// the published schema. data is a value of the message's data type.
+// Must be called before Run
+func (h *Hub) DescribeMessage(messageType, description string, data interface{}) {
+	dataType := reflect.TypeOf(data)
+	h.extraMessages[messageType] = messageSpec{
+		Direction:   directionServer,
+		Description: description,
+		Data:        func() interface{} { return reflect.New(dataType).Interface() },
+	}
+}
+
+// Schema returns the protocol as a JSON Schema document. ClientMessage and ServerMessage in
+// $defs are the unions of the messages in each direction, for generating client types.
+func (h *Hub) Schema() map[string]interface{} {
+	messages := make(map[string]messageSpec, len(protocolMessages)+len(h.extraMessages))
+	for messageType, spec := range protocolMessages {
+		messages[messageType] = spec
+	}
+	for messageType, spec := range h.extraMessages {
+		messages[messageType] = spec
+	}
+
+	types := make([]string, 0, len(messages))
+	for messageType := range messages {
+		types = append(types, messageType)
+	}
+	sort.Strings(types)
+
+	gen := schemaGenerator{defs: make(map[string]interface{})}
+	var clientMessages, serverMessages []interface{}
+	for _, messageType := range types {
+		spec := messages[messageType]
+
+		data := map[string]interface{}{"type": "null"}
+		if spec.Data != nil {
+			data = gen.schemaOf(reflect.TypeOf(spec.Data()).Elem())
+		}
+
+		message := map[string]interface{}{
+			"title":       messageType,
+			"description": spec.Description,
+			"type":        "object",
+			"properties": map[string]interface{}{
+				"type":       map[string]interface{}{"const": messageType},
+				"request_id": map[string]interface{}{"type": "string"},
+				"seq":        map[string]interface{}{"type": "string"},
+				"data":       data,
+			},
+			"required": []string{"type"},
+		}
+		if spec.Reply != "" {
+			message["x-reply"] = spec.Reply
+		}
+
+		if spec.Direction != directionServer {
+			clientMessages = append(clientMessages, message)
+		}
+		if spec.Direction != directionClient {
+			serverMessages = append(serverMessages, message)
+		}
+	}
+
+	codes := make([]string, 0, len(errorCodes))
+	for code := range errorCodes {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	gen.defs["ClientMessage"] = map[string]interface{}{"oneOf": clientMessages}
+	gen.defs["ServerMessage"] = map[string]interface{}{"oneOf": serverMessages}
+	gen.defs["ErrorCode"] = map[string]interface{}{"type": "string", "enum": codes}
+
+	return map[string]interface{}{
+		"$schema":      "https://json-schema.org/draft/2020-12/schema",
+		"$id":          "amplify.v" + strconv.Itoa(ProtocolVersion),
+		"title":        "Amplify WebSocket protocol",
+		"version":      ProtocolVersion,
+		"subprotocols": supportedSubprotocols,
+		"oneOf":        []interface{}{map[string]string{"$ref": "#/$defs/ClientMessage"}, map[string]string{"$ref": "#/$defs/ServerMessage"}},
+		"$defs":        gen.defs,
+		"error_codes":  errorCodes,
+	}
+}
+
+// schemaGenerator builds JSON Schemas from Go types. Named structs go into defs and are
+// referenced, so each type is described once.
+type schemaGenerator struct {
+	defs map[string]interface{}
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+func (g *schemaGenerator) schemaOf(t reflect.Type) map[string]interface{} {
+	switch t {
+	case timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case rawMessageType:
+		return map[string]interface{}{}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return g.schemaOf(t.Elem())
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": g.schemaOf(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schemaOf(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		if _, ok := g.defs[t.Name()]; !ok {
+			// Placeholder first, in case the type refers to itself
+			g.defs[t.Name()] = nil
+			g.defs[t.Name()] = g.structSchema(t)
+		}
+		return map[string]interface{}{"$ref": "#/$defs/" + t.Name()}
+	default:
+		// interface{} and anything else JSON can hold
+		return map[string]interface{}{}
+	}
+}
+
+// structSchema describes a struct by its JSON fields. Pointer and omitempty fields are
+// optional; the others are always sent.
+func (g *schemaGenerator) structSchema(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	required := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		properties[name] = g.schemaOf(field.Type)
+		if field.Type.Kind() != reflect.Pointer && !strings.Contains(options, "omitempty") {
+			required = append(required, name)
+		}
+	}
+	return map[string]interface{}{"type": "object", "properties": properties, "required": required}
+}
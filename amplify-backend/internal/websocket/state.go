@@ -0,0 +1,213 @@
+package websocket
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// playbackTTL is how long an idle user's playback state is kept
+const playbackTTL = 24 * time.Hour
+
+func getPlaybackKey(userID string) string {
+	return "user:" + userID + ":playback"
+}
+
+// mergePlaybackScript applies a partial update to the playback hash in one atomic step, so
+// concurrent updates through any server instance never lose each other's fields.
+//
+// KEYS[1] is the playback hash. ARGV[1] is the version the update was based on ("" to apply
+// unconditionally), ARGV[2] the server time (ms), ARGV[3] the TTL (s), and the rest are field
+// and value pairs. An update based on an older version than the stored one is rejected.
+// Before the update is applied a playing position is extrapolated to the server time, and the
+// position is stamped with it. Returns {applied (0/1), version, fields of the merged state}.
+var mergePlaybackScript = redis.NewScript(`
+if redis.call('TYPE', KEYS[1]).ok == 'string' then
+	-- State written before playback was stored as a hash
+	redis.call('DEL', KEYS[1])
+end
+
+local version = tonumber(redis.call('HGET', KEYS[1], 'version') or '0')
+if ARGV[1] ~= '' and tonumber(ARGV[1]) < version then
+	return {0, version, redis.call('HGETALL', KEYS[1])}
+end
+
+local now = tonumber(ARGV[2])
+local position = redis.call('HGET', KEYS[1], 'position')
+local stamped = redis.call('HGET', KEYS[1], 'server_time')
+if position and stamped and redis.call('HGET', KEYS[1], 'playing') == '1' then
+	local rate = tonumber(redis.call('HGET', KEYS[1], 'rate') or '1') or 1
+	if rate <= 0 then
+		rate = 1
+	end
+	local elapsed = now - tonumber(stamped)
+	if elapsed > 0 then
+		redis.call('HSET', KEYS[1], 'position', string.format('%d', math.floor(tonumber(position) + elapsed * rate)))
+	end
+end
+
+for i = 4, #ARGV, 2 do
+	redis.call('HSET', KEYS[1], ARGV[i], ARGV[i + 1])
+end
+if redis.call('HEXISTS', KEYS[1], 'position') == 1 then
+	redis.call('HSET', KEYS[1], 'server_time', ARGV[2])
+end
+
+version = redis.call('HINCRBY', KEYS[1], 'version', 1)
+redis.call('EXPIRE', KEYS[1], ARGV[3])
+return {1, version, redis.call('HGETALL', KEYS[1])}
+`)
+
+// playbackFields converts the set fields of a partial update to hash fields
+func playbackFields(update PlaybackState) map[string]string {
+	fields := make(map[string]string)
+	if update.TrackID != "" {
+		fields["track_id"] = update.TrackID
+	}
+	if update.Position != nil {
+		fields["position"] = strconv.Itoa(*update.Position)
+	}
+	if update.Playing != nil {
+		fields["playing"] = formatFlag(*update.Playing)
+	}
+	if update.Volume != nil {
+		fields["volume"] = strconv.FormatFloat(*update.Volume, 'f', -1, 64)
+	}
+	if update.Shuffle != nil {
+		fields["shuffle"] = formatFlag(*update.Shuffle)
+	}
+	if update.Repeat != "" {
+		fields["repeat"] = update.Repeat
+	}
+	if update.ActiveDeviceID != "" {
+		fields["active_device_id"] = update.ActiveDeviceID
+	}
+	if update.Rate != nil {
+		fields["rate"] = strconv.FormatFloat(*update.Rate, 'f', -1, 64)
+	}
+	return fields
+}
+
+// decodePlaybackState builds a state from the playback hash
+func decodePlaybackState(fields map[string]string) PlaybackState {
+	var state PlaybackState
+	state.TrackID = fields["track_id"]
+	state.Repeat = fields["repeat"]
+	state.ActiveDeviceID = fields["active_device_id"]
+
+	if value, ok := fields["position"]; ok {
+		if position, err := strconv.Atoi(value); err == nil {
+			state.Position = &position
+		}
+	}
+	if value, ok := fields["playing"]; ok {
+		playing := value == "1"
+		state.Playing = &playing
+	}
+	if value, ok := fields["volume"]; ok {
+		if volume, err := strconv.ParseFloat(value, 64); err == nil {
+			state.Volume = &volume
+		}
+	}
+	if value, ok := fields["shuffle"]; ok {
+		shuffle := value == "1"
+		state.Shuffle = &shuffle
+	}
+	if value, ok := fields["rate"]; ok {
+		if rate, err := strconv.ParseFloat(value, 64); err == nil {
+			state.Rate = &rate
+		}
+	}
+	state.ServerTime, _ = strconv.ParseInt(fields["server_time"], 10, 64)
+	state.Version, _ = strconv.ParseInt(fields["version"], 10, 64)
+	return state
+}
+
+func formatFlag(value bool) string {
+	if value {
+		return "1"
+	}
+	return "0"
+}
+
+// loadPlaybackState reads the user's stored playback state as last written. A missing or
+// legacy key reads as an empty state; the next merge replaces a legacy key with a hash.
+func (h *Hub) loadPlaybackState(userID string) (PlaybackState, error) {
+	fields, err := h.redisClient.HGetAll(context.Background(), getPlaybackKey(userID)).Result()
+	if redis.HasErrorPrefix(err, "WRONGTYPE") {
+		// State written before playback was stored as a hash
+		return PlaybackState{}, nil
+	}
+	if err != nil {
+		return PlaybackState{}, err
+	}
+	return decodePlaybackState(fields), nil
+}
+
+// currentPlaybackState reads the user's stored playback state with the position as of now
+func (h *Hub) currentPlaybackState(userID string) PlaybackState {
+	state, err := h.loadPlaybackState(userID)
+	if err != nil {
+		return PlaybackState{}
+	}
+	state.advanceTo(nowMillis())
+	return state
+}
+
+// mergePlaybackState atomically applies fields to the user's playback state. With an expected
+// version the update is rejected if the state has moved past it. Returns the state after the
+// merge, or the current state if the update was rejected.
+func (h *Hub) mergePlaybackState(userID string, fields map[string]string, expectedVersion int64) (PlaybackState, bool, error) {
+	args := make([]interface{}, 0, 3+2*len(fields))
+	if expectedVersion > 0 {
+		args = append(args, strconv.FormatInt(expectedVersion, 10))
+	} else {
+		args = append(args, "")
+	}
+	args = append(args, nowMillis(), int(playbackTTL/time.Second))
+	for field, value := range fields {
+		args = append(args, field, value)
+	}
+
+	result, err := mergePlaybackScript.Run(context.Background(), h.redisClient, []string{getPlaybackKey(userID)}, args...).Slice()
+	if err != nil {
+		return PlaybackState{}, false, err
+	}
+	if len(result) != 3 {
+		return PlaybackState{}, false, redis.Nil
+	}
+
+	applied, _ := result[0].(int64)
+	pairs, _ := result[2].([]interface{})
+	merged := make(map[string]string, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		field, _ := pairs[i].(string)
+		value, _ := pairs[i+1].(string)
+		merged[field] = value
+	}
+
+	return decodePlaybackState(merged), applied == 1, nil
+}
+
+// updatePlayback merges a partial update into the user's playback state and broadcasts the
+// merged state to every device. The version in the update, when set, is the version the
+// sender last saw; an update based on an older state is rejected with errStaleVersion and
+// the sender is sent the current state instead.
+func (h *Hub) updatePlayback(userID string, update PlaybackState, sender *Client) (PlaybackState, error) {
+	merged, applied, err := h.mergePlaybackState(userID, playbackFields(update), update.Version)
+	if err != nil {
+		return PlaybackState{}, err
+	}
+
+	if !applied {
+		if sender != nil {
+			sender.sendMessage(Message{Type: "playback:sync", Data: merged})
+		}
+		return merged, errStaleVersion
+	}
+
+	h.publishToRedis(userID, Message{Type: "playback:sync", Data: merged})
+	return merged, nil
+}